@@ -26,6 +26,7 @@ func main() {
 			&commands.AuthCommand,
 			&commands.BuildCommand,
 			&commands.DeployCommand,
+			&commands.MigrateCommand,
 		},
 		Before: func(ctx *cli.Context) error {
 			env := ctx.String("env")
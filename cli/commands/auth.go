@@ -1,9 +1,14 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"blinders/packages/auth"
 	authutils "blinders/packages/auth/utils"
@@ -16,29 +21,37 @@ import (
 var client *firebaseAuth.Client
 
 var AuthCommand = cli.Command{
-	Name:        "auth",
-	Subcommands: []*cli.Command{&loadAuthCommand, &genWSCatCommand},
-	Before: func(ctx *cli.Context) error {
-		env := ctx.String("env")
-		adminJSON, err := utils.GetFile(fmt.Sprintf("firebase.admin.%v.json", env))
-		if err != nil {
-			return err
-		}
-
-		a, err := auth.NewFirebaseManager(adminJSON, nil)
-		if err != nil {
-			return err
-		}
-		client = a.Client
-
-		return nil
+	Name: "auth",
+	Subcommands: []*cli.Command{
+		&loadAuthCommand,
+		&genWSCatCommand,
+		&mintLocalJWTCommand,
+		&grantRoleCommand,
 	},
 }
 
+// loadFirebaseClient is used by subcommands that work with firebase, local subcommands do not need it
+func loadFirebaseClient(ctx *cli.Context) error {
+	env := ctx.String("env")
+	adminJSON, err := utils.GetFile(fmt.Sprintf("firebase.admin.%v.json", env))
+	if err != nil {
+		return err
+	}
+
+	verifier, err := auth.NewFirebaseVerifier(adminJSON)
+	if err != nil {
+		return err
+	}
+	client = verifier.Client
+
+	return nil
+}
+
 var loadAuthCommand = cli.Command{
-	Name:  "jwt",
-	Usage: "load user jwt by using uid",
-	Args:  true,
+	Name:   "jwt",
+	Usage:  "load user jwt by using uid",
+	Args:   true,
+	Before: loadFirebaseClient,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name: "uid",
@@ -76,9 +89,10 @@ var loadAuthCommand = cli.Command{
 }
 
 var genWSCatCommand = cli.Command{
-	Name:  "wscat",
-	Usage: "load user jwt and generate wscat command for easily connect to websocket api by using uid",
-	Args:  true,
+	Name:   "wscat",
+	Usage:  "load user jwt, request a websocket ticket and generate wscat command for easily connect to websocket api by using uid",
+	Args:   true,
+	Before: loadFirebaseClient,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name: "uid",
@@ -87,6 +101,11 @@ var genWSCatCommand = cli.Command{
 			Name:     "endpoint",
 			Required: true,
 		},
+		&cli.StringFlag{
+			Name:  "api",
+			Usage: "http api to request the websocket ticket",
+			Value: "http://localhost:8080",
+		},
 	},
 	Action: func(ctx *cli.Context) error {
 		webAPIKey := os.Getenv("WEB_API_KEY")
@@ -115,8 +134,84 @@ var genWSCatCommand = cli.Command{
 			return fmt.Errorf("failed to load firebase auth: %v", err)
 		}
 
-		fmt.Printf("wscat -c \"wss://%v?token=%v\"\n", endpoint, idToken)
+		ticket, err := requestWebsocketTicket(ctx.String("api"), idToken)
+		if err != nil {
+			return fmt.Errorf("failed to request websocket ticket: %v", err)
+		}
+
+		fmt.Printf("wscat -c \"wss://%v?ticket=%v\"\n", endpoint, ticket)
+		fmt.Println("the ticket is single-use and expires in a short time, connect right away")
+
+		return nil
+	},
+}
+
+var mintLocalJWTCommand = cli.Command{
+	Name:  "mint",
+	Usage: "mint a local jwt for development, require AUTH_LOCAL_JWT_SECRET or AUTH_LOCAL_JWT_PRIVATE_KEY_FILE",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "uid",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name: "email",
+		},
+		&cli.StringFlag{
+			Name: "name",
+		},
+		&cli.DurationFlag{
+			Name:  "ttl",
+			Value: time.Hour,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		cfg, err := auth.LocalJWTConfigFromEnv()
+		if err != nil {
+			return fmt.Errorf("failed to load local jwt config: %v", err)
+		}
+
+		token, err := cfg.MintLocalToken(
+			ctx.String("uid"),
+			ctx.String("email"),
+			ctx.String("name"),
+			ctx.Duration("ttl"),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to mint local jwt: %v", err)
+		}
+
+		fmt.Printf("JWT of %v: %v\n", ctx.String("uid"), token)
 
 		return nil
 	},
 }
+
+// requestWebsocketTicket requests a single-use ticket of the user from the users api
+func requestWebsocketTicket(api string, idToken string) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(api, "/")+"/users/self/ws-ticket", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+idToken)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("unexpected status %v: %s", res.StatusCode, body)
+	}
+
+	var resBody struct {
+		Ticket string `json:"ticket"`
+	}
+	if err := json.Unmarshal(body, &resBody); err != nil {
+		return "", err
+	}
+
+	return resBody.Ticket, nil
+}
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"blinders/packages/dbutils"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+var MigrateCommand = cli.Command{
+	Name:  "migrate",
+	Usage: "manage mongo schema migrations, require mongo config from environment",
+	Subcommands: []*cli.Command{
+		&migrateUpCommand,
+		&migrateDownCommand,
+		&migrateStatusCommand,
+	},
+}
+
+var migrateUpCommand = cli.Command{
+	Name:  "up",
+	Usage: "apply pending migrations",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "to",
+			Usage: "apply migrations up to this version, all pending migrations by default",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		migrator, err := loadMigrator()
+		if err != nil {
+			return err
+		}
+
+		applied, err := migrator.Up(ctx.Context, ctx.Int("to"))
+		for _, m := range applied {
+			color.Green("applied %d: %s", m.Version, m.Description)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+		return nil
+	},
+}
+
+var migrateDownCommand = cli.Command{
+	Name:  "down",
+	Usage: "revert the latest applied migrations",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "steps",
+			Value: 1,
+			Usage: "number of migrations to revert",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		migrator, err := loadMigrator()
+		if err != nil {
+			return err
+		}
+
+		reverted, err := migrator.Down(ctx.Context, ctx.Int("steps"))
+		for _, m := range reverted {
+			color.Yellow("reverted %d: %s", m.Version, m.Description)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no applied migrations")
+		}
+
+		return nil
+	},
+}
+
+var migrateStatusCommand = cli.Command{
+	Name:  "status",
+	Usage: "list migrations and whether they are applied",
+	Action: func(ctx *cli.Context) error {
+		migrator, err := loadMigrator()
+		if err != nil {
+			return err
+		}
+
+		statuses, err := migrator.Status(ctx.Context)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			if s.Applied {
+				color.Green("[x] %d: %s (applied at %s)", s.Version, s.Description, s.AppliedAt.Format(time.RFC3339))
+			} else {
+				fmt.Printf("[ ] %d: %s\n", s.Version, s.Description)
+			}
+		}
+
+		return nil
+	},
+}
+
+func loadMigrator() (*dbutils.Migrator, error) {
+	db, err := dbutils.InitMongoDatabaseFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return dbutils.NewMigrator(db, migrations...)
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"slices"
+
+	"blinders/packages/dbutils"
+	chatrepo "blinders/services/chat/repo"
+	practicerepo "blinders/services/practice/repo"
+	"blinders/services/suggest"
+	usersrepo "blinders/services/users/repo"
+)
+
+// migrations are applied in order of version, released migrations must not be changed,
+// add a new migration instead
+var migrations = []dbutils.Migration{
+	dbutils.IndexMigration(1, "create indexes of users and feedback",
+		slices.Concat(usersrepo.UsersIndexes, usersrepo.FeedbackIndexes)...),
+	dbutils.IndexMigration(2, "create indexes of friend requests",
+		usersrepo.FriendRequestsIndexes...),
+	dbutils.IndexMigration(3, "create indexes of conversations and messages",
+		slices.Concat(chatrepo.ConversationsIndexes, chatrepo.MessagesIndexes)...),
+	dbutils.IndexMigration(4, "create indexes of flashcards and snapshots",
+		slices.Concat(practicerepo.FlashcardsIndexes, practicerepo.SnapshotsIndexes)...),
+	dbutils.IndexMigration(5, "create indexes of review logs",
+		practicerepo.ReviewLogsIndexes...),
+	dbutils.IndexMigration(6, "create indexes of explain logs",
+		practicerepo.ExplainLogsIndexes...),
+	dbutils.IndexMigration(7, "create indexes of explain log history",
+		suggest.ExplainLogsIndexes...),
+	dbutils.IndexMigration(8, "create share token index of flashcards",
+		practicerepo.FlashcardsShareIndexes...),
+	dbutils.IndexMigration(9, "create tag index of flashcards",
+		practicerepo.FlashcardsTagIndexes...),
+	dbutils.IndexMigration(10, "create indexes of cards",
+		practicerepo.CardsIndexes...),
+	{
+		Version:     11,
+		Description: "move flashcards embedded in collections to cards",
+		Up:          practicerepo.MoveFlashcardsToCards,
+		Down:        practicerepo.MoveCardsToFlashcards,
+	},
+	dbutils.IndexMigration(12, "create indexes of activity logs",
+		practicerepo.ActivityLogsIndexes...),
+	{
+		Version:     13,
+		Description: "make snapshots unique by user and type",
+		Up:          practicerepo.MakeSnapshotsUnique,
+		Down:        practicerepo.MakeSnapshotsNonUnique,
+	},
+	{
+		Version:     14,
+		Description: "search users by lowercase name",
+		Up:          usersrepo.SetUsersNameLower,
+		Down:        usersrepo.UnsetUsersNameLower,
+	},
+	dbutils.IndexMigration(15, "create expiry index of feedback rates",
+		usersrepo.FeedbackRatesIndexes...),
+	dbutils.IndexMigration(16, "make collections of explain logs unique by user",
+		practicerepo.FlashcardsOfTypeIndexes...),
+}
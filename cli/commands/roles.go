@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
+	"blinders/packages/auth"
+	"blinders/packages/dbutils"
+	"blinders/packages/utils"
+	"blinders/services/users/repo"
+
+	"github.com/urfave/cli/v2"
+)
+
+var grantRoleCommand = cli.Command{
+	Name:  "grant-role",
+	Usage: "grant (or revoke) a role of user identified by uid, require mongo config from environment",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "uid",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "role",
+			Usage:    "user, moderator or admin",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "revoke",
+			Usage: "revoke the role instead of granting it",
+		},
+		&cli.BoolFlag{
+			Name:  "claims",
+			Usage: "also update roles custom claim of firebase user, it takes effect when the token is refreshed",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		uid := ctx.String("uid")
+		revoke := ctx.Bool("revoke")
+		role, err := auth.ParseRole(ctx.String("role"))
+		if err != nil {
+			return err
+		}
+
+		db, err := dbutils.InitMongoDatabaseFromEnv()
+		if err != nil {
+			return err
+		}
+		usersRepo := repo.NewUsersRepo(db)
+
+		user, err := usersRepo.GetUserByFirebaseUID(ctx.Context, uid)
+		if err != nil {
+			return fmt.Errorf("can not find user of uid %s: %v", uid, err)
+		}
+
+		if revoke {
+			err = usersRepo.RemoveUserRole(ctx.Context, user.ID, string(role))
+		} else {
+			err = usersRepo.AddUserRole(ctx.Context, user.ID, string(role))
+		}
+		if err != nil {
+			return fmt.Errorf("can not update roles of user: %v", err)
+		}
+
+		// tokens cached by instances sharing the redis cache would keep the old roles until they expire,
+		// in-memory caches are invalidated by the change events of the user
+		if os.Getenv("AUTH_TOKEN_CACHE_REDIS") == "true" {
+			store := auth.NewRedisTokenStore(utils.NewRedisClientFromEnv(ctx.Context))
+			if err := store.DeleteByAuthID(ctx.Context, uid); err != nil {
+				return fmt.Errorf("can not evict cached tokens of user: %v", err)
+			}
+		}
+
+		if ctx.Bool("claims") {
+			if err := loadFirebaseClient(ctx); err != nil {
+				return err
+			}
+			if err := updateRolesClaim(ctx.Context, uid, role, revoke); err != nil {
+				return fmt.Errorf("can not update roles claim: %v", err)
+			}
+		}
+
+		action := "granted"
+		if revoke {
+			action = "revoked"
+		}
+		fmt.Printf("%s role %s of user %s (%s)\n", action, role, user.ID.Hex(), uid)
+
+		return nil
+	},
+}
+
+// updateRolesClaim updates the roles custom claim and keeps other custom claims of the firebase user
+func updateRolesClaim(ctx context.Context, uid string, role auth.Role, revoke bool) error {
+	record, err := client.GetUser(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	claims := record.CustomClaims
+	if claims == nil {
+		claims = make(map[string]any)
+	}
+
+	var roles []string
+	if values, ok := claims[auth.RolesClaim].([]any); ok {
+		for _, value := range values {
+			if s, ok := value.(string); ok && s != string(role) {
+				roles = append(roles, s)
+			}
+		}
+	}
+	if !revoke {
+		roles = append(roles, string(role))
+	}
+	slices.Sort(roles)
+	claims[auth.RolesClaim] = roles
+
+	return client.SetCustomUserClaims(ctx, uid, claims)
+}
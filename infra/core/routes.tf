@@ -63,6 +63,18 @@ resource "aws_apigatewayv2_route" "get_suggest_v2" {
   target    = "integrations/${aws_apigatewayv2_integration.suggestv2.id}"
 }
 
+resource "aws_apigatewayv2_route" "get_suggest_v2_explain_logs" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /suggest/v2/explain-logs"
+  target    = "integrations/${aws_apigatewayv2_integration.suggestv2.id}"
+}
+
+resource "aws_apigatewayv2_route" "post_suggest_v2_explain_logs" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "POST /suggest/v2/explain-logs"
+  target    = "integrations/${aws_apigatewayv2_integration.suggestv2.id}"
+}
+
 resource "aws_lambda_permission" "suggestv2" {
   statement_id  = "AllowExecutionFromAPIGateway"
   action        = "lambda:InvokeFunction"
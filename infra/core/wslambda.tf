@@ -16,8 +16,10 @@ resource "aws_lambda_function" "ws_authorizer" {
   environment {
     variables = {
       ENVIRONMENT : var.project.environment
-      MONGO_DATABASE : local.envs.MONGO_DATABASE
-      MONGO_DATABASE_URL : local.envs.MONGO_DATABASE_URL
+      REDIS_HOST : local.envs.REDIS_HOST
+      REDIS_PORT : local.envs.REDIS_PORT
+      REDIS_USERNAME : local.envs.REDIS_USERNAME
+      REDIS_PASSWORD : local.envs.REDIS_PASSWORD
     }
   }
 
@@ -36,3 +36,13 @@ func UnauthorizedResponse(message string) events.APIGatewayV2HTTPResponse {
 		},
 	}
 }
+
+func ForbiddenResponse(message string) events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusForbidden,
+		Body:       message,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		},
+	}
+}
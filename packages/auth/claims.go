@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrMissingClaim = errors.New("missing required claim")
+	ErrTokenRevoked = errors.New("token has been revoked")
+)
+
+// sign in providers of firebase, see firebase.sign_in_provider claim
+const (
+	PasswordSignIn  = "password"
+	GoogleSignIn    = "google.com"
+	AppleSignIn     = "apple.com"
+	PhoneSignIn     = "phone"
+	AnonymousSignIn = "anonymous"
+	CustomSignIn    = "custom"
+)
+
+// UserAuthFromClaims extracts the identity from token claims without assuming
+// any claim other than the identity (authID) exists, e.g. phone or anonymous sign-ins
+// do not have email and name, apple sign-ins usually do not have name
+func UserAuthFromClaims(authID string, provider string, claims map[string]any) (*UserAuth, error) {
+	if authID == "" {
+		return nil, fmt.Errorf("%w: uid", ErrMissingClaim)
+	}
+
+	userAuth := &UserAuth{
+		AuthID:        authID,
+		Provider:      provider,
+		Email:         stringClaim(claims, "email"),
+		EmailVerified: boolClaim(claims, "email_verified"),
+		Name:          stringClaim(claims, "name"),
+		Picture:       stringClaim(claims, "picture"),
+		Phone:         stringClaim(claims, "phone_number"),
+		Roles:         rolesClaim(claims),
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		userAuth.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+
+	return userAuth, nil
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func boolClaim(claims map[string]any, name string) bool {
+	value, _ := claims[name].(bool)
+	return value
+}
+
+// VerifyErrorMessage returns a message of a verification error that is safe to respond to clients
+func VerifyErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrMissingClaim):
+		return "invalid jwt, " + err.Error()
+	case errors.Is(err, ErrTokenRevoked):
+		return "jwt has been revoked, please sign in again"
+	case errors.Is(err, ErrTokenExpired):
+		return "jwt is expired"
+	default:
+		return "can not verify jwt"
+	}
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserAuthFromClaims(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name     string
+		authID   string
+		provider string
+		claims   map[string]any
+		expected *UserAuth
+		err      error
+	}{
+		{
+			name:     "password",
+			authID:   "uid",
+			provider: PasswordSignIn,
+			claims: map[string]any{
+				"email":          "user@peakee.co",
+				"email_verified": true,
+				"name":           "User",
+				"exp":            float64(exp),
+			},
+			expected: &UserAuth{
+				AuthID:        "uid",
+				Provider:      PasswordSignIn,
+				Email:         "user@peakee.co",
+				EmailVerified: true,
+				Name:          "User",
+				ExpiresAt:     time.Unix(exp, 0),
+			},
+		},
+		{
+			name:     "google",
+			authID:   "uid",
+			provider: GoogleSignIn,
+			claims: map[string]any{
+				"email":          "user@gmail.com",
+				"email_verified": true,
+				"name":           "User",
+				"picture":        "https://lh3.googleusercontent.com/a/picture",
+			},
+			expected: &UserAuth{
+				AuthID:        "uid",
+				Provider:      GoogleSignIn,
+				Email:         "user@gmail.com",
+				EmailVerified: true,
+				Name:          "User",
+				Picture:       "https://lh3.googleusercontent.com/a/picture",
+			},
+		},
+		{
+			name:     "apple without name",
+			authID:   "uid",
+			provider: AppleSignIn,
+			claims:   map[string]any{"email": "relay@privaterelay.appleid.com"},
+			expected: &UserAuth{
+				AuthID:   "uid",
+				Provider: AppleSignIn,
+				Email:    "relay@privaterelay.appleid.com",
+			},
+		},
+		{
+			name:     "phone",
+			authID:   "uid",
+			provider: PhoneSignIn,
+			claims:   map[string]any{"phone_number": "+84123456789"},
+			expected: &UserAuth{AuthID: "uid", Provider: PhoneSignIn, Phone: "+84123456789"},
+		},
+		{
+			name:     "anonymous",
+			authID:   "uid",
+			provider: AnonymousSignIn,
+			claims:   map[string]any{},
+			expected: &UserAuth{AuthID: "uid", Provider: AnonymousSignIn},
+		},
+		{
+			name:     "unexpected claim types",
+			authID:   "uid",
+			provider: PasswordSignIn,
+			claims:   map[string]any{"email": 1, "name": nil, "email_verified": "true"},
+			expected: &UserAuth{AuthID: "uid", Provider: PasswordSignIn},
+		},
+		{
+			name:     "missing uid",
+			provider: PasswordSignIn,
+			claims:   map[string]any{"email": "user@peakee.co"},
+			err:      ErrMissingClaim,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userAuth, err := UserAuthFromClaims(test.authID, test.provider, test.claims)
+			assert.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.expected, userAuth)
+		})
+	}
+}
+
+func TestVerifyErrorMessage(t *testing.T) {
+	_, err := UserAuthFromClaims("", PhoneSignIn, nil)
+	assert.Equal(t, "invalid jwt, missing required claim: uid", VerifyErrorMessage(err))
+	assert.Equal(t, "jwt is expired", VerifyErrorMessage(ErrTokenExpired))
+	assert.Equal(t, "can not verify jwt", VerifyErrorMessage(ErrInvalidToken))
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	firebase "firebase.google.com/go"
+	"firebase.google.com/go/auth"
+	"google.golang.org/api/option"
+)
+
+// FirebaseVerifier verifies firebase ID tokens with the Firebase Admin SDK
+type FirebaseVerifier struct {
+	App    *firebase.App
+	Client *auth.Client
+
+	// CheckRevoked additionally checks if the token has been revoked,
+	// it costs a request to firebase for every verification
+	CheckRevoked bool
+}
+
+func NewFirebaseVerifier(adminConfig []byte) (*FirebaseVerifier, error) {
+	opt := option.WithCredentialsJSON(adminConfig)
+	app, err := firebase.NewApp(context.Background(), nil, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := app.Auth(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return &FirebaseVerifier{App: app, Client: client}, nil
+}
+
+func (v FirebaseVerifier) Verify(ctx context.Context, jwt string) (*UserAuth, error) {
+	var (
+		authToken *auth.Token
+		err       error
+	)
+	if v.CheckRevoked {
+		authToken, err = v.Client.VerifyIDTokenAndCheckRevoked(ctx, jwt)
+	} else {
+		authToken, err = v.Client.VerifyIDToken(ctx, jwt)
+	}
+	if auth.IsIDTokenRevoked(err) {
+		return nil, ErrTokenRevoked
+	} else if err != nil {
+		return nil, err
+	}
+
+	userAuth, err := UserAuthFromClaims(authToken.UID, authToken.Firebase.SignInProvider, authToken.Claims)
+	if err != nil {
+		return nil, err
+	}
+	userAuth.ExpiresAt = time.Unix(authToken.Expires, 0)
+
+	return userAuth, nil
+}
+
+func (v FirebaseVerifier) DeleteIdentity(ctx context.Context, authID string) error {
+	return v.Client.DeleteUser(ctx, authID)
+}
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+
+	DefaultLocalJWTIssuer = "blinders-local"
+)
+
+var (
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrTokenExpired    = errors.New("token is expired")
+	ErrUnsupportedAlg  = errors.New("unsupported token algorithm")
+	ErrInvalidSignKeys = errors.New("require HMAC secret or RSA keys")
+)
+
+// LocalJWTConfig holds keys to sign and verify local tokens, HMAC secret takes precedence over RSA keys.
+// Verifying with RSA only requires the public key
+type LocalJWTConfig struct {
+	Issuer        string
+	HMACSecret    []byte
+	RSAPublicKey  *rsa.PublicKey
+	RSAPrivateKey *rsa.PrivateKey
+}
+
+// LocalJWTConfigFromEnv loads config from AUTH_LOCAL_JWT_ISSUER, AUTH_LOCAL_JWT_SECRET,
+// AUTH_LOCAL_JWT_PUBLIC_KEY_FILE and AUTH_LOCAL_JWT_PRIVATE_KEY_FILE (PEM encoded)
+func LocalJWTConfigFromEnv() (*LocalJWTConfig, error) {
+	cfg := LocalJWTConfig{
+		Issuer:     os.Getenv("AUTH_LOCAL_JWT_ISSUER"),
+		HMACSecret: []byte(os.Getenv("AUTH_LOCAL_JWT_SECRET")),
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = DefaultLocalJWTIssuer
+	}
+
+	if filename := os.Getenv("AUTH_LOCAL_JWT_PRIVATE_KEY_FILE"); filename != "" {
+		key, err := parseRSAPrivateKeyFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RSAPrivateKey = key
+		cfg.RSAPublicKey = &key.PublicKey
+	}
+
+	if filename := os.Getenv("AUTH_LOCAL_JWT_PUBLIC_KEY_FILE"); filename != "" {
+		key, err := parseRSAPublicKeyFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RSAPublicKey = key
+	}
+
+	if len(cfg.HMACSecret) == 0 && cfg.RSAPublicKey == nil {
+		return nil, ErrInvalidSignKeys
+	}
+
+	return &cfg, nil
+}
+
+// Sign signs claims with HS256 if HMAC secret is provided, otherwise with RS256
+func (c LocalJWTConfig) Sign(claims map[string]any) (string, error) {
+	alg := AlgHS256
+	if len(c.HMACSecret) == 0 {
+		if c.RSAPrivateKey == nil {
+			return "", ErrInvalidSignKeys
+		}
+		alg = AlgRS256
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("can not marshal claims: %v", err)
+	}
+
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, c.HMACSecret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case AlgRS256:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, c.RSAPrivateKey, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", fmt.Errorf("can not sign token: %v", err)
+		}
+	}
+
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+// MintLocalToken creates a token for local development, the identity is the subject of the token
+func (c LocalJWTConfig) MintLocalToken(authID, email, name string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := map[string]any{
+		"iss": c.Issuer,
+		"sub": authID,
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	}
+	if email != "" {
+		claims["email"] = email
+	}
+	if name != "" {
+		claims["name"] = name
+	}
+
+	return c.Sign(claims)
+}
+
+// LocalJWTVerifier verifies tokens signed by LocalJWTConfig, it works offline
+type LocalJWTVerifier struct {
+	Config LocalJWTConfig
+	now    func() time.Time
+}
+
+func NewLocalJWTVerifier(cfg LocalJWTConfig) *LocalJWTVerifier {
+	return &LocalJWTVerifier{Config: cfg, now: time.Now}
+}
+
+func (v LocalJWTVerifier) Verify(_ context.Context, token string) (*UserAuth, error) {
+	claims, err := v.verifyClaims(token)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+
+	return UserAuthFromClaims(sub, LocalProvider, claims)
+}
+
+func (v LocalJWTVerifier) verifyClaims(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	signingInput := parts[0] + "." + parts[1]
+
+	// only accept the algorithm of configured keys, prevent algorithm confusion
+	switch {
+	case header.Alg == AlgHS256 && len(v.Config.HMACSecret) > 0:
+		mac := hmac.New(sha256.New, v.Config.HMACSecret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+		}
+	case header.Alg == AlgRS256 && v.Config.RSAPublicKey != nil:
+		digest := sha256.Sum256([]byte(signingInput))
+		err := rsa.VerifyPKCS1v15(v.Config.RSAPublicKey, crypto.SHA256, digest[:], signature)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+		}
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing expiration", ErrInvalidToken)
+	}
+	if !v.now().Before(time.Unix(int64(exp), 0)) {
+		return nil, ErrTokenExpired
+	}
+	if iss, _ := claims["iss"].(string); v.Config.Issuer != "" && iss != v.Config.Issuer {
+		return nil, fmt.Errorf("%w: invalid issuer", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+func parseRSAPrivateKeyFile(filename string) (*rsa.PrivateKey, error) {
+	block, err := readPEMFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not RSA")
+	}
+
+	return rsaKey, nil
+}
+
+func parseRSAPublicKeyFile(filename string) (*rsa.PublicKey, error) {
+	block, err := readPEMFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse public key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not RSA")
+	}
+
+	return rsaKey, nil
+}
+
+func readPEMFile(filename string) (*pem.Block, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("can not read key file: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("can not decode PEM file %s", filename)
+	}
+
+	return block, nil
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	configs := map[string]LocalJWTConfig{
+		AlgHS256: {Issuer: DefaultLocalJWTIssuer, HMACSecret: []byte("secret")},
+		AlgRS256: {
+			Issuer:        DefaultLocalJWTIssuer,
+			RSAPrivateKey: rsaKey,
+			RSAPublicKey:  &rsaKey.PublicKey,
+		},
+	}
+
+	for alg, cfg := range configs {
+		t.Run(alg, func(t *testing.T) {
+			verifier := NewLocalJWTVerifier(cfg)
+
+			token, err := cfg.MintLocalToken("uid", "user@peakee.co", "User", time.Hour)
+			assert.Nil(t, err)
+
+			userAuth, err := verifier.Verify(context.Background(), token)
+			assert.Nil(t, err)
+			assert.Equal(t, "uid", userAuth.AuthID)
+			assert.Equal(t, "user@peakee.co", userAuth.Email)
+			assert.Equal(t, "User", userAuth.Name)
+			assert.Equal(t, LocalProvider, userAuth.Provider)
+			assert.False(t, userAuth.ExpiresAt.IsZero())
+
+			parts := strings.Split(token, ".")
+			tampered := parts[0] + "." + encodeSegment([]byte(`{"sub":"admin","exp":9999999999}`)) + "." + parts[2]
+			_, err = verifier.Verify(context.Background(), tampered)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+
+			expired, _ := cfg.MintLocalToken("uid", "", "", -time.Minute)
+			_, err = verifier.Verify(context.Background(), expired)
+			assert.ErrorIs(t, err, ErrTokenExpired)
+
+			otherIssuer := cfg
+			otherIssuer.Issuer = "other"
+			token, _ = otherIssuer.MintLocalToken("uid", "", "", time.Hour)
+			_, err = verifier.Verify(context.Background(), token)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+
+	// a HS256 token must not be accepted by a verifier configured with RSA keys only
+	token, _ := configs[AlgHS256].MintLocalToken("uid", "", "", time.Hour)
+	_, err = NewLocalJWTVerifier(configs[AlgRS256]).Verify(context.Background(), token)
+	assert.ErrorIs(t, err, ErrUnsupportedAlg)
+
+	_, err = NewLocalJWTVerifier(configs[AlgHS256]).Verify(context.Background(), "invalid")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
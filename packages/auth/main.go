@@ -2,35 +2,63 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"blinders/packages/apigateway"
+	"blinders/packages/dbutils"
 	"blinders/packages/lambda"
 	"blinders/packages/utils"
-	usersrepo "blinders/services/users/repo"
 
-	firebase "firebase.google.com/go"
-	"firebase.google.com/go/auth"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/gofiber/fiber/v2"
-	"google.golang.org/api/option"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type UserAuth struct {
 	Email  string
 	Name   string
 	AuthID string
+
+	// Provider is the sign in provider, e.g. password, google.com, apple.com, phone, anonymous
+	Provider      string
+	EmailVerified bool
+	Picture       string
+	Phone         string
+	ExpiresAt     time.Time
+
+	// Roles are granted by the roles custom claim of the token
+	Roles []Role
+}
+
+// IdentityVerifier verifies a token issued by an identity provider and extracts the identity
+type IdentityVerifier interface {
+	Verify(ctx context.Context, token string) (*UserAuth, error)
+}
+
+// IdentityDeleter is implemented by verifiers whose provider supports deleting identities
+type IdentityDeleter interface {
+	DeleteIdentity(ctx context.Context, authID string) error
 }
 
 type Manager struct {
-	App    *firebase.App
-	Client *auth.Client
+	Verifier IdentityVerifier
+
+	// Resolver is required by middlewares configured WithUser
+	Resolver UserResolver
 
-	// TODO: decouple auth and users repo
-	UsersRepo *usersrepo.UsersRepo
+	// Cache is optional, it skips verifying and resolving of recently verified tokens in middlewares
+	Cache *TokenCache
 }
 
+var (
+	ErrUserNotFound        = errors.New("user not found")
+	ErrResolverNotProvided = errors.New("user resolver is not provided")
+)
+
 type key string
 
 const (
@@ -39,32 +67,31 @@ const (
 	UserAuthKey key = "user_auth_key"
 )
 
-func NewFirebaseManager(adminConfig []byte, usersRepo *usersrepo.UsersRepo) (*Manager, error) {
-	manager := Manager{UsersRepo: usersRepo}
+const (
+	FirebaseProvider = "firebase"
+	LocalProvider    = "local"
+)
 
-	opt := option.WithCredentialsJSON(adminConfig)
-	newApp, err := firebase.NewApp(context.Background(), nil, opt)
-	if err != nil {
-		return nil, err
-	}
-	manager.App = newApp
+func NewManager(verifier IdentityVerifier, resolver UserResolver) *Manager {
+	return &Manager{Verifier: verifier, Resolver: resolver}
+}
 
-	newClient, err := manager.App.Auth(context.Background())
+func NewFirebaseManager(adminConfig []byte, resolver UserResolver) (*Manager, error) {
+	verifier, err := NewFirebaseVerifier(adminConfig)
 	if err != nil {
 		return nil, err
 	}
-	manager.Client = newClient
 
-	return &manager, nil
+	return NewManager(verifier, resolver), nil
 }
 
-func NewFirebaseManagerFromFile(filename string, usersRepo *usersrepo.UsersRepo) (*Manager, error) {
+func NewFirebaseManagerFromFile(filename string, resolver UserResolver) (*Manager, error) {
 	adminConfig, err := utils.GetFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("can not load firebase config file: %v", err)
 	}
 
-	m, err := NewFirebaseManager(adminConfig, usersRepo)
+	m, err := NewFirebaseManager(adminConfig, resolver)
 	if err != nil {
 		return nil, fmt.Errorf("can not init firebase manager: %v", err)
 	}
@@ -72,27 +99,126 @@ func NewFirebaseManagerFromFile(filename string, usersRepo *usersrepo.UsersRepo)
 	return m, nil
 }
 
-func (m Manager) Verify(jwt string) (*UserAuth, error) {
-	authToken, err := m.Client.VerifyIDToken(context.Background(), jwt)
-	if err != nil {
-		return nil, err
+// NewManagerFromEnv uses the local JWT verifier if AUTH_PROVIDER is "local",
+// otherwise the firebase verifier with the admin config file, revoked tokens are checked
+// if AUTH_CHECK_REVOKED is "true"
+func NewManagerFromEnv(firebaseFile string, resolver UserResolver) (*Manager, error) {
+	switch provider := os.Getenv("AUTH_PROVIDER"); provider {
+	case LocalProvider:
+		cfg, err := LocalJWTConfigFromEnv()
+		if err != nil {
+			return nil, fmt.Errorf("can not load local jwt config: %v", err)
+		}
+		return NewManager(NewLocalJWTVerifier(*cfg), resolver), nil
+	case FirebaseProvider, "":
+		m, err := NewFirebaseManagerFromFile(firebaseFile, resolver)
+		if err != nil {
+			return nil, err
+		}
+		m.Verifier.(*FirebaseVerifier).CheckRevoked = os.Getenv("AUTH_CHECK_REVOKED") == "true"
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown auth provider: %s", provider)
+	}
+}
+
+func (m Manager) Verify(ctx context.Context, jwt string) (*UserAuth, error) {
+	return m.Verifier.Verify(ctx, jwt)
+}
+
+func (m Manager) ResolveUser(ctx context.Context, authID string) (*User, error) {
+	if m.Resolver == nil {
+		return nil, ErrResolverNotProvided
+	}
+
+	return m.Resolver.ResolveUser(ctx, authID)
+}
+
+// DeleteIdentity deletes the user from the identity provider, used when the user deletes the account.
+// It does nothing if the provider does not support deleting identities
+func (m Manager) DeleteIdentity(ctx context.Context, authID string) error {
+	deleter, ok := m.Verifier.(IdentityDeleter)
+	if !ok {
+		return nil
+	}
+
+	return deleter.DeleteIdentity(ctx, authID)
+}
+
+// InvalidateIdentity drops cached tokens and the cached user of the identity, so a deleted user
+// or changed roles take effect on the next request of this instance (and of others if the cache is shared)
+func (m Manager) InvalidateIdentity(ctx context.Context, authID string) error {
+	if resolver, ok := m.Resolver.(*CachedUserResolver); ok {
+		resolver.Invalidate(authID)
+	}
+	if m.Cache == nil {
+		return nil
 	}
 
-	firebaseUID := authToken.UID
-	email := authToken.Claims["email"].(string)
-	name := authToken.Claims["name"].(string)
+	return m.Cache.Evict(ctx, authID)
+}
 
-	userAuth := UserAuth{
-		Email:  email,
-		Name:   name,
-		AuthID: firebaseUID,
+// InvalidateUser drops cached tokens and the cached user resolved to the user, like InvalidateIdentity
+// when only the ID of the user is known
+func (m Manager) InvalidateUser(ctx context.Context, userID primitive.ObjectID) error {
+	if resolver, ok := m.Resolver.(*CachedUserResolver); ok {
+		resolver.InvalidateUserID(userID)
+	}
+	if m.Cache == nil {
+		return nil
 	}
 
-	return &userAuth, nil
+	return m.Cache.EvictUser(ctx, userID)
 }
 
 type Config struct {
 	WithUser bool
+
+	// Roles requires the identity to have any of the roles, granted by the token claims
+	// or by the user if WithUser is enabled
+	Roles []Role
+}
+
+// Authorize checks if the identity (and the user if resolved) has any of required roles of the config
+func (c Config) Authorize(userAuth *UserAuth, user *User) error {
+	granted := userAuth.Roles
+	if user != nil {
+		granted = MergeRoles(granted, user.Roles)
+	}
+	if !HasAnyRole(granted, c.Roles...) {
+		return ErrInsufficientRole
+	}
+
+	return nil
+}
+
+// authenticate verifies the token and resolves the user if withUser, using the cache if provided.
+// Returned errors are safe to respond to clients
+func (m Manager) authenticate(ctx context.Context, jwt string, withUser bool) (*UserAuth, *User, error) {
+	if m.Cache != nil {
+		if identity, ok := m.Cache.Get(ctx, jwt, withUser); ok {
+			return identity.UserAuth, identity.User, nil
+		}
+	}
+
+	userAuth, err := m.Verify(ctx, jwt)
+	if err != nil {
+		return nil, nil, errors.New(VerifyErrorMessage(err))
+	}
+
+	var user *User
+	if withUser {
+		user, err = m.ResolveUser(ctx, userAuth.AuthID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if m.Cache != nil {
+		m.Cache.Set(ctx, jwt, CachedIdentity{UserAuth: userAuth, User: user})
+	}
+
+	return userAuth, user, nil
 }
 
 func (m Manager) FiberAuthMiddleware(cfg ...Config) fiber.Handler {
@@ -107,21 +233,23 @@ func (m Manager) FiberAuthMiddleware(cfg ...Config) fiber.Handler {
 		}
 
 		jwt := strings.Split(auth, " ")[1]
-		userAuth, err := m.Verify(jwt)
+		withUser := len(cfg) > 0 && cfg[0].WithUser
+		userAuth, user, err := m.authenticate(ctx.UserContext(), jwt, withUser)
 		if err != nil {
 			return ctx.Status(fiber.StatusUnauthorized).SendString(err.Error())
 		}
 
 		ctx.Locals(UserAuthKey, userAuth)
-
-		if len(cfg) > 0 && cfg[0].WithUser {
-			user, err := m.UsersRepo.GetUserByFirebaseUID(userAuth.AuthID)
-			if err != nil {
-				return ctx.Status(fiber.StatusUnauthorized).SendString(err.Error())
-			}
-
+		if withUser {
 			ctx.Locals(UserKey, user)
 			ctx.Locals(UserIDKey, user.ID)
+			ctx.SetUserContext(dbutils.WithActor(ctx.UserContext(), user.ID))
+		}
+
+		if len(cfg) > 0 {
+			if err := cfg[0].Authorize(userAuth, user); err != nil {
+				return ctx.Status(fiber.StatusForbidden).SendString(err.Error())
+			}
 		}
 
 		return ctx.Next()
@@ -140,21 +268,23 @@ func (m Manager) LambdaAuthMiddleware(cfg ...Config) lambda.Middleware {
 			}
 
 			jwt := strings.Split(auth, " ")[1]
-			userAuth, err := m.Verify(jwt)
+			withUser := len(cfg) > 0 && cfg[0].WithUser
+			userAuth, user, err := m.authenticate(ctx, jwt, withUser)
 			if err != nil {
-				return apigateway.UnauthorizedResponse("can not verify JWT"), nil
+				return apigateway.UnauthorizedResponse(err.Error()), nil
 			}
 
 			ctx = context.WithValue(ctx, UserAuthKey, userAuth)
-
-			if len(cfg) > 0 && cfg[0].WithUser {
-				user, err := m.UsersRepo.GetUserByFirebaseUID(userAuth.AuthID)
-				if err != nil {
-					return apigateway.UnauthorizedResponse(err.Error()), nil
-				}
-
+			if withUser {
 				ctx = context.WithValue(ctx, UserKey, user)
 				ctx = context.WithValue(ctx, UserIDKey, user.ID)
+				ctx = dbutils.WithActor(ctx, user.ID)
+			}
+
+			if len(cfg) > 0 {
+				if err := cfg[0].Authorize(userAuth, user); err != nil {
+					return apigateway.ForbiddenResponse(err.Error()), nil
+				}
 			}
 
 			return next(ctx, event)
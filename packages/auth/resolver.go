@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// User is the application user that an identity belongs to
+type User struct {
+	ID    primitive.ObjectID `json:"id"`
+	Roles []Role             `json:"roles,omitempty"`
+}
+
+// UserResolver maps an identity (AuthID of UserAuth) to an application user
+type UserResolver interface {
+	ResolveUser(ctx context.Context, authID string) (*User, error)
+}
+
+type cachedUser struct {
+	user      *User
+	expiredAt time.Time
+}
+
+// CachedUserResolver caches resolved users in memory for a TTL,
+// when the cache is full, expired entries are removed first, then the oldest one
+type CachedUserResolver struct {
+	Resolver UserResolver
+	TTL      time.Duration
+	MaxSize  int
+
+	mu    sync.Mutex
+	users map[string]cachedUser
+	now   func() time.Time
+}
+
+func NewCachedUserResolver(resolver UserResolver, ttl time.Duration, maxSize int) *CachedUserResolver {
+	return &CachedUserResolver{
+		Resolver: resolver,
+		TTL:      ttl,
+		MaxSize:  maxSize,
+		users:    make(map[string]cachedUser),
+		now:      time.Now,
+	}
+}
+
+func (r *CachedUserResolver) ResolveUser(ctx context.Context, authID string) (*User, error) {
+	r.mu.Lock()
+	cached, ok := r.users[authID]
+	r.mu.Unlock()
+	if ok && r.now().Before(cached.expiredAt) {
+		return cached.user, nil
+	}
+
+	user, err := r.Resolver.ResolveUser(ctx, authID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, existed := r.users[authID]; !existed && len(r.users) >= r.MaxSize {
+		r.evict()
+	}
+	r.users[authID] = cachedUser{user: user, expiredAt: r.now().Add(r.TTL)}
+
+	return user, nil
+}
+
+// Invalidate removes the cached user of the identity, e.g. when the user is deleted
+func (r *CachedUserResolver) Invalidate(authID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.users, authID)
+}
+
+// InvalidateUserID removes the cached user by its ID, e.g. on changes of the user document
+// which only have the ID of the user
+func (r *CachedUserResolver) InvalidateUserID(userID primitive.ObjectID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for authID, cached := range r.users {
+		if cached.user != nil && cached.user.ID == userID {
+			delete(r.users, authID)
+		}
+	}
+}
+
+func (r *CachedUserResolver) evict() {
+	now := r.now()
+	var (
+		oldestID string
+		oldestAt time.Time
+	)
+	for id, cached := range r.users {
+		if !now.Before(cached.expiredAt) {
+			delete(r.users, id)
+			continue
+		}
+		if oldestID == "" || cached.expiredAt.Before(oldestAt) {
+			oldestID, oldestAt = id, cached.expiredAt
+		}
+	}
+
+	if len(r.users) >= r.MaxSize && oldestID != "" {
+		delete(r.users, oldestID)
+	}
+}
+
+// MemoryUserResolver resolves users from a static map, useful for tests and local tools
+type MemoryUserResolver map[string]*User
+
+func (r MemoryUserResolver) ResolveUser(_ context.Context, authID string) (*User, error) {
+	user, ok := r[authID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+}
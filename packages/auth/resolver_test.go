@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type countingResolver struct {
+	MemoryUserResolver
+	calls int
+}
+
+func (r *countingResolver) ResolveUser(ctx context.Context, authID string) (*User, error) {
+	r.calls++
+	return r.MemoryUserResolver.ResolveUser(ctx, authID)
+}
+
+func TestCachedUserResolver(t *testing.T) {
+	inner := &countingResolver{MemoryUserResolver: MemoryUserResolver{
+		"uid-1": {ID: primitive.NewObjectID()},
+		"uid-2": {ID: primitive.NewObjectID()},
+	}}
+	now := time.Now()
+	resolver := NewCachedUserResolver(inner, time.Minute, 1)
+	resolver.now = func() time.Time { return now }
+
+	user, err := resolver.ResolveUser(context.Background(), "uid-1")
+	assert.Nil(t, err)
+	assert.Equal(t, inner.MemoryUserResolver["uid-1"], user)
+	_, _ = resolver.ResolveUser(context.Background(), "uid-1")
+	assert.Equal(t, 1, inner.calls)
+
+	// expired
+	now = now.Add(time.Minute)
+	_, _ = resolver.ResolveUser(context.Background(), "uid-1")
+	assert.Equal(t, 2, inner.calls)
+
+	// evicted by max size
+	_, _ = resolver.ResolveUser(context.Background(), "uid-2")
+	_, _ = resolver.ResolveUser(context.Background(), "uid-1")
+	assert.Equal(t, 4, inner.calls)
+
+	_, err = resolver.ResolveUser(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// RolesClaim is the custom claim that holds roles of the identity, e.g. firebase custom claims
+const RolesClaim = "roles"
+
+var (
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrInsufficientRole = errors.New("insufficient permissions")
+)
+
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if !role.IsValid() {
+		return "", ErrInvalidRole
+	}
+	return role, nil
+}
+
+// HasAnyRole reports if granted roles satisfy any of required roles, admin satisfies all roles.
+// Every authenticated identity has the user role implicitly
+func HasAnyRole(granted []Role, required ...Role) bool {
+	if len(required) == 0 || slices.Contains(granted, RoleAdmin) {
+		return true
+	}
+	for _, role := range required {
+		if role == RoleUser || slices.Contains(granted, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeRoles returns the union of roles, keeping the order of appearance
+func MergeRoles(roles ...[]Role) []Role {
+	var merged []Role
+	for _, rs := range roles {
+		for _, role := range rs {
+			if !slices.Contains(merged, role) {
+				merged = append(merged, role)
+			}
+		}
+	}
+	return merged
+}
+
+// rolesClaim extracts valid roles of the custom claim, unknown roles are ignored
+func rolesClaim(claims map[string]any) []Role {
+	values, _ := claims[RolesClaim].([]any)
+	var roles []Role
+	for _, value := range values {
+		s, _ := value.(string)
+		if role := Role(s); role.IsValid() {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// RequireRoles authorizes roles of the request, it must be used after FiberAuthMiddleware.
+// It is useful to protect a single route of a group that is authenticated by a broader config
+func RequireRoles(roles ...Role) fiber.Handler {
+	cfg := Config{Roles: roles}
+	return func(ctx *fiber.Ctx) error {
+		userAuth, ok := ctx.Locals(UserAuthKey).(*UserAuth)
+		if !ok {
+			return ctx.Status(fiber.StatusUnauthorized).SendString("missing user auth")
+		}
+		user, _ := ctx.Locals(UserKey).(*User)
+
+		if err := cfg.Authorize(userAuth, user); err != nil {
+			return ctx.Status(fiber.StatusForbidden).SendString(err.Error())
+		}
+
+		return ctx.Next()
+	}
+}
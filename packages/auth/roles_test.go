@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHasAnyRole(t *testing.T) {
+	assert.True(t, HasAnyRole(nil))
+	assert.True(t, HasAnyRole(nil, RoleUser))
+	assert.False(t, HasAnyRole(nil, RoleModerator))
+	assert.False(t, HasAnyRole([]Role{RoleModerator}, RoleAdmin))
+	assert.True(t, HasAnyRole([]Role{RoleModerator}, RoleModerator, RoleAdmin))
+	assert.True(t, HasAnyRole([]Role{RoleAdmin}, RoleModerator))
+}
+
+func TestRolesClaim(t *testing.T) {
+	userAuth, err := UserAuthFromClaims("uid", LocalProvider, map[string]any{
+		RolesClaim: []any{"admin", "unknown", 1},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []Role{RoleAdmin}, userAuth.Roles)
+}
+
+func TestFiberAuthMiddlewareRoles(t *testing.T) {
+	cfg := LocalJWTConfig{Issuer: DefaultLocalJWTIssuer, HMACSecret: []byte("secret")}
+	moderator := &User{ID: primitive.NewObjectID(), Roles: []Role{RoleModerator}}
+	manager := NewManager(NewLocalJWTVerifier(cfg), MemoryUserResolver{
+		"user":      {ID: primitive.NewObjectID()},
+		"moderator": moderator,
+	})
+
+	app := fiber.New()
+	app.Get("/moderation", manager.FiberAuthMiddleware(Config{
+		WithUser: true,
+		Roles:    []Role{RoleModerator},
+	}), func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+	app.Get("/admin", manager.FiberAuthMiddleware(), RequireRoles(RoleAdmin), func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+
+	request := func(path string, claims map[string]any) int {
+		claims["iss"] = cfg.Issuer
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token, err := cfg.Sign(claims)
+		assert.Nil(t, err)
+
+		req := httptest.NewRequest("GET", path, nil).WithContext(context.Background())
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := app.Test(req)
+		assert.Nil(t, err)
+		return res.StatusCode
+	}
+
+	assert.Equal(t, fiber.StatusForbidden, request("/moderation", map[string]any{"sub": "user"}))
+	assert.Equal(t, fiber.StatusOK, request("/moderation", map[string]any{"sub": "moderator"}))
+	assert.Equal(t, fiber.StatusOK, request("/moderation", map[string]any{
+		"sub":      "user",
+		RolesClaim: []string{"admin"},
+	}))
+	assert.Equal(t, fiber.StatusForbidden, request("/admin", map[string]any{"sub": "moderator"}))
+	assert.Equal(t, fiber.StatusOK, request("/admin", map[string]any{
+		"sub":      "moderator",
+		RolesClaim: []string{"admin"},
+	}))
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CachedIdentity is the verified identity of a token, User is only set if the token was resolved WithUser
+type CachedIdentity struct {
+	UserAuth *UserAuth `json:"userAuth"`
+	User     *User     `json:"user,omitempty"`
+}
+
+// TokenCacheStore stores verified identities by token hash, the TTL of entries must be respected.
+// DeleteByAuthID deletes entries of all tokens of the identity, DeleteByUserID those resolved to the user
+type TokenCacheStore interface {
+	Get(ctx context.Context, key string) (*CachedIdentity, bool, error)
+	Set(ctx context.Context, key string, identity CachedIdentity, ttl time.Duration) error
+	DeleteByAuthID(ctx context.Context, authID string) error
+	DeleteByUserID(ctx context.Context, userID primitive.ObjectID) error
+}
+
+type TokenCacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Errors    int64 `json:"errors"`
+	Evictions int64 `json:"evictions"`
+}
+
+// TokenCache caches verified tokens to skip verification and user resolving on hot paths,
+// an entry never outlives the token it was verified from
+type TokenCache struct {
+	Store TokenCacheStore
+	TTL   time.Duration
+
+	hits   atomic.Int64
+	misses atomic.Int64
+	errors atomic.Int64
+	now    func() time.Time
+}
+
+func NewTokenCache(store TokenCacheStore, ttl time.Duration) *TokenCache {
+	return &TokenCache{Store: store, TTL: ttl, now: time.Now}
+}
+
+// TokenCacheKey hashes the token, raw tokens are never stored
+func TokenCacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the cached identity, with withUser it is only a hit if the user was resolved
+func (c *TokenCache) Get(ctx context.Context, token string, withUser bool) (*CachedIdentity, bool) {
+	identity, ok, err := c.Store.Get(ctx, TokenCacheKey(token))
+	if err != nil {
+		c.errors.Add(1)
+	}
+	if !ok || identity.UserAuth == nil || (withUser && identity.User == nil) ||
+		!c.beforeExpiration(identity.UserAuth) {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	return identity, true
+}
+
+func (c *TokenCache) Set(ctx context.Context, token string, identity CachedIdentity) {
+	ttl := c.TTL
+	if expiresAt := identity.UserAuth.ExpiresAt; !expiresAt.IsZero() {
+		ttl = min(ttl, expiresAt.Sub(c.now()))
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	if err := c.Store.Set(ctx, TokenCacheKey(token), identity, ttl); err != nil {
+		c.errors.Add(1)
+	}
+}
+
+// Evict removes cached tokens of the identity, e.g. when the user is deleted or the roles of the user change
+func (c *TokenCache) Evict(ctx context.Context, authID string) error {
+	return c.Store.DeleteByAuthID(ctx, authID)
+}
+
+// EvictUser removes cached tokens resolved to the user, e.g. on changes of the user document
+// which only have the ID of the user
+func (c *TokenCache) EvictUser(ctx context.Context, userID primitive.ObjectID) error {
+	return c.Store.DeleteByUserID(ctx, userID)
+}
+
+func (c *TokenCache) Stats() TokenCacheStats {
+	stats := TokenCacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Errors: c.errors.Load(),
+	}
+	if store, ok := c.Store.(interface{ Evictions() int64 }); ok {
+		stats.Evictions = store.Evictions()
+	}
+
+	return stats
+}
+
+func (c *TokenCache) beforeExpiration(userAuth *UserAuth) bool {
+	return userAuth.ExpiresAt.IsZero() || c.now().Before(userAuth.ExpiresAt)
+}
+
+type cachedIdentity struct {
+	identity  CachedIdentity
+	expiredAt time.Time
+}
+
+// MemoryTokenStore is a bounded in-memory store, when it is full, expired entries
+// are removed first, then the one expiring soonest
+type MemoryTokenStore struct {
+	MaxSize int
+
+	mu         sync.Mutex
+	identities map[string]cachedIdentity
+	evictions  atomic.Int64
+	now        func() time.Time
+}
+
+func NewMemoryTokenStore(maxSize int) *MemoryTokenStore {
+	return &MemoryTokenStore{
+		MaxSize:    maxSize,
+		identities: make(map[string]cachedIdentity),
+		now:        time.Now,
+	}
+}
+
+func (s *MemoryTokenStore) Get(_ context.Context, key string) (*CachedIdentity, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cached, ok := s.identities[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !s.now().Before(cached.expiredAt) {
+		delete(s.identities, key)
+		return nil, false, nil
+	}
+
+	return &cached.identity, true, nil
+}
+
+func (s *MemoryTokenStore) Set(_ context.Context, key string, identity CachedIdentity, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, existed := s.identities[key]; !existed && len(s.identities) >= s.MaxSize {
+		s.evict()
+	}
+	s.identities[key] = cachedIdentity{identity: identity, expiredAt: s.now().Add(ttl)}
+
+	return nil
+}
+
+func (s *MemoryTokenStore) DeleteByAuthID(_ context.Context, authID string) error {
+	s.deleteMatching(func(identity CachedIdentity) bool {
+		return identity.UserAuth != nil && identity.UserAuth.AuthID == authID
+	})
+	return nil
+}
+
+func (s *MemoryTokenStore) DeleteByUserID(_ context.Context, userID primitive.ObjectID) error {
+	s.deleteMatching(func(identity CachedIdentity) bool {
+		return identity.User != nil && identity.User.ID == userID
+	})
+	return nil
+}
+
+func (s *MemoryTokenStore) deleteMatching(match func(identity CachedIdentity) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, cached := range s.identities {
+		if match(cached.identity) {
+			delete(s.identities, key)
+		}
+	}
+}
+
+func (s *MemoryTokenStore) Evictions() int64 {
+	return s.evictions.Load()
+}
+
+func (s *MemoryTokenStore) evict() {
+	now := s.now()
+	var (
+		soonestKey string
+		soonestAt  time.Time
+	)
+	for key, cached := range s.identities {
+		if !now.Before(cached.expiredAt) {
+			delete(s.identities, key)
+			s.evictions.Add(1)
+			continue
+		}
+		if soonestKey == "" || cached.expiredAt.Before(soonestAt) {
+			soonestKey, soonestAt = key, cached.expiredAt
+		}
+	}
+
+	if len(s.identities) >= s.MaxSize && soonestKey != "" {
+		delete(s.identities, soonestKey)
+		s.evictions.Add(1)
+	}
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RedisTokenStore shares verified tokens between instances, e.g. lambdas.
+// Keys of tokens of an identity (and of a resolved user) are indexed in sets under IndexPrefix,
+// to delete them together
+type RedisTokenStore struct {
+	Client      *redis.Client
+	Prefix      string
+	IndexPrefix string
+}
+
+func NewRedisTokenStore(client *redis.Client) *RedisTokenStore {
+	return &RedisTokenStore{Client: client, Prefix: "auth:token:", IndexPrefix: "auth:tokens-of:"}
+}
+
+func (s RedisTokenStore) authIDIndex(authID string) string {
+	return s.IndexPrefix + authID
+}
+
+func (s RedisTokenStore) userIDIndex(userID primitive.ObjectID) string {
+	return s.IndexPrefix + "user:" + userID.Hex()
+}
+
+func (s RedisTokenStore) Get(ctx context.Context, key string) (*CachedIdentity, bool, error) {
+	value, err := s.Client.Get(ctx, s.Prefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var identity CachedIdentity
+	if err := json.Unmarshal(value, &identity); err != nil {
+		return nil, false, err
+	}
+
+	return &identity, true, nil
+}
+
+func (s RedisTokenStore) Set(ctx context.Context, key string, identity CachedIdentity, ttl time.Duration) error {
+	value, err := json.Marshal(identity)
+	if err != nil {
+		return err
+	}
+
+	indexes := []string{s.authIDIndex(identity.UserAuth.AuthID)}
+	if identity.User != nil {
+		indexes = append(indexes, s.userIDIndex(identity.User.ID))
+	}
+	_, err = s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.Prefix+key, value, ttl)
+		for _, index := range indexes {
+			pipe.SAdd(ctx, index, key)
+			// the index lives as long as its longest entry
+			pipe.ExpireNX(ctx, index, ttl)
+			pipe.ExpireGT(ctx, index, ttl)
+		}
+		return nil
+	})
+
+	return err
+}
+
+func (s RedisTokenStore) DeleteByAuthID(ctx context.Context, authID string) error {
+	return s.deleteIndexed(ctx, s.authIDIndex(authID))
+}
+
+func (s RedisTokenStore) DeleteByUserID(ctx context.Context, userID primitive.ObjectID) error {
+	return s.deleteIndexed(ctx, s.userIDIndex(userID))
+}
+
+func (s RedisTokenStore) deleteIndexed(ctx context.Context, index string) error {
+	keys, err := s.Client.SMembers(ctx, index).Result()
+	if err != nil {
+		return err
+	}
+
+	deleted := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		deleted = append(deleted, s.Prefix+key)
+	}
+	deleted = append(deleted, index)
+
+	return s.Client.Del(ctx, deleted...).Err()
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type countingVerifier struct {
+	IdentityVerifier
+	calls int
+}
+
+func (v *countingVerifier) Verify(ctx context.Context, token string) (*UserAuth, error) {
+	v.calls++
+	return v.IdentityVerifier.Verify(ctx, token)
+}
+
+func TestTokenCache(t *testing.T) {
+	cfg := LocalJWTConfig{Issuer: DefaultLocalJWTIssuer, HMACSecret: []byte("secret")}
+	verifier := &countingVerifier{IdentityVerifier: NewLocalJWTVerifier(cfg)}
+	user := &User{ID: primitive.NewObjectID()}
+	cache := NewTokenCache(NewMemoryTokenStore(10), time.Hour)
+	manager := NewManager(verifier, MemoryUserResolver{"uid": user})
+	manager.Cache = cache
+
+	token, _ := cfg.MintLocalToken("uid", "", "", time.Minute)
+
+	// identity without user does not satisfy a request with user
+	_, _, err := manager.authenticate(context.Background(), token, false)
+	assert.Nil(t, err)
+	_, resolved, err := manager.authenticate(context.Background(), token, true)
+	assert.Nil(t, err)
+	assert.Equal(t, user, resolved)
+	_, resolved, err = manager.authenticate(context.Background(), token, true)
+	assert.Nil(t, err)
+	assert.Equal(t, user, resolved)
+	assert.Equal(t, 2, verifier.calls)
+	assert.Equal(t, TokenCacheStats{Hits: 1, Misses: 2}, cache.Stats())
+
+	// entries expire with the token even if the TTL of the cache is longer
+	cache.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, ok := cache.Get(context.Background(), token, true)
+	assert.False(t, ok)
+
+	_, _, err = manager.authenticate(context.Background(), "invalid", false)
+	assert.Equal(t, "can not verify jwt", err.Error())
+}
+
+func TestMemoryTokenStoreEviction(t *testing.T) {
+	store := NewMemoryTokenStore(2)
+	identity := CachedIdentity{UserAuth: &UserAuth{AuthID: "uid"}}
+	ctx := context.Background()
+
+	_ = store.Set(ctx, "a", identity, time.Minute)
+	_ = store.Set(ctx, "b", identity, time.Hour)
+	_ = store.Set(ctx, "c", identity, time.Hour)
+
+	_, ok, _ := store.Get(ctx, "a")
+	assert.False(t, ok)
+	_, ok, _ = store.Get(ctx, "c")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), store.Evictions())
+}
+
+func TestInvalidateIdentity(t *testing.T) {
+	cfg := LocalJWTConfig{Issuer: DefaultLocalJWTIssuer, HMACSecret: []byte("secret")}
+	users := MemoryUserResolver{
+		"uid":   {ID: primitive.NewObjectID(), Roles: []Role{RoleAdmin}},
+		"other": {ID: primitive.NewObjectID()},
+	}
+	manager := NewManager(NewLocalJWTVerifier(cfg), NewCachedUserResolver(users, time.Hour, 10))
+	manager.Cache = NewTokenCache(NewMemoryTokenStore(10), time.Hour)
+	ctx := context.Background()
+
+	token, _ := cfg.MintLocalToken("uid", "", "", time.Minute)
+	otherToken, _ := cfg.MintLocalToken("other", "", "", time.Minute)
+	_, _, err := manager.authenticate(ctx, token, true)
+	assert.Nil(t, err)
+	_, _, err = manager.authenticate(ctx, otherToken, true)
+	assert.Nil(t, err)
+
+	// the admin role is revoked, cached tokens and users of the identity are dropped
+	users["uid"] = &User{ID: users["uid"].ID}
+	assert.Nil(t, manager.InvalidateIdentity(ctx, "uid"))
+
+	_, ok := manager.Cache.Get(ctx, token, true)
+	assert.False(t, ok)
+	_, ok = manager.Cache.Get(ctx, otherToken, true)
+	assert.True(t, ok)
+
+	_, user, err := manager.authenticate(ctx, token, true)
+	assert.Nil(t, err)
+	assert.Empty(t, user.Roles)
+}
+
+func TestInvalidateUser(t *testing.T) {
+	cfg := LocalJWTConfig{Issuer: DefaultLocalJWTIssuer, HMACSecret: []byte("secret")}
+	users := MemoryUserResolver{
+		"uid":   {ID: primitive.NewObjectID()},
+		"other": {ID: primitive.NewObjectID()},
+	}
+	manager := NewManager(NewLocalJWTVerifier(cfg), NewCachedUserResolver(users, time.Hour, 10))
+	manager.Cache = NewTokenCache(NewMemoryTokenStore(10), time.Hour)
+	ctx := context.Background()
+
+	token, _ := cfg.MintLocalToken("uid", "", "", time.Minute)
+	otherToken, _ := cfg.MintLocalToken("other", "", "", time.Minute)
+	_, _, err := manager.authenticate(ctx, token, true)
+	assert.Nil(t, err)
+	_, _, err = manager.authenticate(ctx, otherToken, true)
+	assert.Nil(t, err)
+
+	// the user is deleted, only its ID is known
+	userID := users["uid"].ID
+	delete(users, "uid")
+	assert.Nil(t, manager.InvalidateUser(ctx, userID))
+
+	_, ok := manager.Cache.Get(ctx, token, true)
+	assert.False(t, ok)
+	_, ok = manager.Cache.Get(ctx, otherToken, true)
+	assert.True(t, ok)
+
+	_, _, err = manager.authenticate(ctx, token, true)
+	assert.NotNil(t, err)
+}
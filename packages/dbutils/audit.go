@@ -0,0 +1,61 @@
+package dbutils
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type actorKey struct{}
+
+// WithActor attaches the user making the request to the context,
+// repos use it to fill createdBy, updatedBy and deletedBy
+func WithActor(ctx context.Context, userID primitive.ObjectID) context.Context {
+	return context.WithValue(ctx, actorKey{}, userID)
+}
+
+func ActorFromContext(ctx context.Context) (primitive.ObjectID, bool) {
+	if ctx == nil {
+		return primitive.NilObjectID, false
+	}
+	userID, ok := ctx.Value(actorKey{}).(primitive.ObjectID)
+	return userID, ok && !userID.IsZero()
+}
+
+// NotDeleted adds the condition excluding soft deleted documents to a copy of the filter
+func NotDeleted(filter bson.M) bson.M {
+	scoped := bson.M{"deletedAt": bson.M{"$exists": false}}
+	for key, value := range filter {
+		scoped[key] = value
+	}
+	return scoped
+}
+
+// Touched adds updatedAt and updatedBy (if the context has an actor) to $set fields of an update
+func Touched(ctx context.Context, set bson.M) bson.M {
+	set["updatedAt"] = primitive.NewDateTimeFromTime(time.Now())
+	if actor, ok := ActorFromContext(ctx); ok {
+		set["updatedBy"] = actor
+	}
+	return set
+}
+
+// SoftDeleteUpdate marks documents as deleted by the actor of the context
+func SoftDeleteUpdate(ctx context.Context) bson.M {
+	set := Touched(ctx, bson.M{})
+	set["deletedAt"] = set["updatedAt"]
+	if actor, ok := set["updatedBy"]; ok {
+		set["deletedBy"] = actor
+	}
+	return bson.M{"$set": set}
+}
+
+// RestoreUpdate reverts SoftDeleteUpdate
+func RestoreUpdate(ctx context.Context) bson.M {
+	return bson.M{
+		"$set":   Touched(ctx, bson.M{}),
+		"$unset": bson.M{"deletedAt": "", "deletedBy": ""},
+	}
+}
@@ -0,0 +1,236 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ResumeTokensCollection stores the latest handled position of each change bus,
+// so a restarted worker continues from where it stopped
+const ResumeTokensCollection = "_resume_tokens"
+
+// ChangeBusRetryDelay is the delay before watching again when the change stream fails
+var ChangeBusRetryDelay = time.Second * 5
+
+type OperationType string
+
+const (
+	InsertOperation  OperationType = "insert"
+	UpdateOperation  OperationType = "update"
+	ReplaceOperation OperationType = "replace"
+	DeleteOperation  OperationType = "delete"
+)
+
+// ChangeEvent is a change of a document decoded to the model of its collection
+type ChangeEvent[M any] struct {
+	Operation  OperationType
+	Collection string
+	DocumentID primitive.ObjectID
+	// Document is the current document, it is nil on delete or if the document is already deleted
+	Document *M
+	// UpdatedFields and RemovedFields are only set on update
+	UpdatedFields bson.M
+	RemovedFields []string
+	ClusterTime   time.Time
+}
+
+// rawChangeEvent is the change stream event, see https://www.mongodb.com/docs/manual/reference/change-events/
+type rawChangeEvent struct {
+	OperationType OperationType `bson:"operationType"`
+	Namespace     struct {
+		Collection string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument      bson.Raw `bson:"fullDocument,omitempty"`
+	UpdateDescription struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+	ClusterTime primitive.Timestamp `bson:"clusterTime"`
+}
+
+type changeHandler func(ctx context.Context, event rawChangeEvent) error
+
+// decodeChangeEvent decodes the full document of the raw event to the model
+func decodeChangeEvent[M any](raw rawChangeEvent) (ChangeEvent[M], error) {
+	event := ChangeEvent[M]{
+		Operation:     raw.OperationType,
+		Collection:    raw.Namespace.Collection,
+		DocumentID:    raw.DocumentKey.ID,
+		UpdatedFields: raw.UpdateDescription.UpdatedFields,
+		RemovedFields: raw.UpdateDescription.RemovedFields,
+		ClusterTime:   time.Unix(int64(raw.ClusterTime.T), 0),
+	}
+
+	if len(raw.FullDocument) > 0 {
+		event.Document = new(M)
+		if err := bson.Unmarshal(raw.FullDocument, event.Document); err != nil {
+			return event, err
+		}
+	}
+
+	return event, nil
+}
+
+// ChangeBus watches changes of the database and dispatches them to handlers registered per collection
+type ChangeBus struct {
+	// Name identifies the resume token of the bus, buses with different names handle changes independently
+	Name string
+
+	db       *mongo.Database
+	tokens   *mongo.Collection
+	handlers map[string][]changeHandler
+}
+
+func NewChangeBus(db *mongo.Database, name string) *ChangeBus {
+	return &ChangeBus{
+		Name:     name,
+		db:       db,
+		tokens:   db.Collection(ResumeTokensCollection),
+		handlers: make(map[string][]changeHandler),
+	}
+}
+
+// Subscribe registers a handler of changes of the collection, documents are decoded to M.
+// Handlers of a bus run one by one in order of changes, a failed handler is logged and does not stop the bus
+func Subscribe[M any](
+	bus *ChangeBus,
+	collection string,
+	handler func(ctx context.Context, event ChangeEvent[M]) error,
+) {
+	bus.handlers[collection] = append(bus.handlers[collection], func(ctx context.Context, raw rawChangeEvent) error {
+		event, err := decodeChangeEvent[M](raw)
+		if err != nil {
+			return fmt.Errorf("can not decode change of %s: %v", collection, err)
+		}
+		return handler(ctx, event)
+	})
+}
+
+// Run watches changes until the context is done, the stream is watched again after failures
+func (b *ChangeBus) Run(ctx context.Context) {
+	for {
+		err := b.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("change bus %s stopped: %v, watching again in %v\n", b.Name, err, ChangeBusRetryDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ChangeBusRetryDelay):
+		}
+	}
+}
+
+func (b *ChangeBus) watch(ctx context.Context) error {
+	collections := make([]string, 0, len(b.handlers))
+	for collection := range b.handlers {
+		collections = append(collections, collection)
+	}
+	if len(collections) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"ns.coll": bson.M{"$in": collections},
+		"operationType": bson.M{"$in": []OperationType{
+			InsertOperation, UpdateOperation, ReplaceOperation, DeleteOperation,
+		}},
+	}}}}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+
+	token, err := b.loadResumeToken(ctx)
+	if err != nil {
+		return err
+	}
+	if token != nil {
+		opts.SetResumeAfter(token)
+	}
+
+	stream, err := b.db.Watch(ctx, pipeline, opts)
+	if token != nil && isChangeStreamHistoryLost(err) {
+		// the token is older than the oplog, changes in between are lost
+		log.Printf("change bus %s can not resume, watching from now\n", b.Name)
+		stream, err = b.db.Watch(ctx, pipeline, opts.SetResumeAfter(nil))
+	}
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var event rawChangeEvent
+		if err := stream.Decode(&event); err != nil {
+			log.Printf("change bus %s can not decode event: %v\n", b.Name, err)
+		} else {
+			b.dispatch(ctx, event)
+		}
+
+		if err := b.saveResumeToken(ctx, stream.ResumeToken()); err != nil {
+			return err
+		}
+	}
+
+	return stream.Err()
+}
+
+func (b *ChangeBus) dispatch(ctx context.Context, event rawChangeEvent) {
+	for _, handler := range b.handlers[event.Namespace.Collection] {
+		if err := handler(ctx, event); err != nil {
+			log.Printf("change bus %s handler of %s failed: %v\n", b.Name, event.Namespace.Collection, err)
+		}
+	}
+}
+
+func isChangeStreamHistoryLost(err error) bool {
+	var serverErr mongo.ServerError
+	// ChangeStreamHistoryLost, ChangeStreamFatalError
+	return errors.As(err, &serverErr) && (serverErr.HasErrorCode(286) || serverErr.HasErrorCode(280))
+}
+
+type resumeToken struct {
+	Name      string             `bson:"_id"`
+	Token     bson.Raw           `bson:"token"`
+	UpdatedAt primitive.DateTime `bson:"updatedAt"`
+}
+
+func (b *ChangeBus) loadResumeToken(ctx context.Context) (bson.Raw, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	var token resumeToken
+	err := b.tokens.FindOne(ctx, bson.M{"_id": b.Name}).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	return token.Token, err
+}
+
+func (b *ChangeBus) saveResumeToken(ctx context.Context, token bson.Raw) error {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	_, err := b.tokens.UpdateOne(ctx,
+		bson.M{"_id": b.Name},
+		bson.M{"$set": bson.M{
+			"token":     token,
+			"updatedAt": primitive.NewDateTimeFromTime(time.Now()),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
@@ -0,0 +1,60 @@
+package dbutils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type testDocument struct {
+	RawModel `bson:",inline"`
+	Name     string `bson:"name"`
+}
+
+func TestDecodeChangeEvent(t *testing.T) {
+	id := primitive.NewObjectID()
+	at := time.Now().Truncate(time.Second)
+
+	rawEvent := func(doc bson.M) rawChangeEvent {
+		b, err := bson.Marshal(doc)
+		assert.Nil(t, err)
+		var raw rawChangeEvent
+		assert.Nil(t, bson.Unmarshal(b, &raw))
+		return raw
+	}
+
+	event, err := decodeChangeEvent[testDocument](rawEvent(bson.M{
+		"operationType": "update",
+		"ns":            bson.M{"db": "test", "coll": "documents"},
+		"documentKey":   bson.M{"_id": id},
+		"fullDocument":  bson.M{"_id": id, "name": "new name"},
+		"updateDescription": bson.M{
+			"updatedFields": bson.M{"name": "new name"},
+			"removedFields": bson.A{"description"},
+		},
+		"clusterTime": primitive.Timestamp{T: uint32(at.Unix())},
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, UpdateOperation, event.Operation)
+	assert.Equal(t, "documents", event.Collection)
+	assert.Equal(t, id, event.DocumentID)
+	assert.Equal(t, id, event.Document.ID)
+	assert.Equal(t, "new name", event.Document.Name)
+	assert.Equal(t, bson.M{"name": "new name"}, event.UpdatedFields)
+	assert.Equal(t, []string{"description"}, event.RemovedFields)
+	assert.True(t, at.Equal(event.ClusterTime))
+
+	event, err = decodeChangeEvent[testDocument](rawEvent(bson.M{
+		"operationType": "delete",
+		"ns":            bson.M{"db": "test", "coll": "documents"},
+		"documentKey":   bson.M{"_id": id},
+		"fullDocument":  nil,
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, DeleteOperation, event.Operation)
+	assert.Equal(t, id, event.DocumentID)
+	assert.Nil(t, event.Document)
+}
@@ -31,6 +31,11 @@ func InitMongoClient(url string) (*mongo.Client, error) {
 
 func InitMongoDatabaseFromEnv(prefix ...string) (*mongo.Database, error) {
 	info := GetMongoInfoFromEnv(prefix...)
+	if len(prefix) > 0 && prefix[0] != "" {
+		loadDefaultTimeoutFromEnv(prefix[0] + "_")
+	} else {
+		loadDefaultTimeoutFromEnv("")
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
@@ -0,0 +1,268 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrationsCollection records the applied migrations, one document per version
+const MigrationsCollection = "_migrations"
+
+// migrationTimeout bounds each migration step, building indexes of large collections takes a while
+const migrationTimeout = time.Minute * 5
+
+// IndexSpec declares an index of a collection, repos declare their indexes next to their queries
+// and index migrations create (or drop) them
+type IndexSpec struct {
+	Collection string
+	// Name is required so the index could be dropped by down migrations
+	Name   string
+	Keys   bson.D
+	Unique bool
+	// Sparse skips documents without the indexed fields
+	Sparse bool
+	// TTL makes a TTL index removing documents ExpireAfter past the date of the key (at the date when 0),
+	// it requires a single date field key
+	TTL         bool
+	ExpireAfter time.Duration
+	// PartialFilter only indexes the matching documents, $exists: false is not supported by mongo
+	PartialFilter bson.M
+}
+
+func (s IndexSpec) Model() mongo.IndexModel {
+	opts := options.Index().SetName(s.Name)
+	if s.Unique {
+		opts.SetUnique(true)
+	}
+	if s.Sparse {
+		opts.SetSparse(true)
+	}
+	if s.TTL {
+		opts.SetExpireAfterSeconds(int32(s.ExpireAfter.Seconds()))
+	}
+	if s.PartialFilter != nil {
+		opts.SetPartialFilterExpression(s.PartialFilter)
+	}
+
+	return mongo.IndexModel{Keys: s.Keys, Options: opts}
+}
+
+// EnsureIndexes creates the indexes, existing indexes with the same name and options are kept
+func EnsureIndexes(ctx context.Context, db *mongo.Database, specs ...IndexSpec) error {
+	for _, spec := range specs {
+		if _, err := db.Collection(spec.Collection).Indexes().CreateOne(ctx, spec.Model()); err != nil {
+			return fmt.Errorf("can not create index %s of %s: %v", spec.Name, spec.Collection, err)
+		}
+	}
+	return nil
+}
+
+// DropIndexes drops the indexes, missing indexes are ignored
+func DropIndexes(ctx context.Context, db *mongo.Database, specs ...IndexSpec) error {
+	for _, spec := range specs {
+		_, err := db.Collection(spec.Collection).Indexes().DropOne(ctx, spec.Name)
+		if err != nil && !isNamespaceOrIndexNotFound(err) {
+			return fmt.Errorf("can not drop index %s of %s: %v", spec.Name, spec.Collection, err)
+		}
+	}
+	return nil
+}
+
+func isNamespaceOrIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	// NamespaceNotFound, IndexNotFound
+	return cmdErr.Code == 26 || cmdErr.Code == 27
+}
+
+type MigrationFunc func(ctx context.Context, db *mongo.Database) error
+
+type Migration struct {
+	// Version orders the migrations, it must be unique and must not change once the migration is released
+	Version     int
+	Description string
+	Up          MigrationFunc
+	// Down reverts Up, migrations without Down can not be reverted
+	Down MigrationFunc
+}
+
+// IndexMigration creates the indexes on up and drops them on down
+func IndexMigration(version int, description string, specs ...IndexSpec) Migration {
+	return Migration{
+		Version:     version,
+		Description: description,
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return EnsureIndexes(ctx, db, specs...)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return DropIndexes(ctx, db, specs...)
+		},
+	}
+}
+
+type MigrationRecord struct {
+	Version     int                `bson:"_id"`
+	Description string             `bson:"description"`
+	AppliedAt   primitive.DateTime `bson:"appliedAt"`
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *mongo.Database
+	col        *mongo.Collection
+	migrations []Migration
+}
+
+// NewMigrator sorts the migrations by version, duplicated versions are rejected
+func NewMigrator(db *mongo.Database, migrations ...Migration) (*Migrator, error) {
+	sorted := slices.Clone(migrations)
+	slices.SortFunc(sorted, func(a, b Migration) int { return a.Version - b.Version })
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migration %q has invalid version %d", m.Description, m.Version)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d has no up", m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("duplicated migration version %d", m.Version)
+		}
+	}
+
+	return &Migrator{
+		db:         db,
+		col:        db.Collection(MigrationsCollection),
+		migrations: sorted,
+	}, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]MigrationRecord, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	cur, err := m.col.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []MigrationRecord
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]MigrationRecord, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// Status lists all migrations in order with whether they are applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = MigrationStatus{Migration: migration}
+		if record, ok := applied[migration.Version]; ok {
+			statuses[i].Applied = true
+			statuses[i].AppliedAt = record.AppliedAt.Time()
+		}
+	}
+	return statuses, nil
+}
+
+// Up applies pending migrations in order up to the target version (all if target is 0),
+// it stops at the first failure and returns the applied migrations
+func (m *Migrator) Up(ctx context.Context, target int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0)
+	for _, migration := range m.migrations {
+		if target > 0 && migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		if err := m.run(ctx, migration.Up); err != nil {
+			return done, fmt.Errorf("migration %d (%s) failed: %v", migration.Version, migration.Description, err)
+		}
+
+		stepCtx, cancel := WithTimeout(ctx)
+		_, err := m.col.InsertOne(stepCtx, MigrationRecord{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   primitive.NewDateTimeFromTime(time.Now()),
+		})
+		cancel()
+		if err != nil {
+			return done, fmt.Errorf("can not record migration %d: %v", migration.Version, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down reverts the latest applied migrations, steps is the number of migrations to revert
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0)
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return done, fmt.Errorf("migration %d (%s) can not be reverted", migration.Version, migration.Description)
+		}
+
+		if err := m.run(ctx, migration.Down); err != nil {
+			return done, fmt.Errorf("reverting migration %d (%s) failed: %v", migration.Version, migration.Description, err)
+		}
+
+		stepCtx, cancel := WithTimeout(ctx)
+		_, err := m.col.DeleteOne(stepCtx, bson.M{"_id": migration.Version})
+		cancel()
+		if err != nil {
+			return done, fmt.Errorf("can not remove record of migration %d: %v", migration.Version, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+func (m *Migrator) run(ctx context.Context, fn MigrationFunc) error {
+	ctx, cancel := WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+
+	return fn(ctx, m.db)
+}
@@ -0,0 +1,29 @@
+package dbutils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIndexSpecModel(t *testing.T) {
+	keys := bson.D{{Key: "expireAt", Value: 1}}
+
+	model := IndexSpec{Name: "expireAt_1", Keys: keys}.Model()
+	assert.Equal(t, "expireAt_1", *model.Options.Name)
+	assert.Nil(t, model.Options.ExpireAfterSeconds)
+	assert.Nil(t, model.Options.PartialFilterExpression)
+
+	// documents expire at the date of the key
+	model = IndexSpec{Name: "expireAt_1", Keys: keys, TTL: true}.Model()
+	assert.Equal(t, int32(0), *model.Options.ExpireAfterSeconds)
+
+	model = IndexSpec{Name: "expireAt_1", Keys: keys, TTL: true, ExpireAfter: time.Hour}.Model()
+	assert.Equal(t, int32(3600), *model.Options.ExpireAfterSeconds)
+
+	model = IndexSpec{Name: "type_1", Keys: keys, Unique: true, PartialFilter: bson.M{"type": "a"}}.Model()
+	assert.True(t, *model.Options.Unique)
+	assert.Equal(t, bson.M{"type": "a"}, model.Options.PartialFilterExpression)
+}
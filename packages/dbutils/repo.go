@@ -7,24 +7,45 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type IRawModel interface {
+	GetID() primitive.ObjectID
 	SetID(primitive.ObjectID)
+	SetCreatedBy(primitive.ObjectID)
 	SetInitTimeByNow()
 	SetUpdatedAtByNow()
 }
 
 type RawModel struct {
-	ID        primitive.ObjectID `bson:"_id"       json:"id"`
-	CreatedAt primitive.DateTime `bson:"createdAt" json:"createdAt"`
-	UpdatedAt primitive.DateTime `bson:"updatedAt" json:"updatedAt"`
+	ID        primitive.ObjectID  `bson:"_id"                 json:"id"`
+	CreatedAt primitive.DateTime  `bson:"createdAt"           json:"createdAt"`
+	UpdatedAt primitive.DateTime  `bson:"updatedAt"           json:"updatedAt"`
+	CreatedBy *primitive.ObjectID `bson:"createdBy,omitempty" json:"createdBy,omitempty"`
+	UpdatedBy *primitive.ObjectID `bson:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+	// DeletedAt is only set on soft deleted documents, see SingleCollectionRepo.SoftDelete
+	DeletedAt *primitive.DateTime `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	DeletedBy *primitive.ObjectID `bson:"deletedBy,omitempty" json:"deletedBy,omitempty"`
+}
+
+func (m *RawModel) GetID() primitive.ObjectID {
+	return m.ID
 }
 
 func (m *RawModel) SetID(id primitive.ObjectID) {
 	m.ID = id
 }
 
+func (m *RawModel) SetCreatedBy(userID primitive.ObjectID) {
+	m.CreatedBy = &userID
+	m.UpdatedBy = &userID
+}
+
+func (m *RawModel) IsDeleted() bool {
+	return m.DeletedAt != nil
+}
+
 func (m *RawModel) SetInitTime(at time.Time) {
 	atTime := primitive.NewDateTimeFromTime(at)
 	m.CreatedAt = atTime
@@ -48,47 +69,83 @@ func (m *RawModel) SetUpdatedAtByNow() {
 }
 
 type IRepo[M IRawModel] interface {
-	Insert(obj M) (M, error)
-	InsertRaw(obj M) (M, error)
-	GetByID(ID primitive.ObjectID) (M, error)
-	UpdateByID(ID primitive.ObjectID, obj M) (M, error)
+	Insert(ctx context.Context, obj M) (M, error)
+	InsertRaw(ctx context.Context, obj M) (M, error)
+	GetByID(ctx context.Context, ID primitive.ObjectID) (M, error)
+	UpdateByID(ctx context.Context, ID primitive.ObjectID, obj M) (M, error)
 }
 
 type SingleCollectionRepo[M IRawModel] struct {
 	*mongo.Collection
+
+	// Timeout bounds every operation of the repo, DefaultTimeout is used if it is not set
+	Timeout time.Duration
+	// SoftDelete makes DeleteByID mark documents as deleted instead of removing them,
+	// reads of the repo exclude deleted documents and RestoreByID brings them back
+	SoftDelete bool
+}
+
+// scope excludes soft deleted documents from the filter if the repo uses soft delete
+func (r *SingleCollectionRepo[M]) scope(filter any) any {
+	if !r.SoftDelete {
+		return filter
+	}
+
+	switch f := filter.(type) {
+	case nil:
+		return NotDeleted(nil)
+	case bson.M:
+		return NotDeleted(f)
+	default:
+		return bson.M{"$and": bson.A{filter, NotDeleted(nil)}}
+	}
 }
 
-func (r *SingleCollectionRepo[M]) Insert(obj M) (M, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+func (r *SingleCollectionRepo[M]) Insert(ctx context.Context, obj M) (M, error) {
+	ctx, cancel := WithTimeout(ctx, r.Timeout)
 	defer cancel()
 	_, err := r.InsertOne(ctx, obj)
 	return obj, err
 }
 
-func (r *SingleCollectionRepo[M]) InsertRaw(obj M) (M, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+func (r *SingleCollectionRepo[M]) InsertRaw(ctx context.Context, obj M) (M, error) {
+	ctx, cancel := WithTimeout(ctx, r.Timeout)
 	defer cancel()
 	obj.SetID(primitive.NewObjectID())
 	obj.SetInitTimeByNow()
+	if actor, ok := ActorFromContext(ctx); ok {
+		obj.SetCreatedBy(actor)
+	}
 
 	_, err := r.InsertOne(ctx, obj)
 	return obj, err
 }
 
-func (r *SingleCollectionRepo[M]) GetByID(ID primitive.ObjectID) (M, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+func (r *SingleCollectionRepo[M]) GetByID(ctx context.Context, ID primitive.ObjectID) (M, error) {
+	ctx, cancel := WithTimeout(ctx, r.Timeout)
 	defer cancel()
 
 	var obj M
-	err := r.FindOne(ctx, bson.M{"_id": ID}).Decode(&obj)
+	err := r.FindOne(ctx, r.scope(bson.M{"_id": ID})).Decode(&obj)
 
 	return obj, err
 }
 
-func (r *SingleCollectionRepo[M]) DeleteByID(ID primitive.ObjectID) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+func (r *SingleCollectionRepo[M]) DeleteByID(ctx context.Context, ID primitive.ObjectID) error {
+	ctx, cancel := WithTimeout(ctx, r.Timeout)
 	defer cancel()
 
+	if r.SoftDelete {
+		result, err := r.UpdateOne(ctx, NotDeleted(bson.M{"_id": ID}), SoftDeleteUpdate(ctx))
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return nil
+	}
+
 	cur, err := r.DeleteOne(ctx, bson.M{"_id": ID})
 	if err != nil {
 		return err
@@ -98,3 +155,209 @@ func (r *SingleCollectionRepo[M]) DeleteByID(ID primitive.ObjectID) error {
 	}
 	return nil
 }
+
+// RestoreByID restores the soft deleted document
+func (r *SingleCollectionRepo[M]) RestoreByID(ctx context.Context, ID primitive.ObjectID) (M, error) {
+	return r.Restore(ctx, bson.M{"_id": ID})
+}
+
+// Restore restores a soft deleted document matching the filter, returns ErrNoDocuments if not found
+func (r *SingleCollectionRepo[M]) Restore(ctx context.Context, filter bson.M) (M, error) {
+	ctx, cancel := WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	deleted := bson.M{"deletedAt": bson.M{"$exists": true}}
+	for key, value := range filter {
+		deleted[key] = value
+	}
+
+	var obj M
+	err := r.FindOneAndUpdate(ctx, deleted, RestoreUpdate(ctx),
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&obj)
+	return obj, err
+}
+
+// UpdateByID sets fields of obj to the document, the ID and createdAt are kept and updatedAt is set to now.
+// Zero fields tagged with omitempty are not set, so obj could be a partial document
+func (r *SingleCollectionRepo[M]) UpdateByID(ctx context.Context, ID primitive.ObjectID, obj M) (M, error) {
+	fields, err := updatableFields(obj)
+	if err != nil {
+		var zero M
+		return zero, err
+	}
+
+	return r.UpdateFieldsByID(ctx, ID, fields)
+}
+
+// UpdateFieldsByID sets the fields (e.g. {"name": "new name"}) and updatedAt of the document,
+// returns the updated document
+func (r *SingleCollectionRepo[M]) UpdateFieldsByID(ctx context.Context, ID primitive.ObjectID, fields bson.M) (M, error) {
+	ctx, cancel := WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	set := bson.M{}
+	for key, value := range fields {
+		set[key] = value
+	}
+	Touched(ctx, set)
+
+	var obj M
+	err := r.FindOneAndUpdate(ctx,
+		r.scope(bson.M{"_id": ID}),
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&obj)
+	return obj, err
+}
+
+// Upsert updates the document matching the filter like UpdateByID, or inserts obj with a new ID if not found
+func (r *SingleCollectionRepo[M]) Upsert(ctx context.Context, filter any, obj M) (M, error) {
+	ctx, cancel := WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	var upserted M
+	fields, err := updatableFields(obj)
+	if err != nil {
+		return upserted, err
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	fields["updatedAt"] = now
+	onInsert := bson.M{"createdAt": now}
+	// the inserted document takes the ID of the filter, setting another one would fail the upsert
+	if !filterHasID(filter) {
+		onInsert["_id"] = primitive.NewObjectID()
+	}
+	if actor, ok := ActorFromContext(ctx); ok {
+		fields["updatedBy"] = actor
+		onInsert["createdBy"] = actor
+	}
+	update := bson.M{"$set": fields, "$setOnInsert": onInsert}
+
+	err = r.FindOneAndUpdate(ctx, r.scope(filter), update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&upserted)
+	return upserted, err
+}
+
+// filterHasID reports if the filter has a top level _id condition
+func filterHasID(filter any) bool {
+	switch f := filter.(type) {
+	case bson.M:
+		_, ok := f["_id"]
+		return ok
+	case bson.D:
+		for _, elem := range f {
+			if elem.Key == "_id" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Find decodes all documents matching the filter
+func (r *SingleCollectionRepo[M]) Find(ctx context.Context, filter any, opts ...*options.FindOptions) ([]M, error) {
+	ctx, cancel := WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	cur, err := r.Collection.Find(ctx, r.scope(filter), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := make([]M, 0)
+	err = cur.All(ctx, &objs)
+	return objs, err
+}
+
+func (r *SingleCollectionRepo[M]) Count(ctx context.Context, filter any) (int64, error) {
+	ctx, cancel := WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	return r.CountDocuments(ctx, r.scope(filter))
+}
+
+type Page[M any] struct {
+	Items      []M    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type ListOptions struct {
+	// Cursor is the ID of the last document of the previous page, zero for the first page
+	Cursor primitive.ObjectID
+	Limit  int64
+	// Descending lists the newest documents first
+	Descending bool
+}
+
+// List pages documents matching the filter by ID, the next cursor is only set if the page is full
+func (r *SingleCollectionRepo[M]) List(ctx context.Context, filter bson.M, opts ListOptions) (Page[M], error) {
+	query := listQuery(filter, opts)
+
+	sort := 1
+	if opts.Descending {
+		sort = -1
+	}
+	findOptions := options.Find().SetSort(bson.M{"_id": sort})
+	if opts.Limit > 0 {
+		findOptions.SetLimit(opts.Limit)
+	}
+
+	items, err := r.Find(ctx, query, findOptions)
+	if err != nil {
+		return Page[M]{}, err
+	}
+
+	page := Page[M]{Items: items}
+	if opts.Limit > 0 && int64(len(items)) == opts.Limit {
+		page.NextCursor = items[len(items)-1].GetID().Hex()
+	}
+
+	return page, nil
+}
+
+// listQuery adds the cursor to the filter, an _id condition of the filter is kept along with the cursor
+func listQuery(filter bson.M, opts ListOptions) bson.M {
+	query := bson.M{}
+	for key, value := range filter {
+		query[key] = value
+	}
+	if opts.Cursor.IsZero() {
+		return query
+	}
+
+	op := "$gt"
+	if opts.Descending {
+		op = "$lt"
+	}
+	cursor := bson.M{"_id": bson.M{op: opts.Cursor}}
+	if _, ok := query["_id"]; ok {
+		return bson.M{"$and": bson.A{query, cursor}}
+	}
+
+	query["_id"] = cursor["_id"]
+	return query
+}
+
+// updatableFields marshals obj to fields that could be set by updates, without ID and timestamps
+func updatableFields(obj any) (bson.M, error) {
+	b, err := bson.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields bson.M
+	if err := bson.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "_id")
+	delete(fields, "createdAt")
+	delete(fields, "updatedAt")
+	for _, audit := range []string{"createdBy", "updatedBy", "deletedAt", "deletedBy"} {
+		delete(fields, audit)
+	}
+
+	return fields, nil
+}
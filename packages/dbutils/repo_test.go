@@ -0,0 +1,38 @@
+package dbutils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFilterHasID(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	assert.True(t, filterHasID(bson.M{"_id": id}))
+	assert.True(t, filterHasID(bson.D{{Key: "userId", Value: id}, {Key: "_id", Value: id}}))
+	assert.False(t, filterHasID(bson.M{"userId": id}))
+	assert.False(t, filterHasID(nil))
+}
+
+func TestListQuery(t *testing.T) {
+	userID := primitive.NewObjectID()
+	cursor := primitive.NewObjectID()
+	excluded := []primitive.ObjectID{primitive.NewObjectID()}
+
+	assert.Equal(t, bson.M{"userId": userID}, listQuery(bson.M{"userId": userID}, ListOptions{}))
+	assert.Equal(t,
+		bson.M{"userId": userID, "_id": bson.M{"$lt": cursor}},
+		listQuery(bson.M{"userId": userID}, ListOptions{Cursor: cursor, Descending: true}),
+	)
+
+	// the _id condition of the filter is not replaced by the cursor
+	filter := bson.M{"userId": userID, "_id": bson.M{"$nin": excluded}}
+	assert.Equal(t,
+		bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$gt": cursor}}}},
+		listQuery(filter, ListOptions{Cursor: cursor}),
+	)
+	assert.Equal(t, bson.M{"$nin": excluded}, filter["_id"])
+}
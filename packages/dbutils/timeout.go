@@ -0,0 +1,34 @@
+package dbutils
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// DefaultTimeout bounds repo operations that do not configure their own timeout,
+// it is loaded from MONGO_TIMEOUT (e.g. 2s) by InitMongoDatabaseFromEnv
+var DefaultTimeout = time.Second
+
+// WithTimeout derives the context of a repo operation from the context of the caller (e.g. the request),
+// so the operation is canceled with the request and never lasts longer than the timeout
+func WithTimeout(ctx context.Context, timeout ...time.Duration) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	t := DefaultTimeout
+	if len(timeout) > 0 && timeout[0] > 0 {
+		t = timeout[0]
+	}
+
+	return context.WithTimeout(ctx, t)
+}
+
+func loadDefaultTimeoutFromEnv(prefix string) {
+	if value := os.Getenv(prefix + "MONGO_TIMEOUT"); value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			DefaultTimeout = timeout
+		}
+	}
+}
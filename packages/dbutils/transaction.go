@@ -0,0 +1,82 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// DefaultTransactionRetries is the number of retries of a transaction (or its commit) on transient errors
+const DefaultTransactionRetries = 3
+
+// error labels of mongo, see https://www.mongodb.com/docs/manual/core/transactions-in-applications/
+const (
+	transientTransactionError      = "TransientTransactionError"
+	unknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+// Transactor runs units of work in mongo transactions, transactions require a replica set (or mongos)
+type Transactor struct {
+	Client     *mongo.Client
+	MaxRetries int
+}
+
+func NewTransactor(db *mongo.Database) *Transactor {
+	return &Transactor{Client: db.Client(), MaxRetries: DefaultTransactionRetries}
+}
+
+// WithTransaction runs fn in a transaction, all repo operations using the context passed to fn are part of it.
+// The transaction is aborted if fn returns an error, and fn is run again on transient transaction errors
+// so it must not have side effects outside of the database
+func (t *Transactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	session, err := t.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	txOptions := options.Transaction().
+		SetReadConcern(readconcern.Snapshot()).
+		SetWriteConcern(writeconcern.Majority())
+
+	for attempt := 0; ; attempt++ {
+		err = mongo.WithSession(ctx, session, func(sessCtx mongo.SessionContext) error {
+			if err := session.StartTransaction(txOptions); err != nil {
+				return err
+			}
+
+			if err := fn(sessCtx); err != nil {
+				// abort with a fresh context, the context of fn could be canceled
+				_ = session.AbortTransaction(context.Background())
+				return err
+			}
+
+			return t.commit(sessCtx, session)
+		})
+		if err == nil || attempt >= t.MaxRetries || !hasErrorLabel(err, transientTransactionError) {
+			return err
+		}
+	}
+}
+
+func (t *Transactor) commit(ctx context.Context, session mongo.Session) error {
+	for attempt := 0; ; attempt++ {
+		err := session.CommitTransaction(ctx)
+		if err == nil || attempt >= t.MaxRetries || !hasErrorLabel(err, unknownTransactionCommitResult) {
+			return err
+		}
+	}
+}
+
+func hasErrorLabel(err error, label string) bool {
+	var labeled mongo.LabeledError
+	return errors.As(err, &labeled) && labeled.HasErrorLabel(label)
+}
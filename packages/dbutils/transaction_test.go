@@ -0,0 +1,171 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// transactions require a replica set, failpoints are used to force errors of the server
+func GetReplicaSetTestDatabase(t *testing.T) *mongo.Database {
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	ctx := context.Background()
+	container, err := mongodb.RunContainer(ctx,
+		mongodb.WithReplicaSet(),
+		testcontainers.CustomizeRequestOption(func(req *testcontainers.GenericContainerRequest) error {
+			req.Cmd = append(req.Cmd, "--setParameter", "enableTestCommands=1")
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = container.Terminate(ctx) })
+
+	url, err := container.ConnectionString(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the replica set is announced with the address of the container, not the mapped port
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(url).SetDirect(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(ctx) })
+
+	return client.Database("blinders-test")
+}
+
+func failCommitTransaction(t *testing.T, db *mongo.Database, times int) {
+	admin := db.Client().Database("admin")
+	err := admin.RunCommand(context.Background(), bson.D{
+		{Key: "configureFailPoint", Value: "failCommand"},
+		{Key: "mode", Value: bson.M{"times": times}},
+		{Key: "data", Value: bson.M{
+			"failCommands": bson.A{"commitTransaction"},
+			"errorCode":    2,
+			"errorLabels":  bson.A{unknownTransactionCommitResult},
+		}},
+	}).Err()
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = admin.RunCommand(context.Background(), bson.D{
+			{Key: "configureFailPoint", Value: "failCommand"},
+			{Key: "mode", Value: "off"},
+		}).Err()
+	})
+}
+
+func countDocuments(t *testing.T, col *mongo.Collection) int64 {
+	count, err := col.CountDocuments(context.Background(), bson.M{})
+	assert.Nil(t, err)
+	return count
+}
+
+func TestHasErrorLabel(t *testing.T) {
+	transient := mongo.CommandError{Code: 112, Labels: []string{transientTransactionError}}
+
+	assert.True(t, hasErrorLabel(transient, transientTransactionError))
+	assert.True(t, hasErrorLabel(fmt.Errorf("users: %w", transient), transientTransactionError))
+	assert.False(t, hasErrorLabel(fmt.Errorf("users: %v", transient), transientTransactionError))
+	assert.False(t, hasErrorLabel(transient, unknownTransactionCommitResult))
+	assert.False(t, hasErrorLabel(errors.New("something went wrong"), transientTransactionError))
+}
+
+func TestWithTransaction(t *testing.T) {
+	db := GetReplicaSetTestDatabase(t)
+
+	t.Run("commits or aborts writes of fn", func(t *testing.T) {
+		col := db.Collection("transaction-commit")
+		tx := NewTransactor(db)
+
+		err := tx.WithTransaction(context.Background(), func(ctx context.Context) error {
+			_, err := col.InsertOne(ctx, bson.M{"name": "committed"})
+			return err
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), countDocuments(t, col))
+
+		failed := errors.New("failed")
+		err = tx.WithTransaction(context.Background(), func(ctx context.Context) error {
+			if _, err := col.InsertOne(ctx, bson.M{"name": "aborted"}); err != nil {
+				return err
+			}
+			return failed
+		})
+		assert.ErrorIs(t, err, failed)
+		assert.Equal(t, int64(1), countDocuments(t, col))
+	})
+
+	t.Run("retries fn on transient errors", func(t *testing.T) {
+		col := db.Collection("transaction-transient")
+		tx := NewTransactor(db)
+		transient := mongo.CommandError{Code: 112, Labels: []string{transientTransactionError}}
+
+		attempts := 0
+		err := tx.WithTransaction(context.Background(), func(ctx context.Context) error {
+			attempts++
+			if _, err := col.InsertOne(ctx, bson.M{"attempt": attempts}); err != nil {
+				return err
+			}
+			if attempts == 1 {
+				return fmt.Errorf("users: %w", transient)
+			}
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, attempts)
+		// writes of the aborted attempt are discarded
+		assert.Equal(t, int64(1), countDocuments(t, col))
+
+		attempts = 0
+		err = tx.WithTransaction(context.Background(), func(ctx context.Context) error {
+			attempts++
+			return transient
+		})
+		assert.True(t, hasErrorLabel(err, transientTransactionError))
+		assert.Equal(t, tx.MaxRetries+1, attempts)
+
+		attempts = 0
+		err = tx.WithTransaction(context.Background(), func(ctx context.Context) error {
+			attempts++
+			return errors.New("not transient")
+		})
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("retries commit on unknown commit results", func(t *testing.T) {
+		col := db.Collection("transaction-commit-retry")
+		tx := NewTransactor(db)
+		failCommitTransaction(t, db, 1)
+
+		attempts := 0
+		err := tx.WithTransaction(context.Background(), func(ctx context.Context) error {
+			attempts++
+			_, err := col.InsertOne(ctx, bson.M{"name": "committed"})
+			return err
+		})
+		assert.Nil(t, err)
+		// only the commit is retried, fn is run once
+		assert.Equal(t, 1, attempts)
+		assert.Equal(t, int64(1), countDocuments(t, col))
+
+		failCommitTransaction(t, db, tx.MaxRetries+1)
+		err = tx.WithTransaction(context.Background(), func(ctx context.Context) error {
+			_, err := col.InsertOne(ctx, bson.M{"name": "not committed"})
+			return err
+		})
+		assert.True(t, hasErrorLabel(err, unknownTransactionCommitResult))
+		assert.Equal(t, int64(1), countDocuments(t, col))
+	})
+}
@@ -5,7 +5,6 @@ import (
 
 	"blinders/packages/auth"
 	"blinders/packages/dbutils"
-	"blinders/services/users/repo"
 
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -16,11 +15,12 @@ func HTTPServerCommonSetup() (*auth.Manager, *mongo.Database) {
 		log.Fatal("failed to init database:", err)
 	}
 
-	usersRepo := repo.NewUsersRepo(mongoDB)
-	auth, err := auth.NewFirebaseManagerFromFile("firebase.admin.json", usersRepo)
+	resolver := NewUserResolver(mongoDB)
+	auth, err := auth.NewManagerFromEnv("firebase.admin.json", resolver)
 	if err != nil {
 		log.Fatal("failed to init auth manager:", err)
 	}
+	auth.Cache = NewTokenCacheFromEnv()
 
 	return auth, mongoDB
 }
@@ -6,7 +6,6 @@ import (
 	"blinders/packages/auth"
 	"blinders/packages/dbutils"
 	"blinders/packages/utils"
-	"blinders/services/users/repo"
 
 	fiberadapter "github.com/awslabs/aws-lambda-go-api-proxy/fiber"
 	"github.com/gofiber/fiber/v2"
@@ -21,11 +20,12 @@ func LambdaCommonSetup() (*auth.Manager, *mongo.Database) {
 		log.Fatal("failed to init database:", err)
 	}
 
-	usersRepo := repo.NewUsersRepo(mongoDB)
-	auth, err := auth.NewFirebaseManagerFromFile("firebase.admin.json", usersRepo)
+	resolver := NewUserResolver(mongoDB)
+	auth, err := auth.NewManagerFromEnv("firebase.admin.json", resolver)
 	if err != nil {
 		log.Fatal("failed to init auth manager:", err)
 	}
+	auth.Cache = NewTokenCacheFromEnv()
 
 	return auth, mongoDB
 }
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"time"
+
+	"blinders/packages/auth"
+	"blinders/services/users/repo"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	UserResolverCacheTTL  = time.Minute
+	UserResolverCacheSize = 1000
+)
+
+// NewUserResolver resolves users from the users collection with an in-memory cache,
+// the cache lives as long as the (lambda) instance
+func NewUserResolver(db *mongo.Database) auth.UserResolver {
+	return auth.NewCachedUserResolver(
+		repo.NewUserResolver(repo.NewUsersRepo(db)),
+		UserResolverCacheTTL,
+		UserResolverCacheSize,
+	)
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"blinders/packages/auth"
+	"blinders/packages/utils"
+)
+
+const (
+	DefaultTokenCacheTTL  = 5 * time.Minute
+	DefaultTokenCacheSize = 1000
+)
+
+// NewTokenCacheFromEnv configures the token cache of auth middlewares:
+// AUTH_TOKEN_CACHE_TTL (duration, "0" disables the cache), AUTH_TOKEN_CACHE_SIZE of the in-memory store,
+// and AUTH_TOKEN_CACHE_REDIS=true to share the cache between instances with redis.
+// There is no cache with AUTH_CHECK_REVOKED=true, cached tokens would skip the revocation check
+func NewTokenCacheFromEnv() *auth.TokenCache {
+	if os.Getenv("AUTH_CHECK_REVOKED") == "true" {
+		log.Println("token cache is disabled, tokens are checked for revocation on each request")
+		return nil
+	}
+
+	ttl := DefaultTokenCacheTTL
+	if value := os.Getenv("AUTH_TOKEN_CACHE_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Println("invalid AUTH_TOKEN_CACHE_TTL, use default:", err)
+		} else {
+			ttl = parsed
+		}
+	}
+	if ttl <= 0 {
+		return nil
+	}
+
+	if os.Getenv("AUTH_TOKEN_CACHE_REDIS") == "true" {
+		store := auth.NewRedisTokenStore(utils.NewRedisClientFromEnv(context.Background()))
+		return auth.NewTokenCache(store, ttl)
+	}
+
+	size := DefaultTokenCacheSize
+	if value, err := strconv.Atoi(os.Getenv("AUTH_TOKEN_CACHE_SIZE")); err == nil && value > 0 {
+		size = value
+	}
+
+	return auth.NewTokenCache(auth.NewMemoryTokenStore(size), ttl)
+}
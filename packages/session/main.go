@@ -34,3 +34,19 @@ func (m *Manager) GetSessions(userID string) ([]string, error) {
 	key := ConstructUserKey(userID)
 	return m.RedisClient.SMembers(context.Background(), key).Result()
 }
+
+// RemoveAllSessions removes all sessions of the user, returns the number of removed sessions
+func (m *Manager) RemoveAllSessions(userID string) (int64, error) {
+	key := ConstructUserKey(userID)
+	count, err := m.RedisClient.SCard(context.Background(), key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return count, m.RedisClient.Del(context.Background(), key).Err()
+}
+
+func (m *Manager) CountSessions(userID string) (int64, error) {
+	key := ConstructUserKey(userID)
+	return m.RedisClient.SCard(context.Background(), key).Result()
+}
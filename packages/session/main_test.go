@@ -3,6 +3,7 @@ package session
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/test-go/testify/assert"
@@ -62,3 +63,21 @@ func TestGetSessions(t *testing.T) {
 	assert.Contains(t, value, ConstructConnectionKey("1"))
 	assert.Contains(t, value, ConstructConnectionKey("2"))
 }
+
+func TestConsumeTicket(t *testing.T) {
+	manager, teardown := setup()
+	defer teardown()
+
+	id, err := manager.IssueTicket(context.Background(), Ticket{UserID: "1", Data: "data"}, time.Minute)
+	assert.Nil(t, err)
+
+	ticket, err := manager.ConsumeTicket(context.Background(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, &Ticket{UserID: "1", Data: "data"}, ticket)
+
+	_, err = manager.ConsumeTicket(context.Background(), id)
+	assert.Equal(t, ErrTicketNotFound, err)
+
+	_, err = manager.ConsumeTicket(context.Background(), "")
+	assert.Equal(t, ErrTicketNotFound, err)
+}
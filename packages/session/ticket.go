@@ -0,0 +1,64 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultTicketTTL = 30 * time.Second
+
+var ErrTicketNotFound = errors.New("ticket not found or expired")
+
+// Ticket authorizes a single websocket connection of the user,
+// it is used instead of the long-lived ID token in the query string of the connection
+type Ticket struct {
+	UserID string `json:"userId"`
+	// Data is opaque data of the issuer, e.g. the marshaled identity of the user
+	Data string `json:"data,omitempty"`
+}
+
+// IssueTicket stores the ticket with the TTL, returns the random ID of the ticket
+func (m *Manager) IssueTicket(ctx context.Context, ticket Ticket, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+
+	value, err := json.Marshal(ticket)
+	if err != nil {
+		return "", err
+	}
+	if err := m.RedisClient.Set(ctx, ConstructTicketKey(id), value, ttl).Err(); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// ConsumeTicket gets and deletes the ticket atomically, so a ticket can only be used once
+func (m *Manager) ConsumeTicket(ctx context.Context, id string) (*Ticket, error) {
+	if id == "" {
+		return nil, ErrTicketNotFound
+	}
+
+	value, err := m.RedisClient.GetDel(ctx, ConstructTicketKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrTicketNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var ticket Ticket
+	if err := json.Unmarshal(value, &ticket); err != nil {
+		return nil, err
+	}
+
+	return &ticket, nil
+}
@@ -7,3 +7,7 @@ func ConstructUserKey(userID string) string {
 func ConstructConnectionKey(connectionID string) string {
 	return "connection:" + connectionID
 }
+
+func ConstructTicketKey(ticketID string) string {
+	return "ticket:" + ticketID
+}
@@ -4,16 +4,20 @@ Run all services as a monolith server
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 
 	"blinders/packages/auth"
 	"blinders/packages/dbutils"
+	"blinders/packages/service"
+	"blinders/packages/session"
+	"blinders/packages/utils"
 	"blinders/services/chat"
 	"blinders/services/practice"
+	"blinders/services/suggest"
 	"blinders/services/users"
-	"blinders/services/users/repo"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
@@ -23,6 +27,7 @@ import (
 var (
 	db *mongo.Database
 	am *auth.Manager
+	sm *session.Manager
 )
 
 func init() {
@@ -50,27 +55,58 @@ func init() {
 		log.Fatal("failed to connect to mongo:", err)
 	}
 
-	usersRepo := repo.NewUsersRepo(db)
-	am, err = auth.NewFirebaseManagerFromFile(firebaseFile, usersRepo)
+	am, err = auth.NewManagerFromEnv(firebaseFile, service.NewUserResolver(db))
 	if err != nil {
 		log.Fatal("failed to init auth manager:", err)
 	}
+	am.Cache = service.NewTokenCacheFromEnv()
+
+	if os.Getenv("REDIS_HOST") != "" {
+		sm = session.NewManager(utils.NewRedisClientFromEnv(context.Background()))
+	}
 }
 
 func main() {
+	chatService := chat.NewService(am, db)
+	practiceService := practice.NewService(am, db)
+	usersService := users.NewService(am, db)
+	usersService.RegisterDataCleaner("chat", chatService)
+	usersService.RegisterDataCleaner("practice", practiceService)
+	// suggest routes are not served by the monolith, only explain logs of deleted users are cleaned
+	usersService.RegisterDataCleaner("suggest", suggest.NewService(am, db, nil))
+	if sm != nil {
+		usersService.Sessions = sm
+		usersService.RegisterExternalDataCleaner("sessions", users.SessionsCleaner{Manager: sm})
+	}
+
 	services := []Service{
-		{PathPrefix: "chat", Fiber: chat.NewService(am, db)},
-		{PathPrefix: "users", Fiber: users.NewService(am, db)},
-		{PathPrefix: "practice", Fiber: practice.NewService(am, db)},
+		{PathPrefix: "chat", Fiber: chatService},
+		{PathPrefix: "users", Fiber: usersService},
+		{PathPrefix: "practice", Fiber: practiceService},
 	}
 
 	fiberApp := fiber.New()
+	fiberApp.Get("/metrics/auth",
+		am.FiberAuthMiddleware(auth.Config{WithUser: true, Roles: []auth.Role{auth.RoleAdmin}}),
+		func(ctx *fiber.Ctx) error {
+			if am.Cache == nil {
+				return ctx.JSON(nil)
+			}
+			return ctx.JSON(am.Cache.Stats())
+		})
 
 	for _, service := range services {
 		router := fiberApp.Group(service.PathPrefix)
 		service.Fiber.InitFiberRoutes(router)
 	}
 
+	// change streams require mongo to be a replica set
+	if os.Getenv("MONGO_CHANGE_STREAM") == "true" {
+		bus := dbutils.NewChangeBus(db, "server")
+		usersService.RegisterChangeHandlers(bus)
+		go bus.Run(context.Background())
+	}
+
 	port := os.Getenv("MONOLITHIC_SERVER_PORT")
 	if port == "" {
 		port = "8080"
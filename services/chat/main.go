@@ -1,6 +1,7 @@
 package chat
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"strconv"
@@ -41,6 +42,10 @@ func (s Service) InitFiberRoutes(r fiber.Router) {
 	conversations.Get("/:id/messages", s.GetMessagesOfConversation)
 	conversations.Get("/", s.GetConversationsOfUser)
 	conversations.Post("/", s.CreateNewIndividualConversation)
+
+	messages := r.Group("/messages", s.Auth.FiberAuthMiddleware(auth.Config{WithUser: true}))
+	messages.Delete("/:id", s.DeleteMessage)
+	messages.Post("/:id/restore", s.RestoreMessage)
 }
 
 func (s Service) GetConversationByID(ctx *fiber.Ctx) error {
@@ -52,7 +57,7 @@ func (s Service) GetConversationByID(ctx *fiber.Ctx) error {
 		})
 	}
 
-	conversation, err := s.ConvsRepo.GetConversationByID(oid)
+	conversation, err := s.ConvsRepo.GetConversationByID(ctx.UserContext(), oid)
 	if err != nil {
 		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
 			"error": "can not get conversation:" + err.Error(),
@@ -69,6 +74,7 @@ func (s Service) GetConversationsOfUser(ctx *fiber.Ctx) error {
 	switch queryType {
 	case "all":
 		conversations, err := s.ConvsRepo.GetConversationByMembers(
+			ctx.UserContext(),
 			[]primitive.ObjectID{userID})
 		if err != nil {
 			log.Println("can not get conversations:", err)
@@ -86,6 +92,7 @@ func (s Service) GetConversationsOfUser(ctx *fiber.Ctx) error {
 			})
 		}
 		conversations, err := s.ConvsRepo.GetConversationByMembers(
+			ctx.UserContext(),
 			[]primitive.ObjectID{userID, friendID},
 			repo.IndividualConversation)
 		if err != nil {
@@ -97,7 +104,7 @@ func (s Service) GetConversationsOfUser(ctx *fiber.Ctx) error {
 		return ctx.Status(http.StatusOK).JSON(conversations)
 	case "group":
 		conversations, err := s.ConvsRepo.GetConversationByMembers(
-			[]primitive.ObjectID{userID}, repo.GroupConversation)
+			ctx.UserContext(), []primitive.ObjectID{userID}, repo.GroupConversation)
 		if err != nil {
 			log.Println("can not get conversations:", err)
 			return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
@@ -152,7 +159,7 @@ func (s Service) CreateNewIndividualConversation(ctx *fiber.Ctx) error {
 				})
 			}
 
-			conv, err := s.ConvsRepo.InsertIndividualConversation(userID, friendID)
+			conv, err := s.ConvsRepo.InsertIndividualConversation(ctx.UserContext(), userID, friendID)
 			if err != nil {
 				return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
 					"error": err.Error(),
@@ -183,7 +190,7 @@ func (s Service) GetMessagesOfConversation(ctx *fiber.Ctx) error {
 			"error": "invalid limit",
 		})
 	}
-	messages, err := s.MessagesRepo.GetMessagesOfConversation(oid, int64(limit))
+	messages, err := s.MessagesRepo.GetMessagesOfConversation(ctx.UserContext(), oid, int64(limit))
 	if err != nil {
 		log.Println("can not get messages:", err)
 		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
@@ -193,3 +200,101 @@ func (s Service) GetMessagesOfConversation(ctx *fiber.Ctx) error {
 
 	return ctx.Status(http.StatusOK).JSON(messages)
 }
+
+// DeleteMessage deletes a message sent by the user, it could be restored by RestoreMessage
+func (s Service) DeleteMessage(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+	oid, err := primitive.ObjectIDFromHex(ctx.Params("id"))
+	if err != nil {
+		log.Println("invalid id:", err)
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "invalid id",
+		})
+	}
+
+	if err := s.MessagesRepo.DeleteMessageOfSender(ctx.UserContext(), oid, userID); err != nil {
+		log.Println("can not delete message:", err)
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "can not delete message",
+		})
+	}
+
+	return ctx.SendStatus(http.StatusOK)
+}
+
+func (s Service) RestoreMessage(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+	oid, err := primitive.ObjectIDFromHex(ctx.Params("id"))
+	if err != nil {
+		log.Println("invalid id:", err)
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "invalid id",
+		})
+	}
+
+	message, err := s.MessagesRepo.RestoreMessageOfSender(ctx.UserContext(), oid, userID)
+	if err != nil {
+		log.Println("can not restore message:", err)
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "can not restore message",
+		})
+	}
+
+	return ctx.Status(http.StatusOK).JSON(message)
+}
+
+// CleanUserData removes the user from conversations and anonymises messages sent by the user,
+// conversations left without members are deleted with their messages.
+// With dry run, it only counts affected documents
+func (s Service) CleanUserData(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	dryRun bool,
+) (map[string]int64, error) {
+	report := make(map[string]int64)
+
+	if dryRun {
+		conversations, err := s.ConvsRepo.CountConversationsOfMember(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		messages, err := s.MessagesRepo.CountMessagesOfUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		emptied, err := s.ConvsRepo.GetConversationIDsOnlyOfMember(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		deletedMessages, err := s.MessagesRepo.CountMessagesOfConversations(ctx, emptied)
+		if err != nil {
+			return nil, err
+		}
+		report[repo.ConversationsCollection] = conversations
+		report[repo.MessagesCollection] = messages
+		report["deletedMessages"] = deletedMessages
+
+		return report, nil
+	}
+
+	messages, err := s.MessagesRepo.AnonymiseMessagesOfUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	report[repo.MessagesCollection] = messages
+
+	conversations, emptied, err := s.ConvsRepo.RemoveMemberFromConversations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	report[repo.ConversationsCollection] = conversations
+
+	// messages of conversations deleted with the user have no one left to read them
+	deletedMessages, err := s.MessagesRepo.DeleteMessagesOfConversations(ctx, emptied)
+	if err != nil {
+		return nil, err
+	}
+	report["deletedMessages"] = deletedMessages
+
+	return report, nil
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"time"
 
+	"blinders/packages/dbutils"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -18,14 +20,24 @@ type ConversationsRepo struct {
 	*mongo.Collection
 }
 
+var ConversationsIndexes = []dbutils.IndexSpec{
+	{
+		// conversations of a user, sorted by the latest message
+		Collection: ConversationsCollection,
+		Name:       "members.userId_1_latestMessageAt_-1",
+		Keys:       bson.D{{Key: "members.userId", Value: 1}, {Key: "latestMessageAt", Value: -1}},
+	},
+}
+
 func NewConversationsRepo(db *mongo.Database) *ConversationsRepo {
 	return &ConversationsRepo{db.Collection(ConversationsCollection)}
 }
 
 func (r *ConversationsRepo) GetConversationByID(
+	ctx context.Context,
 	id primitive.ObjectID,
 ) (*Conversation, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
 	var conversation Conversation
@@ -36,10 +48,11 @@ func (r *ConversationsRepo) GetConversationByID(
 
 // get by all types by default
 func (r *ConversationsRepo) GetConversationByMembers(
+	ctx context.Context,
 	members []primitive.ObjectID,
 	convTypes ...ConversationType,
 ) (*[]Conversation, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
 	filter := bson.M{"members": bson.M{"$all": []bson.M{}}}
@@ -71,9 +84,10 @@ func (r *ConversationsRepo) GetConversationByMembers(
 }
 
 func (r *ConversationsRepo) InsertNewConversation(
+	ctx context.Context,
 	c Conversation,
 ) (*Conversation, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
 	_, err := r.InsertOne(ctx, c)
@@ -83,6 +97,7 @@ func (r *ConversationsRepo) InsertNewConversation(
 
 // this function creates new ID and time and insert the document to database
 func (r *ConversationsRepo) InsertNewRawConversation(
+	ctx context.Context,
 	conversation Conversation,
 ) (*Conversation, error) {
 	conversation.ID = primitive.NewObjectID()
@@ -90,13 +105,41 @@ func (r *ConversationsRepo) InsertNewRawConversation(
 	conversation.CreatedAt = now
 	conversation.UpdatedAt = now
 
-	return r.InsertNewConversation(conversation)
+	return r.InsertNewConversation(ctx, conversation)
+}
+
+// UpdateLatestMessage moves the conversation to the top of conversations of its members
+func (r *ConversationsRepo) UpdateLatestMessage(
+	ctx context.Context,
+	conversationID primitive.ObjectID,
+	message Message,
+) error {
+	ctx, cal := dbutils.WithTimeout(ctx)
+	defer cal()
+
+	result, err := r.UpdateOne(ctx,
+		bson.M{"_id": conversationID},
+		bson.M{"$set": bson.M{
+			"latestMessageAt": message.CreatedAt,
+			"latestMessageId": message.ID,
+			"updatedAt":       primitive.NewDateTimeFromTime(time.Now()),
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
 }
 
 func (r *ConversationsRepo) InsertIndividualConversation(
+	ctx context.Context,
 	userID, friendID primitive.ObjectID,
 ) (*Conversation, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
 	upsert := true
@@ -143,7 +186,77 @@ func (r *ConversationsRepo) InsertIndividualConversation(
 		return nil, fmt.Errorf("conversation already existed")
 	}
 
-	conv, err := r.GetConversationByID(result.UpsertedID.(primitive.ObjectID))
+	conv, err := r.GetConversationByID(ctx, result.UpsertedID.(primitive.ObjectID))
 
 	return conv, err
 }
+
+// RemoveMemberFromConversations pulls the user out of all conversations and
+// deletes conversations that have no members left.
+// It returns the number of conversations the user was removed from and IDs of the deleted conversations
+func (r *ConversationsRepo) RemoveMemberFromConversations(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, []primitive.ObjectID, error) {
+	ctx, cal := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cal()
+
+	emptied, err := r.GetConversationIDsOnlyOfMember(ctx, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	result, err := r.UpdateMany(ctx,
+		bson.M{"members.userId": userID},
+		bson.M{
+			"$pull": bson.M{"members": bson.M{"userId": userID}},
+			"$set":  bson.M{"updatedAt": primitive.NewDateTimeFromTime(time.Now())},
+		},
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	_, err = r.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": emptied}, "members": bson.M{"$size": 0}})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return result.ModifiedCount, emptied, nil
+}
+
+// GetConversationIDsOnlyOfMember returns IDs of conversations whose only member is the user,
+// they are deleted when the user is removed from conversations
+func (r *ConversationsRepo) GetConversationIDsOnlyOfMember(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) ([]primitive.ObjectID, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
+	defer cal()
+
+	values, err := r.Distinct(ctx, "_id", bson.M{
+		"members.userId": userID,
+		"members":        bson.M{"$size": 1},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *ConversationsRepo) CountConversationsOfMember(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
+	defer cal()
+
+	return r.CountDocuments(ctx, bson.M{"members.userId": userID})
+}
@@ -1,6 +1,7 @@
 package repo_test
 
 import (
+	"context"
 	"testing"
 
 	dbutils "blinders/packages/dbutils"
@@ -15,16 +16,19 @@ var (
 	mongoClient, _ = dbutils.InitMongoClient("mongodb://localhost:27017")
 	convRepo       = repo.NewConversationsRepo(mongoClient.Database("blinders"))
 	usersRepo      = usersrepo.NewUsersRepo(mongoClient.Database("blinders"))
+	messagesRepo   = repo.NewMessagesRepo(mongoClient.Database("blinders"))
 )
 
 func TestInsertIndividualConversationSuccess(t *testing.T) {
 	user, _ := usersRepo.InsertNewRawUser(
+		context.Background(),
 		usersrepo.User{FirebaseUID: primitive.NewObjectID().Hex()},
 	)
 	friend, _ := usersRepo.InsertNewRawUser(
+		context.Background(),
 		usersrepo.User{FirebaseUID: primitive.NewObjectID().Hex()},
 	)
-	conv, err := convRepo.InsertIndividualConversation(user.ID, friend.ID)
+	conv, err := convRepo.InsertIndividualConversation(context.Background(), user.ID, friend.ID)
 	assert.Nil(t, err)
 	assert.Equal(t, len(conv.Members), 2)
 	assert.Equal(t, conv.CreatedBy, user.ID)
@@ -35,28 +39,32 @@ func TestInsertIndividualConversationSuccess(t *testing.T) {
 
 func TestInsertIndividualConversationFailedWithDuplicatedConversation(t *testing.T) {
 	user, _ := usersRepo.InsertNewRawUser(
+		context.Background(),
 		usersrepo.User{FirebaseUID: primitive.NewObjectID().Hex()},
 	)
 	friend, _ := usersRepo.InsertNewRawUser(
+		context.Background(),
 		usersrepo.User{FirebaseUID: primitive.NewObjectID().Hex()},
 	)
-	_, err := convRepo.InsertIndividualConversation(user.ID, friend.ID)
+	_, err := convRepo.InsertIndividualConversation(context.Background(), user.ID, friend.ID)
 	assert.Nil(t, err)
-	conv, err := convRepo.InsertIndividualConversation(user.ID, friend.ID)
+	conv, err := convRepo.InsertIndividualConversation(context.Background(), user.ID, friend.ID)
 	assert.NotNil(t, err)
 	assert.Nil(t, conv)
 }
 
 func TestGetConversationWithAFriend(t *testing.T) {
 	user, _ := usersRepo.InsertNewRawUser(
+		context.Background(),
 		usersrepo.User{FirebaseUID: primitive.NewObjectID().Hex()},
 	)
 	friend, _ := usersRepo.InsertNewRawUser(
+		context.Background(),
 		usersrepo.User{FirebaseUID: primitive.NewObjectID().Hex()},
 	)
-	conv, _ := convRepo.InsertIndividualConversation(user.ID, friend.ID)
+	conv, _ := convRepo.InsertIndividualConversation(context.Background(), user.ID, friend.ID)
 	conversations, err := convRepo.GetConversationByMembers(
-		[]primitive.ObjectID{user.ID, friend.ID}, repo.IndividualConversation,
+		context.Background(), []primitive.ObjectID{user.ID, friend.ID}, repo.IndividualConversation,
 	)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(*conversations))
@@ -64,3 +72,45 @@ func TestGetConversationWithAFriend(t *testing.T) {
 		assert.Equal(t, conv.ID, (*conversations)[0].ID)
 	}
 }
+
+func TestRemoveMemberFromConversations(t *testing.T) {
+	user, _ := usersRepo.InsertNewRawUser(
+		context.Background(),
+		usersrepo.User{FirebaseUID: primitive.NewObjectID().Hex()},
+	)
+	friend, _ := usersRepo.InsertNewRawUser(
+		context.Background(),
+		usersrepo.User{FirebaseUID: primitive.NewObjectID().Hex()},
+	)
+	conv, err := convRepo.InsertIndividualConversation(context.Background(), user.ID, friend.ID)
+	assert.Nil(t, err)
+	_, err = messagesRepo.InsertNewRawMessage(
+		context.Background(),
+		messagesRepo.ConstructNewMessage(user.ID, conv.ID, primitive.NilObjectID, "hello"),
+	)
+	assert.Nil(t, err)
+
+	// the friend is still a member, the conversation and its messages are kept
+	removed, emptied, err := convRepo.RemoveMemberFromConversations(context.Background(), user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+	assert.Empty(t, emptied)
+
+	ids, err := convRepo.GetConversationIDsOnlyOfMember(context.Background(), friend.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []primitive.ObjectID{conv.ID}, ids)
+	count, err := messagesRepo.CountMessagesOfConversations(context.Background(), ids)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+
+	removed, emptied, err = convRepo.RemoveMemberFromConversations(context.Background(), friend.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+	assert.Equal(t, []primitive.ObjectID{conv.ID}, emptied)
+	_, err = convRepo.GetConversationByID(context.Background(), conv.ID)
+	assert.NotNil(t, err)
+
+	deleted, err := messagesRepo.DeleteMessagesOfConversations(context.Background(), emptied)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
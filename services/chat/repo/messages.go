@@ -5,6 +5,8 @@ import (
 	"log"
 	"time"
 
+	"blinders/packages/dbutils"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -17,6 +19,27 @@ type MessagesRepo struct {
 	*mongo.Collection
 }
 
+var MessagesIndexes = []dbutils.IndexSpec{
+	{
+		// latest messages of a conversation
+		Collection: MessagesCollection,
+		Name:       "conversationId_1_createdAt_-1",
+		Keys:       bson.D{{Key: "conversationId", Value: 1}, {Key: "createdAt", Value: -1}},
+	},
+	{
+		Collection: MessagesCollection,
+		Name:       "senderId_1",
+		Keys:       bson.D{{Key: "senderId", Value: 1}},
+	},
+}
+
+type MessageEvent = dbutils.ChangeEvent[Message]
+
+// OnMessageChanged subscribes the handler to changes of messages, new messages are insert events
+func OnMessageChanged(bus *dbutils.ChangeBus, handler func(ctx context.Context, event MessageEvent) error) {
+	dbutils.Subscribe(bus, MessagesCollection, handler)
+}
+
 func NewMessagesRepo(db *mongo.Database) *MessagesRepo {
 	return &MessagesRepo{db.Collection(MessagesCollection)}
 }
@@ -45,18 +68,18 @@ func (r MessagesRepo) ConstructNewMessage(
 	}
 }
 
-func (r *MessagesRepo) GetMessageByID(id primitive.ObjectID) (Message, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+func (r *MessagesRepo) GetMessageByID(ctx context.Context, id primitive.ObjectID) (Message, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
 	var message Message
-	err := r.FindOne(ctx, bson.M{"_id": id}).Decode(&message)
+	err := r.FindOne(ctx, dbutils.NotDeleted(bson.M{"_id": id})).Decode(&message)
 
 	return message, err
 }
 
-func (r *MessagesRepo) InsertNewMessage(m Message) (Message, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+func (r *MessagesRepo) InsertNewMessage(ctx context.Context, m Message) (Message, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
 	_, err := r.InsertOne(ctx, m)
@@ -65,22 +88,23 @@ func (r *MessagesRepo) InsertNewMessage(m Message) (Message, error) {
 }
 
 // this function creates new ID and time and insert the document to database
-func (r *MessagesRepo) InsertNewRawMessage(m Message) (Message, error) {
+func (r *MessagesRepo) InsertNewRawMessage(ctx context.Context, m Message) (Message, error) {
 	m.ID = primitive.NewObjectID()
 	now := primitive.NewDateTimeFromTime(time.Now())
 	m.CreatedAt = now
 	m.UpdatedAt = now
 
-	return r.InsertNewMessage(m)
+	return r.InsertNewMessage(ctx, m)
 }
 
 func (r *MessagesRepo) GetMessagesOfConversation(
+	ctx context.Context,
 	conversationID primitive.ObjectID, limit int64,
 ) (*[]Message, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
-	filter := bson.M{"conversationId": conversationID}
+	filter := dbutils.NotDeleted(bson.M{"conversationId": conversationID})
 	messages := make([]Message, 0)
 	cur, err := r.Find(ctx, filter,
 		&options.FindOptions{Sort: bson.M{"createdAt": -1}, Limit: &limit})
@@ -96,3 +120,121 @@ func (r *MessagesRepo) GetMessagesOfConversation(
 
 	return &messages, nil
 }
+
+// DeleteMessageOfSender soft deletes the message if it is sent by the sender
+func (r *MessagesRepo) DeleteMessageOfSender(
+	ctx context.Context,
+	id primitive.ObjectID,
+	senderID primitive.ObjectID,
+) error {
+	ctx, cal := dbutils.WithTimeout(ctx)
+	defer cal()
+
+	filter := dbutils.NotDeleted(bson.M{"_id": id, "senderId": senderID})
+	result, err := r.UpdateOne(ctx, filter, dbutils.SoftDeleteUpdate(ctx))
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// RestoreMessageOfSender restores the deleted message if it is sent by the sender
+func (r *MessagesRepo) RestoreMessageOfSender(
+	ctx context.Context,
+	id primitive.ObjectID,
+	senderID primitive.ObjectID,
+) (Message, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
+	defer cal()
+
+	filter := bson.M{"_id": id, "senderId": senderID, "deletedAt": bson.M{"$exists": true}}
+	var message Message
+	err := r.FindOneAndUpdate(ctx, filter, dbutils.RestoreUpdate(ctx),
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&message)
+
+	return message, err
+}
+
+// AnonymiseMessagesOfUser keeps messages in the conversation history of other members
+// but removes the sender and the content of messages sent by the user,
+// emotions of the user are removed as well.
+// It returns the number of anonymised messages
+func (r *MessagesRepo) AnonymiseMessagesOfUser(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cal := dbutils.WithTimeout(ctx, time.Second*10)
+	defer cal()
+
+	result, err := r.UpdateMany(ctx,
+		bson.M{"senderId": userID},
+		bson.M{"$set": bson.M{
+			"senderId":  primitive.NilObjectID,
+			"content":   "",
+			"updatedAt": primitive.NewDateTimeFromTime(time.Now()),
+		}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = r.UpdateMany(ctx,
+		bson.M{"emotions.senderId": userID},
+		bson.M{"$pull": bson.M{"emotions": bson.M{"senderId": userID}}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *MessagesRepo) CountMessagesOfUser(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cal := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cal()
+
+	return r.CountDocuments(ctx, bson.M{"senderId": userID})
+}
+
+// DeleteMessagesOfConversations deletes all messages of the conversations, e.g. of deleted conversations.
+// It returns the number of deleted messages
+func (r *MessagesRepo) DeleteMessagesOfConversations(
+	ctx context.Context,
+	conversationIDs []primitive.ObjectID,
+) (int64, error) {
+	if len(conversationIDs) == 0 {
+		return 0, nil
+	}
+
+	ctx, cal := dbutils.WithTimeout(ctx, time.Second*10)
+	defer cal()
+
+	result, err := r.DeleteMany(ctx, bson.M{"conversationId": bson.M{"$in": conversationIDs}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (r *MessagesRepo) CountMessagesOfConversations(
+	ctx context.Context,
+	conversationIDs []primitive.ObjectID,
+) (int64, error) {
+	if len(conversationIDs) == 0 {
+		return 0, nil
+	}
+
+	ctx, cal := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cal()
+
+	return r.CountDocuments(ctx, bson.M{"conversationId": bson.M{"$in": conversationIDs}})
+}
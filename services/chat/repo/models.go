@@ -17,6 +17,9 @@ type Conversation struct {
 	CreatedAt primitive.DateTime    `bson:"createdAt"          json:"createdAt"`
 	UpdatedAt primitive.DateTime    `bson:"updatedAt"          json:"updatedAt"`
 	Metadata  *ConversationMetadata `bson:"metadata,omitempty" json:"metadata,omitempty"`
+	// LatestMessageAt orders conversations of a user, it is updated with each sent message
+	LatestMessageAt *primitive.DateTime `bson:"latestMessageAt,omitempty" json:"latestMessageAt,omitempty"`
+	LatestMessageID *primitive.ObjectID `bson:"latestMessageId,omitempty" json:"latestMessageId,omitempty"`
 }
 
 type ConversationMetadata struct {
@@ -42,15 +45,17 @@ const (
 )
 
 type Message struct {
-	ID             primitive.ObjectID  `bson:"_id"               json:"id"`
-	SenderID       primitive.ObjectID  `bson:"senderId"          json:"senderId"`
-	ConversationID primitive.ObjectID  `bson:"conversationId"    json:"conversationId"`
-	ReplyTo        *primitive.ObjectID `bson:"replyTo,omitempty" json:"replyTo,omitempty"`
-	Content        string              `bson:"content"           json:"content"`
-	Status         MessageStatus       `bson:"status"            json:"status"`
-	CreatedAt      primitive.DateTime  `bson:"createdAt"         json:"createdAt"`
-	UpdatedAt      primitive.DateTime  `bson:"updatedAt"         json:"updatedAt"`
-	Emotions       []MessageEmotion    `bson:"emotions"          json:"emotions"`
+	ID             primitive.ObjectID  `bson:"_id"                 json:"id"`
+	SenderID       primitive.ObjectID  `bson:"senderId"            json:"senderId"`
+	ConversationID primitive.ObjectID  `bson:"conversationId"      json:"conversationId"`
+	ReplyTo        *primitive.ObjectID `bson:"replyTo,omitempty"   json:"replyTo,omitempty"`
+	Content        string              `bson:"content"             json:"content"`
+	Status         MessageStatus       `bson:"status"              json:"status"`
+	CreatedAt      primitive.DateTime  `bson:"createdAt"           json:"createdAt"`
+	UpdatedAt      primitive.DateTime  `bson:"updatedAt"           json:"updatedAt"`
+	Emotions       []MessageEmotion    `bson:"emotions"            json:"emotions"`
+	DeletedAt      *primitive.DateTime `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	DeletedBy      *primitive.ObjectID `bson:"deletedBy,omitempty" json:"deletedBy,omitempty"`
 }
 
 type MessageEmotion struct {
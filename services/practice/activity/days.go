@@ -0,0 +1,109 @@
+package activity
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DayLayout formats local dates of activity logs, days in this layout are ordered as strings
+const DayLayout = "2006-01-02"
+
+const (
+	DefaultRangeDays = 30
+	MaxRangeDays     = 365
+)
+
+var ErrInvalidRange = errors.New("range must be a number of days like 30d, at most 365d")
+
+// Day returns the local date of the time in the location
+func Day(at time.Time, loc *time.Location) string {
+	return at.In(loc).Format(DayLayout)
+}
+
+// StartOfDay returns the local midnight of the day of the time in the location
+func StartOfDay(at time.Time, loc *time.Location) time.Time {
+	local := at.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
+
+// AddDays moves the day by n days, the day must be in DayLayout
+func AddDays(day string, n int) (string, error) {
+	t, err := time.Parse(DayLayout, day)
+	if err != nil {
+		return "", err
+	}
+	return t.AddDate(0, 0, n).Format(DayLayout), nil
+}
+
+// LastDays returns the n days ending with the day of the time in the location, oldest first
+func LastDays(at time.Time, loc *time.Location, n int) []string {
+	// noon avoids skipping or repeating days on daylight saving changes
+	local := at.In(loc)
+	noon := time.Date(local.Year(), local.Month(), local.Day(), 12, 0, 0, 0, time.UTC)
+
+	days := make([]string, n)
+	for i := 0; i < n; i++ {
+		days[i] = noon.AddDate(0, 0, i-n+1).Format(DayLayout)
+	}
+	return days
+}
+
+// ParseRange parses ranges like "30d" to the number of days, an empty range is DefaultRangeDays
+func ParseRange(value string) (int, error) {
+	if value == "" {
+		return DefaultRangeDays, nil
+	}
+
+	days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+	if err != nil || !strings.HasSuffix(value, "d") || days <= 0 || days > MaxRangeDays {
+		return 0, ErrInvalidRange
+	}
+	return days, nil
+}
+
+// Streak counts the consecutive active days ending today, days are the active days most recent first.
+// The streak is kept if the last active day is yesterday, it is broken once a day is missed
+func Streak(days []string, today string) int {
+	if len(days) == 0 {
+		return 0
+	}
+
+	expected := today
+	if days[0] != today {
+		yesterday, err := AddDays(today, -1)
+		if err != nil || days[0] != yesterday {
+			return 0
+		}
+		expected = yesterday
+	}
+
+	streak := 0
+	for _, day := range days {
+		if day != expected {
+			break
+		}
+		streak++
+
+		var err error
+		if expected, err = AddDays(expected, -1); err != nil {
+			break
+		}
+	}
+	return streak
+}
+
+// LongestStreak returns the most consecutive active days, active tells if each day of a range is active
+func LongestStreak(active []bool) int {
+	longest, current := 0, 0
+	for _, isActive := range active {
+		if !isActive {
+			current = 0
+			continue
+		}
+		current++
+		longest = max(longest, current)
+	}
+	return longest
+}
@@ -0,0 +1,79 @@
+package activity_test
+
+import (
+	"testing"
+	"time"
+
+	"blinders/services/practice/activity"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDay(t *testing.T) {
+	at := time.Date(2024, time.May, 1, 20, 0, 0, 0, time.UTC)
+	hcm, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "2024-05-01", activity.Day(at, time.UTC))
+	assert.Equal(t, "2024-05-02", activity.Day(at, hcm))
+}
+
+func TestStartOfDay(t *testing.T) {
+	at := time.Date(2024, time.May, 1, 20, 0, 0, 0, time.UTC)
+	hcm, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	assert.NoError(t, err)
+
+	assert.True(t, time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC).Equal(activity.StartOfDay(at, time.UTC)))
+	// 20:00 UTC is 03:00 of the next day in Ho Chi Minh (UTC+7), the day started at 17:00 UTC
+	assert.True(t, time.Date(2024, time.May, 1, 17, 0, 0, 0, time.UTC).Equal(activity.StartOfDay(at, hcm)))
+}
+
+func TestLastDays(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	// daylight saving starts on 2024-03-10 in New York
+	at := time.Date(2024, time.March, 11, 2, 0, 0, 0, time.UTC)
+	assert.Equal(t, []string{"2024-03-08", "2024-03-09", "2024-03-10"}, activity.LastDays(at, newYork, 3))
+	assert.Equal(t, []string{"2024-03-11"}, activity.LastDays(at, time.UTC, 1))
+}
+
+func TestParseRange(t *testing.T) {
+	days, err := activity.ParseRange("")
+	assert.NoError(t, err)
+	assert.Equal(t, activity.DefaultRangeDays, days)
+
+	days, err = activity.ParseRange("7d")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, days)
+
+	for _, invalid := range []string{"7", "d", "0d", "-1d", "366d", "1w"} {
+		_, err := activity.ParseRange(invalid)
+		assert.Equal(t, activity.ErrInvalidRange, err, invalid)
+	}
+}
+
+func TestStreak(t *testing.T) {
+	tests := []struct {
+		name   string
+		days   []string
+		streak int
+	}{
+		{"no activity", nil, 0},
+		{"today", []string{"2024-05-01", "2024-04-30", "2024-04-28"}, 2},
+		{"until yesterday", []string{"2024-04-30", "2024-04-29"}, 2},
+		{"broken", []string{"2024-04-29", "2024-04-28"}, 0},
+		{"across months", []string{"2024-05-01", "2024-04-30", "2024-04-29", "2024-04-28"}, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.streak, activity.Streak(test.days, "2024-05-01"))
+		})
+	}
+}
+
+func TestLongestStreak(t *testing.T) {
+	assert.Equal(t, 0, activity.LongestStreak(nil))
+	assert.Equal(t, 3, activity.LongestStreak([]bool{true, false, true, true, true, false, true}))
+}
@@ -0,0 +1,154 @@
+package practice
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"blinders/packages/auth"
+	"blinders/services/practice/repo"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExplainLogSyncBatch is the max number of explain logs turned into flashcards by one sync
+const ExplainLogSyncBatch = 100
+
+const ExplainLogCollectionName = "From explanations"
+
+// ExplainLogSyncResult has the flashcards added by a sync, HasMore is set if explain logs are left for the next sync
+type ExplainLogSyncResult struct {
+	Collection *repo.FlashcardCollection `json:"collection"`
+	Added      []*repo.Flashcard         `json:"added"`
+	HasMore    bool                      `json:"hasMore"`
+}
+
+// SyncExplainLogFlashcards turns explain logs of the user created since the snapshot into flashcards
+// of the explain log collection of the user. Logs which already have flashcards are skipped,
+// the flashcards and the snapshot are written in one transaction
+func (s Service) SyncExplainLogFlashcards(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (*ExplainLogSyncResult, error) {
+	var result *ExplainLogSyncResult
+	err := s.Tx.WithTransaction(ctx, func(txCtx context.Context) error {
+		var err error
+		result, err = s.syncExplainLogFlashcards(txCtx, userID)
+		return err
+	})
+
+	return result, err
+}
+
+func (s Service) syncExplainLogFlashcards(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (*ExplainLogSyncResult, error) {
+	var (
+		after   primitive.DateTime
+		afterID primitive.ObjectID
+	)
+	snapshot, err := s.SnapshotRepo.GetSnapshotOfUserByType(ctx, userID, repo.ExplainLogToFlashcardSnapshotType)
+	switch {
+	case err == nil:
+		after, afterID = snapshot.Current, snapshot.CurrentID
+	case err != mongo.ErrNoDocuments:
+		return nil, err
+	}
+
+	// synced logs are not read again, so flashcards deleted by the user are not recreated
+	logs, err := s.ExplainLogRepo.GetByUserIDAfter(ctx, userID, after, afterID, ExplainLogSyncBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := s.FlashcardRepo.GetOrCreateCollectionOfType(ctx, userID,
+		repo.FromExplainLogCollectionType, ExplainLogCollectionName)
+	if err != nil {
+		return nil, err
+	}
+	result := &ExplainLogSyncResult{
+		Collection: collection,
+		Added:      []*repo.Flashcard{},
+		HasMore:    len(logs) == ExplainLogSyncBatch,
+	}
+	if len(logs) == 0 {
+		return result, nil
+	}
+
+	logIDs := make([]primitive.ObjectID, len(logs))
+	for idx, explainLog := range logs {
+		logIDs[idx] = explainLog.ID
+	}
+	synced, err := s.FlashcardRepo.GetExplainLogIDsOfUser(ctx, userID, logIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	flashcards := make([]*repo.Flashcard, 0, len(logs))
+	for _, explainLog := range logs {
+		if slices.Contains(synced, explainLog.ID) || explainLog.Phrase == "" {
+			continue
+		}
+		flashcards = append(flashcards, ExplainLogToFlashcard(explainLog))
+	}
+
+	if len(flashcards) > 0 {
+		result.Added, err = s.FlashcardRepo.AddFlashcardsToCollection(ctx, collection.ID, flashcards)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	last := logs[len(logs)-1]
+	_, err = s.SnapshotRepo.AdvanceSnapshot(ctx, userID, repo.ExplainLogToFlashcardSnapshotType, last.CreatedAt, last.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ExplainLogToFlashcard makes a flashcard of the phrase, the back has the translation and grammar,
+// the sentence of the explanation is the example of the flashcard
+func ExplainLogToFlashcard(explainLog *repo.ExplainLog) *repo.Flashcard {
+	response := explainLog.Response
+	back := []string{response.Translate}
+	if tense := response.GrammarAnalysis.Tense.Type; tense != "" {
+		back = append(back, "Tense: "+tense)
+	}
+	if structure := response.GrammarAnalysis.Structure.Structure; structure != "" {
+		back = append(back, "Structure: "+structure)
+	}
+
+	flashcard := &repo.Flashcard{
+		Type:      repo.ExplainLogToFlashcardType,
+		Kind:      repo.BasicCardKind,
+		FrontText: explainLog.Phrase,
+		BackText:  strings.Join(back, "\n"),
+		IPA:       strings.Trim(response.IPA, "/"),
+		Metadata:  &repo.FlashcardMetadata{ExplainLogID: explainLog.ID},
+	}
+	if explainLog.Sentence != "" {
+		flashcard.Examples = []string{explainLog.Sentence}
+	}
+
+	return flashcard
+}
+
+// HandleSyncExplainLogFlashcards makes flashcards of explain logs of the user since the last sync
+func (s Service) HandleSyncExplainLogFlashcards(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+
+	result, err := s.SyncExplainLogFlashcards(ctx.UserContext(), userID)
+	if err != nil {
+		log.Println("cannot sync flashcards from explain logs", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot sync flashcards from explain logs"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(result)
+}
@@ -0,0 +1,108 @@
+package practice_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blinders/packages/dbutils"
+	"blinders/services/practice"
+	"blinders/services/practice/repo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	mongoTestURL    = "mongodb://localhost:27017"
+	mongoTestDBName = "blinders-test"
+	client          *mongo.Client
+)
+
+func TestSyncExplainLogFlashcards(t *testing.T) {
+	s := GetPracticeTestService(t)
+	defer CleanPracticeTestService(t, s)
+
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	createdAt := primitive.NewDateTimeFromTime(time.Now().Truncate(time.Millisecond))
+
+	// logs created at the same time are synced once each
+	for _, phrase := range []string{"first", "second", ""} {
+		_, err := s.ExplainLogRepo.InsertOne(ctx, &repo.ExplainLog{
+			RawModel: dbutils.RawModel{ID: primitive.NewObjectID(), CreatedAt: createdAt, UpdatedAt: createdAt},
+			UserID:   userID,
+			Phrase:   phrase,
+			Sentence: "sentence of " + phrase,
+		})
+		assert.Nil(t, err)
+	}
+
+	result, err := s.SyncExplainLogFlashcards(ctx, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, repo.FromExplainLogCollectionType, result.Collection.Type)
+	assert.Len(t, result.Added, 2)
+	assert.False(t, result.HasMore)
+
+	// the user deletes a flashcard, it is not recreated by the next sync
+	collectionID := result.Collection.ID
+	assert.Nil(t, s.FlashcardRepo.DeleteFlashCard(ctx, collectionID, result.Added[0].ID))
+
+	result, err = s.SyncExplainLogFlashcards(ctx, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, collectionID, result.Collection.ID)
+	assert.Empty(t, result.Added)
+	assert.Equal(t, int64(1), result.Collection.TotalCount)
+
+	_, err = s.ExplainLogRepo.InsertRaw(ctx, &repo.ExplainLog{UserID: userID, Phrase: "third"})
+	assert.Nil(t, err)
+
+	result, err = s.SyncExplainLogFlashcards(ctx, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, collectionID, result.Collection.ID)
+	assert.Len(t, result.Added, 1)
+	assert.Equal(t, "third", result.Added[0].FrontText)
+
+	collections, err := s.FlashcardRepo.GetCollectionsByType(ctx, userID, repo.FromExplainLogCollectionType)
+	assert.Nil(t, err)
+	assert.Len(t, collections, 1)
+
+	snapshots, err := s.SnapshotRepo.CountByUserID(ctx, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), snapshots)
+}
+
+func GetPracticeTestService(t *testing.T) *practice.Service {
+	t.Helper()
+	if client == nil {
+		var err error
+		client, err = dbutils.InitMongoClient(mongoTestURL)
+		assert.NoError(t, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err := client.Ping(ctx, nil)
+	assert.NoError(t, err)
+
+	db := client.Database(mongoTestDBName)
+	assert.NoError(t, dbutils.EnsureIndexes(ctx, db, repo.SnapshotsUniqueIndexes...))
+
+	return practice.NewService(nil, db)
+}
+
+func CleanPracticeTestService(t *testing.T, s *practice.Service) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	for _, col := range []*mongo.Collection{
+		s.FlashcardRepo.Collection,
+		s.FlashcardRepo.Cards.Collection,
+		s.SnapshotRepo.Collection,
+		s.ExplainLogRepo.Collection,
+	} {
+		assert.NoError(t, col.Drop(ctx))
+	}
+}
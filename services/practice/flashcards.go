@@ -1,10 +1,15 @@
 package practice
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"strconv"
 
 	"blinders/packages/auth"
+	"blinders/packages/dbutils"
 	"blinders/packages/utils"
 	"blinders/services/practice/repo"
 
@@ -18,10 +23,12 @@ func (s Service) HandleGetFlashcardCollections(ctx *fiber.Ctx) error {
 	var err error
 	var collections []*repo.FlashcardCollection
 
-	if ctx.Query("preview") == "true" {
-		collections, err = s.FlashcardRepo.GetCollectionsMetadataByUserID(userID)
+	if tag := ctx.Query("tag"); tag != "" {
+		collections, err = s.FlashcardRepo.GetByUserIDAndTag(ctx.UserContext(), userID, tag)
+	} else if ctx.Query("preview") == "true" {
+		collections, err = s.FlashcardRepo.GetCollectionsMetadataByUserID(ctx.UserContext(), userID)
 	} else {
-		collections, err = s.FlashcardRepo.GetByUserID(userID)
+		collections, err = s.FlashcardRepo.GetByUserID(ctx.UserContext(), userID)
 	}
 
 	if err != nil {
@@ -33,15 +40,75 @@ func (s Service) HandleGetFlashcardCollections(ctx *fiber.Ctx) error {
 	return ctx.Status(fiber.StatusOK).JSON(collections)
 }
 
+// HandleGetFlashcardCollectionByID returns the collection with its flashcards and their counts (of the `tag`
+// query param if set). Flashcards of large collections could be paged by HandleGetFlashcardsOfCollection
 func (s Service) HandleGetFlashcardCollectionByID(ctx *fiber.Ctx) error {
 	collection, ok := ctx.Locals(CollectionKey).(*repo.FlashcardCollection)
 	if !ok {
 		log.Fatalln("cannot get collection from context")
 	}
 
+	collection, err := s.FlashcardRepo.GetCollectionWithFlashcards(ctx.UserContext(), collection.ID, ctx.Query("tag"))
+	if err != nil {
+		log.Println("cannot get flashcard collection", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot get flashcard collection"})
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(collection)
 }
 
+const (
+	DefaultFlashcardPageLimit = 50
+	MaxFlashcardPageLimit     = 200
+)
+
+var (
+	errInvalidCursor = errors.New("invalid cursor")
+	errInvalidLimit  = errors.New("invalid limit")
+)
+
+// flashcardPageOptions parses `cursor` and `limit` query params of pages of flashcards
+func flashcardPageOptions(ctx *fiber.Ctx) (dbutils.ListOptions, error) {
+	var cursor primitive.ObjectID
+	if c := ctx.Query("cursor"); c != "" {
+		oid, err := primitive.ObjectIDFromHex(c)
+		if err != nil {
+			return dbutils.ListOptions{}, errInvalidCursor
+		}
+		cursor = oid
+	}
+
+	limit, err := strconv.Atoi(ctx.Query("limit", strconv.Itoa(DefaultFlashcardPageLimit)))
+	if err != nil || limit <= 0 {
+		return dbutils.ListOptions{}, errInvalidLimit
+	}
+
+	return dbutils.ListOptions{Cursor: cursor, Limit: int64(min(limit, MaxFlashcardPageLimit))}, nil
+}
+
+// HandleGetFlashcardsOfCollection pages flashcards of the collection with `cursor` and `limit` query params,
+// oldest first. The `tag` query param filters them by tag
+func (s Service) HandleGetFlashcardsOfCollection(ctx *fiber.Ctx) error {
+	collection, ok := ctx.Locals(CollectionKey).(*repo.FlashcardCollection)
+	if !ok {
+		log.Fatalln("cannot get collection from context")
+	}
+
+	opts, err := flashcardPageOptions(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := s.FlashcardRepo.GetFlashcardsOfCollection(ctx.UserContext(), collection.ID, ctx.Query("tag"), opts)
+	if err != nil {
+		log.Println("cannot get flashcards", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot get flashcards"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(page)
+}
+
 func (s Service) HandleCreateFlashcardCollection(ctx *fiber.Ctx) error {
 	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
 
@@ -54,8 +121,23 @@ func (s Service) HandleCreateFlashcardCollection(ctx *fiber.Ctx) error {
 
 	collection.Type = repo.ManualCollectionType
 	collection.UserID = userID
-
-	inserted, err := s.FlashcardRepo.InsertRaw(collection)
+	// new collections are private, they are shared by updating the visibility
+	collection.Visibility = repo.PrivateVisibility
+	collection.ShareToken = ""
+	collection.ClonedFrom = nil
+	flashcards, err := newFlashcardsOf(collection.FlashCards)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	collection.FlashCards = flashcards
+
+	// the collection and its cards are inserted together
+	var inserted *repo.FlashcardCollection
+	err = s.Tx.WithTransaction(ctx.UserContext(), func(txCtx context.Context) error {
+		var err error
+		inserted, err = s.FlashcardRepo.InsertRaw(txCtx, collection)
+		return err
+	})
 	if err != nil {
 		log.Println("cannot insert flashcard collection:", err)
 		return ctx.Status(fiber.StatusBadRequest).
@@ -89,7 +171,7 @@ func (s Service) HandleUpdateFlashcardCollectionByID(ctx *fiber.Ctx) error {
 		Metadata:    newCollection.Metadata,
 	}
 
-	err = s.FlashcardRepo.UpdateCollectionMetadata(collection.ID, updateCollection)
+	err = s.FlashcardRepo.UpdateCollectionMetadata(ctx.UserContext(), collection.ID, updateCollection)
 	if err != nil {
 		log.Println("cannot update collection metadata:", err)
 		return ctx.Status(fiber.StatusBadRequest).
@@ -103,7 +185,11 @@ func (s Service) HandleDeleteFlashcardCollectionByID(ctx *fiber.Ctx) error {
 	if !ok {
 		log.Fatalln("cannot get collection from context")
 	}
-	err := s.FlashcardRepo.DeleteByID(collection.ID)
+	if collection.Type == repo.DefaultCollectionType || collection.ID == collection.UserID {
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot delete default collection"})
+	}
+	err := s.FlashcardRepo.DeleteByID(ctx.UserContext(), collection.ID)
 	if err != nil {
 		log.Println("cannot delete flashcard", err)
 		return ctx.Status(fiber.StatusBadRequest).
@@ -113,10 +199,125 @@ func (s Service) HandleDeleteFlashcardCollectionByID(ctx *fiber.Ctx) error {
 	return ctx.SendStatus(fiber.StatusOK)
 }
 
+// HandleRestoreFlashcardCollectionByID restores a deleted collection of the user,
+// deleted collections are not found by ValidateOwnership so the owner is checked by the repo
+func (s Service) HandleRestoreFlashcardCollectionByID(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+	collectionID, err := primitive.ObjectIDFromHex(ctx.Params("id"))
+	if err != nil {
+		log.Println("cannot parse collection id:", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot parse collection id"})
+	}
+
+	restored, err := s.FlashcardRepo.RestoreCollectionOfUser(ctx.UserContext(), collectionID, userID)
+	if err != nil {
+		log.Println("cannot restore flashcard collection:", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot restore flashcard collection"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(restored)
+}
+
+// HandleGetDefaultFlashcardCollection returns the default collection of the user, it is created if missing
+func (s Service) HandleGetDefaultFlashcardCollection(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+
+	collection, err := s.FlashcardRepo.GetOrCreateDefaultCollection(ctx.UserContext(), userID)
+	if err != nil {
+		log.Println("cannot get default collection", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot get default collection"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(collection)
+}
+
 // define one-time used type in the usage scope
 type AddFlashcardBody struct {
-	FrontText string
-	BackText  string
+	FrontText    string
+	BackText     string
+	Kind         repo.CardKind
+	Tags         []string
+	Examples     []string
+	IPA          string
+	PartOfSpeech string
+}
+
+// applyTo sets the fields of the body to the flashcard and validates it
+func (b AddFlashcardBody) applyTo(flashcard *repo.Flashcard) error {
+	flashcard.FrontText = b.FrontText
+	flashcard.BackText = b.BackText
+	flashcard.Kind = b.Kind
+	flashcard.Tags = b.Tags
+	flashcard.Examples = b.Examples
+	flashcard.IPA = b.IPA
+	flashcard.PartOfSpeech = b.PartOfSpeech
+	if flashcard.Kind == "" {
+		flashcard.Kind = repo.BasicCardKind
+	}
+
+	return flashcard.Validate()
+}
+
+// newFlashcardsOf makes and validates the flashcards of a new collection like added flashcards,
+// the progress and metadata sent by the client are not kept
+func newFlashcardsOf(cards *[]*repo.Flashcard) (*[]*repo.Flashcard, error) {
+	if cards == nil {
+		return nil, nil
+	}
+	flashcards := make([]*repo.Flashcard, len(*cards))
+	for i, card := range *cards {
+		if card == nil {
+			return nil, fmt.Errorf("flashcard %d: %w", i+1, repo.ErrEmptyFrontText)
+		}
+		flashcards[i] = &repo.Flashcard{Type: repo.ManualFlashcardType}
+		body := AddFlashcardBody{
+			FrontText:    card.FrontText,
+			BackText:     card.BackText,
+			Kind:         card.Kind,
+			Tags:         card.Tags,
+			Examples:     card.Examples,
+			IPA:          card.IPA,
+			PartOfSpeech: card.PartOfSpeech,
+		}
+		if err := body.applyTo(flashcards[i]); err != nil {
+			return nil, fmt.Errorf("flashcard %d: %w", i+1, err)
+		}
+	}
+	return &flashcards, nil
+}
+
+// HandleAddFlashcard adds a flashcard without a collection to the default collection of the user
+func (s Service) HandleAddFlashcard(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+
+	cardBody := new(AddFlashcardBody)
+	if err := json.Unmarshal(ctx.Body(), cardBody); err != nil {
+		log.Println("invalid request body", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	practiceFlashcard := &repo.Flashcard{Type: repo.ManualFlashcardType}
+	if err := cardBody.applyTo(practiceFlashcard); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	collection, err := s.FlashcardRepo.GetOrCreateDefaultCollection(ctx.UserContext(), userID)
+	if err != nil {
+		log.Println("cannot get default collection", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot get default collection"})
+	}
+
+	flashcard, err := s.FlashcardRepo.AddFlashcardToCollection(ctx.UserContext(), collection.ID, practiceFlashcard)
+	if err != nil {
+		log.Println("cannot add flashcard to collection", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot add flashcard to collection"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(flashcard)
 }
 
 func (s Service) HandleAddFlashcardToCollection(ctx *fiber.Ctx) error {
@@ -131,12 +332,13 @@ func (s Service) HandleAddFlashcardToCollection(ctx *fiber.Ctx) error {
 		log.Fatalln("cannot get collection from context")
 	}
 
-	practiceFlashcard := &repo.Flashcard{
-		FrontText: cardBody.FrontText,
-		BackText:  cardBody.BackText,
+	practiceFlashcard := &repo.Flashcard{Type: repo.ManualFlashcardType}
+	if err := cardBody.applyTo(practiceFlashcard); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	practiceFlashcard, err := s.FlashcardRepo.AddFlashcardToCollection(
+		ctx.UserContext(),
 		collection.ID,
 		practiceFlashcard,
 	)
@@ -168,15 +370,16 @@ func (s Service) HandleUpdateFlashcardInCollection(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "flashcardID is invalid"})
 	}
 
-	flashcard, err := s.FlashcardRepo.GetFlashcardByID(collection.ID, flashcardID)
+	flashcard, err := s.FlashcardRepo.GetFlashcardByID(ctx.UserContext(), collection.ID, flashcardID)
 	if err != nil {
 		log.Println("cannot get flashcard", err)
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot get flashcard"})
 	}
-	flashcard.FrontText = cardBody.FrontText
-	flashcard.BackText = cardBody.BackText
+	if err := cardBody.applyTo(flashcard); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
-	err = s.FlashcardRepo.UpdateFlashCard(collection.ID, *flashcard)
+	err = s.FlashcardRepo.UpdateFlashCard(ctx.UserContext(), collection.ID, *flashcard)
 	if err != nil {
 		log.Println("cannot add flashcard to collection", err)
 		return ctx.Status(fiber.StatusBadRequest).
@@ -199,7 +402,7 @@ func (s Service) HandleRemoveFlashcardFromCollection(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "flashcardID is invalid"})
 	}
 
-	if err := s.FlashcardRepo.DeleteFlashCard(collection.ID, flashcardID); err != nil {
+	if err := s.FlashcardRepo.DeleteFlashCard(ctx.UserContext(), collection.ID, flashcardID); err != nil {
 		log.Println("cannot delete flashcard", err)
 		return ctx.Status(fiber.StatusBadRequest).
 			JSON(fiber.Map{"error": "cannot delete flashcard"})
@@ -211,7 +414,7 @@ func (s Service) HandleRemoveFlashcardFromCollection(ctx *fiber.Ctx) error {
 func (s Service) HandleGetCollectionsPreview(ctx *fiber.Ctx) error {
 	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
 
-	metadatas, err := s.FlashcardRepo.GetCollectionsMetadataByUserID(userID)
+	metadatas, err := s.FlashcardRepo.GetCollectionsMetadataByUserID(ctx.UserContext(), userID)
 	if err != nil {
 		log.Println("cannot get metadatas", err)
 		return ctx.Status(fiber.StatusBadRequest).
@@ -221,6 +424,8 @@ func (s Service) HandleGetCollectionsPreview(ctx *fiber.Ctx) error {
 	return ctx.Status(fiber.StatusOK).JSON(metadatas)
 }
 
+// HandleUpdateFlashcardViewStatus marks the flashcard as viewed (or not with `viewed=false`),
+// views are added to the activity log of today with the `duration` query param as time spent in milliseconds
 func (s Service) HandleUpdateFlashcardViewStatus(ctx *fiber.Ctx) error {
 	collection, ok := ctx.Locals(CollectionKey).(*repo.FlashcardCollection)
 	if !ok {
@@ -234,13 +439,26 @@ func (s Service) HandleUpdateFlashcardViewStatus(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "flashcardID is invalid"})
 	}
 	viewStatus := ctx.QueryBool("viewed", true)
+	loc, err := timezoneOf(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid timezone"})
+	}
 
-	err = s.FlashcardRepo.UpdateFlashcardViewStatus(collection.ID, cardID, viewStatus)
+	err = s.FlashcardRepo.UpdateFlashcardViewStatus(ctx.UserContext(), collection.ID, cardID, viewStatus)
 	if err != nil {
 		log.Println("cannot update flashcard view status", err)
 		return ctx.Status(fiber.StatusBadRequest).
 			JSON(fiber.Map{"error": "cannot update flashcard view status"})
 	}
 
+	// views are only logged for stats, the view status is updated even if logging fails
+	if viewStatus {
+		userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+		counts := repo.ActivityLog{Views: 1, TimeSpent: timeSpent(int64(ctx.QueryInt("duration")))}
+		if err := s.recordActivity(ctx.UserContext(), userID, loc, counts); err != nil {
+			log.Println("cannot record flashcard view", err)
+		}
+	}
+
 	return ctx.SendStatus(fiber.StatusOK)
 }
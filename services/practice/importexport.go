@@ -0,0 +1,222 @@
+package practice
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"blinders/packages/auth"
+	"blinders/services/practice/repo"
+	"blinders/services/practice/transfer"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultImportCollectionName = "Imported collection"
+	// ExportTimeout bounds the stream of an export, it is written after the request context is released
+	ExportTimeout = time.Minute
+)
+
+// ImportResult reports the imported cards, invalid rows are skipped and reported in Errors
+type ImportResult struct {
+	CollectionID primitive.ObjectID  `json:"collectionId"`
+	Imported     int                 `json:"imported"`
+	Errors       []transfer.RowError `json:"errors"`
+}
+
+// parseImport reads cards of the request body (or of the `file` field of a multipart form),
+// the format is the `format` query param or the content type of the body
+func parseImport(ctx *fiber.Ctx) ([]transfer.Card, []transfer.RowError, error) {
+	var (
+		body        io.Reader = bytes.NewReader(ctx.Body())
+		contentType           = ctx.Get(fiber.HeaderContentType)
+	)
+
+	if strings.HasPrefix(contentType, fiber.MIMEMultipartForm) {
+		header, err := ctx.FormFile("file")
+		if err != nil {
+			return nil, nil, err
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer file.Close()
+
+		body = file
+		contentType = header.Header.Get(fiber.HeaderContentType)
+	}
+
+	format, err := transfer.ParseFormat(ctx.Query("format", contentType))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return transfer.Parse(body, format, checkImportedCard)
+}
+
+// cardToFlashcard makes and validates the flashcard of an imported card like added flashcards
+func cardToFlashcard(card transfer.Card) (*repo.Flashcard, error) {
+	flashcard := &repo.Flashcard{Type: repo.ManualFlashcardType}
+	body := AddFlashcardBody{
+		FrontText:    card.FrontText,
+		BackText:     card.BackText,
+		Kind:         repo.CardKind(card.Kind),
+		Tags:         card.Tags,
+		Examples:     card.Examples,
+		IPA:          card.IPA,
+		PartOfSpeech: card.PartOfSpeech,
+	}
+	return flashcard, body.applyTo(flashcard)
+}
+
+// flashcardToCard is the exported card of the flashcard, the reverse of cardToFlashcard
+func flashcardToCard(flashcard *repo.Flashcard) transfer.Card {
+	return transfer.Card{
+		FrontText:    flashcard.FrontText,
+		BackText:     flashcard.BackText,
+		Tags:         flashcard.Tags,
+		Kind:         string(flashcard.Kind),
+		Examples:     flashcard.Examples,
+		IPA:          flashcard.IPA,
+		PartOfSpeech: flashcard.PartOfSpeech,
+	}
+}
+
+func checkImportedCard(card transfer.Card) error {
+	_, err := cardToFlashcard(card)
+	return err
+}
+
+// cardsToFlashcards converts cards parsed with checkImportedCard, they are valid flashcards
+func cardsToFlashcards(cards []transfer.Card) []*repo.Flashcard {
+	flashcards := make([]*repo.Flashcard, len(cards))
+	for idx, card := range cards {
+		flashcards[idx], _ = cardToFlashcard(card)
+	}
+	return flashcards
+}
+
+// HandleImportFlashcardCollection creates a collection of the imported cards, named by the `name` query param
+func (s Service) HandleImportFlashcardCollection(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+
+	cards, rowErrors, err := parseImport(ctx)
+	if err != nil {
+		log.Println("cannot parse import", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(cards) == 0 {
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "import has no valid rows", "errors": rowErrors})
+	}
+
+	flashcards := cardsToFlashcards(cards)
+	collection := &repo.FlashcardCollection{
+		Type:       repo.ManualCollectionType,
+		Name:       ctx.Query("name", DefaultImportCollectionName),
+		UserID:     userID,
+		FlashCards: &flashcards,
+	}
+
+	err = s.Tx.WithTransaction(ctx.UserContext(), func(txCtx context.Context) error {
+		var err error
+		collection, err = s.FlashcardRepo.InsertRaw(txCtx, collection)
+		return err
+	})
+	if err != nil {
+		log.Println("cannot insert imported collection", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot insert flashcard collection"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(ImportResult{
+		CollectionID: collection.ID,
+		Imported:     len(flashcards),
+		Errors:       rowErrors,
+	})
+}
+
+// HandleImportFlashcardsToCollection adds the imported cards to the collection
+func (s Service) HandleImportFlashcardsToCollection(ctx *fiber.Ctx) error {
+	collection, ok := ctx.Locals(CollectionKey).(*repo.FlashcardCollection)
+	if !ok {
+		log.Fatalln("cannot get collection from context")
+	}
+
+	cards, rowErrors, err := parseImport(ctx)
+	if err != nil {
+		log.Println("cannot parse import", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(cards) == 0 {
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "import has no valid rows", "errors": rowErrors})
+	}
+
+	// the cards and the counts of the collection are updated together
+	var added []*repo.Flashcard
+	err = s.Tx.WithTransaction(ctx.UserContext(), func(txCtx context.Context) error {
+		var err error
+		added, err = s.FlashcardRepo.AddFlashcardsToCollection(txCtx, collection.ID, cardsToFlashcards(cards))
+		return err
+	})
+	if err != nil {
+		log.Println("cannot add imported flashcards to collection", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot add flashcard to collection"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(ImportResult{
+		CollectionID: collection.ID,
+		Imported:     len(added),
+		Errors:       rowErrors,
+	})
+}
+
+// HandleExportFlashcardCollection streams the cards of the collection as an attachment in the `format` query param
+func (s Service) HandleExportFlashcardCollection(ctx *fiber.Ctx) error {
+	collection, ok := ctx.Locals(CollectionKey).(*repo.FlashcardCollection)
+	if !ok {
+		log.Fatalln("cannot get collection from context")
+	}
+
+	format, err := transfer.ParseFormat(ctx.Query("format"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// the cards are read from a cursor while writing, the stream writer runs after the handler returns
+	// so it has its own context
+	ctx.Attachment(fmt.Sprintf("%s.%s", collection.ID.Hex(), format))
+	ctx.Set(fiber.HeaderContentType, format.ContentType())
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		exportCtx, cancel := context.WithTimeout(context.Background(), ExportTimeout)
+		defer cancel()
+
+		writer, err := transfer.NewWriter(w, format)
+		if err != nil {
+			log.Println("cannot export flashcard collection", err)
+			return
+		}
+		err = s.FlashcardRepo.EachFlashcardOfCollection(exportCtx, collection.ID, func(flashcard *repo.Flashcard) error {
+			return writer.Write(flashcardToCard(flashcard))
+		})
+		if err != nil {
+			log.Println("cannot export flashcard collection", err)
+			return
+		}
+		if err := writer.Close(); err != nil {
+			log.Println("cannot export flashcard collection", err)
+		}
+	})
+
+	return nil
+}
@@ -2,6 +2,7 @@ package practice
 
 import (
 	"blinders/packages/auth"
+	"blinders/packages/dbutils"
 	"blinders/services/practice/repo"
 
 	"github.com/gofiber/fiber/v2"
@@ -9,33 +10,68 @@ import (
 )
 
 type Service struct {
-	Auth          *auth.Manager
-	FlashcardRepo *repo.FlashcardsRepo
-	SnapshotRepo  *repo.SnapshotsRepo
+	Auth            *auth.Manager
+	FlashcardRepo   *repo.FlashcardsRepo
+	SnapshotRepo    *repo.SnapshotsRepo
+	ReviewLogRepo   *repo.ReviewLogsRepo
+	ExplainLogRepo  *repo.ExplainLogsRepo
+	ActivityLogRepo *repo.ActivityLogsRepo
+	Tx              *dbutils.Transactor
+	Study           StudyConfig
 }
 
 func NewService(auth *auth.Manager, db *mongo.Database) *Service {
 	return &Service{
-		Auth:          auth,
-		FlashcardRepo: repo.NewFlashcardsRepo(db),
-		SnapshotRepo:  repo.NewSnapshotsRepo(db),
+		Auth:            auth,
+		FlashcardRepo:   repo.NewFlashcardsRepo(db),
+		SnapshotRepo:    repo.NewSnapshotsRepo(db),
+		ReviewLogRepo:   repo.NewReviewLogsRepo(db),
+		ExplainLogRepo:  repo.NewExplainLogsRepo(db),
+		ActivityLogRepo: repo.NewActivityLogsRepo(db),
+		Tx:              dbutils.NewTransactor(db),
+		Study:           DefaultStudyConfig,
 	}
 }
 
 func (s *Service) InitFiberRoutes(r fiber.Router) {
+	study := r.Group("/study", s.Auth.FiberAuthMiddleware(auth.Config{WithUser: true}))
+	study.Get("/next", s.HandleGetNextStudyCards)
+
+	stats := r.Group("/stats", s.Auth.FiberAuthMiddleware(auth.Config{WithUser: true}))
+	stats.Get("/", s.HandleGetStats)
+
 	flashcards := r.Group("/flashcards", s.Auth.FiberAuthMiddleware(auth.Config{WithUser: true}))
+	flashcards.Post("/", s.HandleAddFlashcard)
+	flashcards.Post("/explain-logs/sync", s.HandleSyncExplainLogFlashcards)
+	flashcards.Get("/shared/:token", s.HandleGetSharedFlashcardCollection)
+	flashcards.Get("/shared/:token/flashcards", s.HandleGetSharedFlashcards)
+
 	flashcardCollections := flashcards.Group("/collections")
 
 	flashcardCollections.Get("/", s.HandleGetFlashcardCollections)
 	flashcardCollections.Post("/", s.HandleCreateFlashcardCollection)
+	// registered before the ownership middleware, "default" and "import" are not collection IDs
+	flashcardCollections.Get("/default", s.HandleGetDefaultFlashcardCollection)
+	flashcardCollections.Post("/import", s.HandleImportFlashcardCollection)
+
+	// registered before the ownership middleware, deleted collections are not found by it
+	flashcardCollections.Post("/:id/restore", s.HandleRestoreFlashcardCollectionByID)
+	// shared collections of other users can be cloned, the handler checks the visibility
+	flashcardCollections.Post("/:id/clone", s.HandleCloneFlashcardCollection)
 
 	validatedCollection := flashcardCollections.Group("/:id", s.ValidateOwnership("id"))
 	validatedCollection.Get("/", s.HandleGetFlashcardCollectionByID)
 	validatedCollection.Put("/", s.HandleUpdateFlashcardCollectionByID)
 	validatedCollection.Delete("/", s.HandleDeleteFlashcardCollectionByID)
 	validatedCollection.Post("/", s.HandleAddFlashcardToCollection)
+	validatedCollection.Post("/import", s.HandleImportFlashcardsToCollection)
+	validatedCollection.Put("/visibility", s.HandleUpdateFlashcardCollectionVisibility)
+	validatedCollection.Get("/export", s.HandleExportFlashcardCollection)
+	validatedCollection.Get("/flashcards", s.HandleGetFlashcardsOfCollection)
 
 	validatedCollection.Put("/:flashcardId/status", s.HandleUpdateFlashcardViewStatus)
+	validatedCollection.Post("/:flashcardId/review", s.HandleReviewFlashcard)
+	validatedCollection.Get("/:flashcardId/reviews", s.HandleGetFlashcardReviews)
 	validatedCollection.Put("/:flashcardId", s.HandleUpdateFlashcardInCollection)
 	validatedCollection.Delete("/:flashcardId", s.HandleRemoveFlashcardFromCollection)
 }
@@ -22,7 +22,8 @@ func (s Service) ValidateOwnership(idParam string) fiber.Handler {
 				JSON(fiber.Map{"error": "cannot parse collection id"})
 		}
 
-		collection, err := s.FlashcardRepo.GetCollectionByID(collectionID)
+		// only the collection document, handlers load counts or pages of flashcards when they need them
+		collection, err := s.FlashcardRepo.GetByID(ctx.UserContext(), collectionID)
 		if err != nil {
 			log.Println("cannot get flashcard collection:", err)
 			return ctx.Status(fiber.StatusBadRequest).
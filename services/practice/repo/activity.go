@@ -0,0 +1,139 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	dbutils "blinders/packages/dbutils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const ActivityLogsColName = "activity-logs"
+
+type ActivityLogsRepo struct {
+	dbutils.SingleCollectionRepo[*ActivityLog]
+}
+
+var ActivityLogsIndexes = []dbutils.IndexSpec{
+	{
+		// one log per user and day, days of a user are ordered
+		Collection: ActivityLogsColName,
+		Name:       "userId_1_day_1",
+		Keys:       bson.D{{Key: "userId", Value: 1}, {Key: "day", Value: 1}},
+		Unique:     true,
+	},
+}
+
+func NewActivityLogsRepo(db *mongo.Database) *ActivityLogsRepo {
+	col := db.Collection(ActivityLogsColName)
+	return &ActivityLogsRepo{
+		SingleCollectionRepo: dbutils.SingleCollectionRepo[*ActivityLog]{
+			Collection: col,
+			Timeout:    time.Second * 5,
+		},
+	}
+}
+
+// AddActivity adds the counters of the activity to the log of the user in the day,
+// the log is created by the first activity of the day
+func (r *ActivityLogsRepo) AddActivity(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	day string,
+	activity ActivityLog,
+) error {
+	ctx, cancel := dbutils.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	onInsert := bson.M{
+		"_id":       primitive.NewObjectID(),
+		"createdAt": primitive.NewDateTimeFromTime(time.Now()),
+	}
+	if actor, ok := dbutils.ActorFromContext(ctx); ok {
+		onInsert["createdBy"] = actor
+	}
+	update := bson.M{
+		"$inc": bson.M{
+			"reviews":   activity.Reviews,
+			"correct":   activity.Correct,
+			"newCards":  activity.NewCards,
+			"views":     activity.Views,
+			"timeSpent": activity.TimeSpent,
+		},
+		"$set":         dbutils.Touched(ctx, bson.M{}),
+		"$setOnInsert": onInsert,
+	}
+
+	filter := bson.M{"userId": userID, "day": day}
+	opts := options.Update().SetUpsert(true)
+	_, err := r.UpdateOne(ctx, filter, update, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		// concurrent upserts of the same day, the other one inserted the log
+		_, err = r.UpdateOne(ctx, filter, update, opts)
+	}
+
+	return err
+}
+
+// GetByUserIDBetween returns logs of the user from the day to the day (both included), oldest first
+func (r *ActivityLogsRepo) GetByUserIDBetween(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	from string,
+	to string,
+) ([]*ActivityLog, error) {
+	filter := bson.M{"userId": userID, "day": bson.M{"$gte": from, "$lte": to}}
+	return r.Find(ctx, filter, options.Find().SetSort(bson.M{"day": 1}))
+}
+
+// GetActiveDays returns the days with activity of the user until the day (included), most recent first
+func (r *ActivityLogsRepo) GetActiveDays(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	until string,
+	limit int64,
+) ([]string, error) {
+	logs, err := r.Find(ctx,
+		bson.M{"userId": userID, "day": bson.M{"$lte": until}},
+		options.Find().
+			SetSort(bson.M{"day": -1}).
+			SetLimit(limit).
+			SetProjection(bson.M{"day": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	days := make([]string, len(logs))
+	for idx, log := range logs {
+		days[idx] = log.Day
+	}
+
+	return days, nil
+}
+
+func (r *ActivityLogsRepo) DeleteByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	result, err := r.DeleteMany(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (r *ActivityLogsRepo) CountByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	return r.Count(ctx, bson.M{"userId": userID})
+}
@@ -0,0 +1,63 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dbutils "blinders/packages/dbutils"
+	"blinders/services/practice/repo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAddActivity(t *testing.T) {
+	r := GetActivityLogTestRepo(t)
+	defer CleanActivityLogRepo(t, r)
+
+	userID := primitive.NewObjectID()
+	ctx := context.Background()
+
+	assert.NoError(t, r.AddActivity(ctx, userID, "2024-04-29", repo.ActivityLog{Views: 1}))
+	assert.NoError(t, r.AddActivity(ctx, userID, "2024-05-01", repo.ActivityLog{Reviews: 1, Correct: 1, TimeSpent: 1000}))
+	assert.NoError(t, r.AddActivity(ctx, userID, "2024-05-01", repo.ActivityLog{Reviews: 1, NewCards: 1, TimeSpent: 500}))
+
+	logs, err := r.GetByUserIDBetween(ctx, userID, "2024-04-30", "2024-05-01")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(logs))
+	assert.Equal(t, "2024-05-01", logs[0].Day)
+	assert.Equal(t, int64(2), logs[0].Reviews)
+	assert.Equal(t, int64(1), logs[0].Correct)
+	assert.Equal(t, int64(1), logs[0].NewCards)
+	assert.Equal(t, int64(1500), logs[0].TimeSpent)
+
+	days, err := r.GetActiveDays(ctx, userID, "2024-05-01", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2024-05-01", "2024-04-29"}, days)
+}
+
+func GetActivityLogTestRepo(t *testing.T) *repo.ActivityLogsRepo {
+	t.Helper()
+	if client == nil {
+		var err error
+		client, err = dbutils.InitMongoClient(mongoTestURL)
+		assert.NoError(t, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err := client.Ping(ctx, nil)
+	assert.NoError(t, err)
+
+	return repo.NewActivityLogsRepo(client.Database(mongoTestDBName))
+}
+
+func CleanActivityLogRepo(t *testing.T, repo *repo.ActivityLogsRepo) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err := repo.Collection.Drop(ctx)
+	assert.NoError(t, err)
+}
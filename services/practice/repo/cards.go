@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"context"
+
+	dbutils "blinders/packages/dbutils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CardsColName is the collection of flashcards, each flashcard is a document referencing its collection
+// by collectionId. Flashcards used to be embedded in the flashcard collection document
+const CardsColName = "cards"
+
+var CardsIndexes = []dbutils.IndexSpec{
+	{
+		// flashcards of a collection, paged by ID
+		Collection: CardsColName,
+		Name:       "collectionId_1__id_1",
+		Keys:       bson.D{{Key: "collectionId", Value: 1}, {Key: "_id", Value: 1}},
+	},
+	{
+		// due flashcards of a user
+		Collection: CardsColName,
+		Name:       "userId_1_review.dueAt_1",
+		Keys:       bson.D{{Key: "userId", Value: 1}, {Key: "review.dueAt", Value: 1}},
+	},
+	{
+		Collection: CardsColName,
+		Name:       "userId_1_tags_1",
+		Keys:       bson.D{{Key: "userId", Value: 1}, {Key: "tags", Value: 1}},
+	},
+	{
+		Collection: CardsColName,
+		Name:       "userId_1_metadata.explain_log_id_1",
+		Keys:       bson.D{{Key: "userId", Value: 1}, {Key: "metadata.explain_log_id", Value: 1}},
+	},
+}
+
+// embeddedCollection is a flashcard collection with embedded flashcards, as stored before MoveFlashcardsToCards
+type embeddedCollection struct {
+	ID         primitive.ObjectID   `bson:"_id"`
+	UserID     primitive.ObjectID   `bson:"userId"`
+	Viewed     []primitive.ObjectID `bson:"viewed"`
+	FlashCards []bson.M             `bson:"flashcards"`
+}
+
+// MoveFlashcardsToCards moves flashcards embedded in collections to the cards collection, the viewed
+// status of the collection is kept on each card. Cards are upserted by ID, so a failed run could be run again
+func MoveFlashcardsToCards(ctx context.Context, db *mongo.Database) error {
+	collections := db.Collection(FlashcardsColName)
+	cards := db.Collection(CardsColName)
+
+	cur, err := collections.Find(ctx, bson.M{"flashcards.0": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var collection embeddedCollection
+		if err := cur.Decode(&collection); err != nil {
+			return err
+		}
+
+		viewed := make(map[primitive.ObjectID]bool, len(collection.Viewed))
+		for _, id := range collection.Viewed {
+			viewed[id] = true
+		}
+
+		models := make([]mongo.WriteModel, len(collection.FlashCards))
+		for idx, card := range collection.FlashCards {
+			card["collectionId"] = collection.ID
+			card["userId"] = collection.UserID
+			if id, ok := card["_id"].(primitive.ObjectID); ok && viewed[id] {
+				card["viewed"] = true
+			}
+			models[idx] = mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": card["_id"]}).
+				SetReplacement(card).
+				SetUpsert(true)
+		}
+
+		if _, err := cards.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	_, err = collections.UpdateMany(ctx, bson.M{}, bson.M{
+		"$unset": bson.M{"flashcards": "", "viewed": "", "total": ""},
+	})
+	if err != nil {
+		return err
+	}
+
+	return dbutils.DropIndexes(ctx, db, FlashcardsTagIndexes...)
+}
+
+// MoveCardsToFlashcards reverts MoveFlashcardsToCards, cards are embedded to their collections again
+func MoveCardsToFlashcards(ctx context.Context, db *mongo.Database) error {
+	collections := db.Collection(FlashcardsColName)
+	cards := db.Collection(CardsColName)
+
+	pipeline := []bson.M{
+		{"$sort": bson.M{"_id": 1}},
+		{"$group": bson.M{"_id": "$collectionId", "flashcards": bson.M{"$push": "$$ROOT"}}},
+	}
+	cur, err := cards.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var collection embeddedCollection
+		if err := cur.Decode(&collection); err != nil {
+			return err
+		}
+
+		viewed := make([]primitive.ObjectID, 0)
+		total := make([]primitive.ObjectID, 0, len(collection.FlashCards))
+		for _, card := range collection.FlashCards {
+			id, _ := card["_id"].(primitive.ObjectID)
+			total = append(total, id)
+			if isViewed, _ := card["viewed"].(bool); isViewed {
+				viewed = append(viewed, id)
+			}
+			delete(card, "collectionId")
+			delete(card, "userId")
+			delete(card, "viewed")
+		}
+
+		_, err := collections.UpdateOne(ctx, bson.M{"_id": collection.ID}, bson.M{"$set": bson.M{
+			"flashcards": collection.FlashCards,
+			"viewed":     viewed,
+			"total":      total,
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	_, err = collections.UpdateMany(ctx, bson.M{"flashcards": bson.M{"$exists": false}}, bson.M{"$set": bson.M{
+		"flashcards": bson.A{},
+		"viewed":     bson.A{},
+		"total":      bson.A{},
+	}})
+	if err != nil {
+		return err
+	}
+
+	// the collection is kept with the indexes of its own migration, the migration could be run up again
+	if _, err := cards.DeleteMany(ctx, bson.M{}); err != nil {
+		return err
+	}
+
+	return dbutils.EnsureIndexes(ctx, db, FlashcardsTagIndexes...)
+}
@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	dbutils "blinders/packages/dbutils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ExplainLogsColName is written by the suggest service, practice only reads it
+const ExplainLogsColName = "explain-logs"
+
+type ExplainLogsRepo struct {
+	dbutils.SingleCollectionRepo[*ExplainLog]
+}
+
+var ExplainLogsIndexes = []dbutils.IndexSpec{
+	{
+		Collection: ExplainLogsColName,
+		Name:       "userId_1_createdAt_1",
+		Keys:       bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: 1}},
+	},
+}
+
+func NewExplainLogsRepo(db *mongo.Database) *ExplainLogsRepo {
+	col := db.Collection(ExplainLogsColName)
+	return &ExplainLogsRepo{
+		SingleCollectionRepo: dbutils.SingleCollectionRepo[*ExplainLog]{
+			Collection: col,
+			Timeout:    time.Second * 5,
+		},
+	}
+}
+
+// GetByUserIDAfter returns explain logs of the user after the log created at the time with the ID, oldest first.
+// Logs are ordered by (createdAt, _id), the log of the position is not returned again
+func (r *ExplainLogsRepo) GetByUserIDAfter(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	after primitive.DateTime,
+	afterID primitive.ObjectID,
+	limit int64,
+) ([]*ExplainLog, error) {
+	filter := bson.M{
+		"userId": userID,
+		"$or": bson.A{
+			bson.M{"createdAt": bson.M{"$gt": after}},
+			bson.M{"createdAt": after, "_id": bson.M{"$gt": afterID}},
+		},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(limit)
+
+	return r.Find(ctx, filter, opts)
+}
@@ -0,0 +1,73 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dbutils "blinders/packages/dbutils"
+	"blinders/services/practice/repo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetByUserIDAfter(t *testing.T) {
+	explainLogRepo := GetExplainLogTestRepo(t)
+	defer CleanExplainLogRepo(t, explainLogRepo)
+
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	createdAt := primitive.NewDateTimeFromTime(time.Now().Truncate(time.Millisecond))
+
+	// logs created at the same time are ordered by ID
+	logs := make([]*repo.ExplainLog, 3)
+	for idx := range logs {
+		logs[idx] = &repo.ExplainLog{
+			RawModel: dbutils.RawModel{ID: primitive.NewObjectID(), CreatedAt: createdAt, UpdatedAt: createdAt},
+			UserID:   userID,
+			Phrase:   "phrase",
+		}
+		_, err := explainLogRepo.InsertOne(ctx, logs[idx])
+		assert.Nil(t, err)
+	}
+
+	all, err := explainLogRepo.GetByUserIDAfter(ctx, userID, 0, primitive.NilObjectID, 10)
+	assert.Nil(t, err)
+	assert.Len(t, all, 3)
+
+	after, err := explainLogRepo.GetByUserIDAfter(ctx, userID, createdAt, logs[0].ID, 10)
+	assert.Nil(t, err)
+	assert.Len(t, after, 2)
+	assert.Equal(t, logs[1].ID, after[0].ID)
+	assert.Equal(t, logs[2].ID, after[1].ID)
+
+	after, err = explainLogRepo.GetByUserIDAfter(ctx, userID, createdAt, logs[2].ID, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, after)
+}
+
+func GetExplainLogTestRepo(t *testing.T) *repo.ExplainLogsRepo {
+	t.Helper()
+	if client == nil {
+		var err error
+		client, err = dbutils.InitMongoClient(mongoTestURL)
+		assert.NoError(t, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err := client.Ping(ctx, nil)
+	assert.NoError(t, err)
+
+	return repo.NewExplainLogsRepo(client.Database(mongoTestDBName))
+}
+
+func CleanExplainLogRepo(t *testing.T, repo *repo.ExplainLogsRepo) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err := repo.Collection.Drop(ctx)
+	assert.NoError(t, err)
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	dbutils "blinders/packages/dbutils"
+	"blinders/services/practice/srs"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,91 +17,240 @@ const FlashcardsColName = "flashcards"
 
 type FlashcardsRepo struct {
 	dbutils.SingleCollectionRepo[*FlashcardCollection]
+	// Cards holds flashcards of all collections, see CardsColName
+	Cards dbutils.SingleCollectionRepo[*Flashcard]
+}
+
+var FlashcardsIndexes = []dbutils.IndexSpec{
+	{
+		Collection: FlashcardsColName,
+		Name:       "userId_1_type_1",
+		Keys:       bson.D{{Key: "userId", Value: 1}, {Key: "type", Value: 1}},
+	},
+	{
+		// collections of a user, recently updated first
+		Collection: FlashcardsColName,
+		Name:       "userId_1_updatedAt_-1",
+		Keys:       bson.D{{Key: "userId", Value: 1}, {Key: "updatedAt", Value: -1}},
+	},
+}
+
+// FlashcardsTagIndexes indexes tags of embedded flashcards, it is dropped when flashcards are moved to cards
+var FlashcardsTagIndexes = []dbutils.IndexSpec{
+	{
+		Collection: FlashcardsColName,
+		Name:       "userId_1_flashcards.tags_1",
+		Keys:       bson.D{{Key: "userId", Value: 1}, {Key: "flashcards.tags", Value: 1}},
+	},
+}
+
+var FlashcardsShareIndexes = []dbutils.IndexSpec{
+	{
+		Collection: FlashcardsColName,
+		Name:       "shareToken_1",
+		Keys:       bson.D{{Key: "shareToken", Value: 1}},
+		Unique:     true,
+		Sparse:     true,
+	},
+}
+
+// FlashcardsOfTypeIndexes makes the collection of explain logs unique for each user. The deletion time is a key
+// instead of a partial filter (which can not match missing fields), it is null for collections which are not deleted
+var FlashcardsOfTypeIndexes = []dbutils.IndexSpec{
+	{
+		Collection: FlashcardsColName,
+		Name:       "userId_1_type_1_deletedAt_1_unique",
+		Keys: bson.D{
+			{Key: "userId", Value: 1},
+			{Key: "type", Value: 1},
+			{Key: "deletedAt", Value: 1},
+		},
+		Unique:        true,
+		PartialFilter: bson.M{"type": FromExplainLogCollectionType},
+	},
+}
+
+type FlashcardCollectionEvent = dbutils.ChangeEvent[FlashcardCollection]
+
+// OnFlashcardCollectionChanged subscribes the handler to changes of flashcard collections
+func OnFlashcardCollectionChanged(
+	bus *dbutils.ChangeBus,
+	handler func(ctx context.Context, event FlashcardCollectionEvent) error,
+) {
+	dbutils.Subscribe(bus, FlashcardsColName, handler)
 }
 
 func NewFlashcardsRepo(db *mongo.Database) *FlashcardsRepo {
 	col := db.Collection(FlashcardsColName)
 	return &FlashcardsRepo{
-		SingleCollectionRepo: dbutils.SingleCollectionRepo[*FlashcardCollection]{Collection: col},
+		SingleCollectionRepo: dbutils.SingleCollectionRepo[*FlashcardCollection]{
+			Collection: col,
+			Timeout:    time.Second * 5,
+			SoftDelete: true,
+		},
+		// cards of deleted collections are kept so restored collections have their cards
+		Cards: dbutils.SingleCollectionRepo[*Flashcard]{
+			Collection: db.Collection(CardsColName),
+			Timeout:    time.Second * 5,
+		},
 	}
 }
 
-func (r *FlashcardsRepo) InsertRaw(collection *FlashcardCollection) (*FlashcardCollection, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
+// cardCounts are the number of flashcards of a collection and of those viewed
+type cardCounts struct {
+	CollectionID primitive.ObjectID `bson:"_id"`
+	Total        int64              `bson:"total"`
+	Viewed       int64              `bson:"viewed"`
+}
 
-	collection.SetID(primitive.NewObjectID())
-	collection.SetInitTimeByNow()
+// countCards counts flashcards of each of the collections (of the tag if set), collections without
+// flashcards are not in the result
+func (r *FlashcardsRepo) countCards(
+	ctx context.Context,
+	collectionIDs []primitive.ObjectID,
+	tag string,
+) (map[primitive.ObjectID]cardCounts, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
 
-	flashcards := *collection.FlashCards
-	total := make([]primitive.ObjectID, len(flashcards))
-	for idx, card := range flashcards {
-		card.SetID(primitive.NewObjectID())
-		card.SetInitTimeByNow()
-		flashcards[idx] = card
-		total[idx] = card.ID
+	match := bson.M{"collectionId": bson.M{"$in": collectionIDs}}
+	if tag != "" {
+		match["tags"] = tag
 	}
-
-	collection.FlashCards = &flashcards
-	collection.Total = total
-	if collection.Viewed == nil {
-		collection.Viewed = []primitive.ObjectID{}
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":    "$collectionId",
+			"total":  bson.M{"$sum": 1},
+			"viewed": bson.M{"$sum": bson.M{"$cond": bson.A{"$viewed", 1, 0}}},
+		}},
 	}
 
-	_, err := r.InsertOne(ctx, collection)
-	return collection, err
-}
+	cur, err := r.Cards.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
 
-func (r *FlashcardsRepo) GetCollectionByID(
-	collectionID primitive.ObjectID,
-) (*FlashcardCollection, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
+	var counts []cardCounts
+	if err := cur.All(ctx, &counts); err != nil {
+		return nil, err
+	}
 
-	var obj *FlashcardCollection
-	err := r.FindOne(ctx, bson.M{"_id": collectionID}).Decode(&obj)
+	countsOfCollection := make(map[primitive.ObjectID]cardCounts, len(counts))
+	for _, count := range counts {
+		countsOfCollection[count.CollectionID] = count
+	}
 
-	return obj, err
+	return countsOfCollection, nil
 }
 
-func (r *FlashcardsRepo) GetCollectionsByType(
-	userID primitive.ObjectID,
-	typ CollectionType,
+// findCollections returns collections matching the filter with counts of their flashcards (of the tag if set),
+// recently updated first. Flashcards are not loaded, they are paged by GetFlashcardsOfCollection
+func (r *FlashcardsRepo) findCollections(
+	ctx context.Context,
+	filter bson.M,
+	tag string,
 ) ([]*FlashcardCollection, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-
-	filter := bson.M{"userId": userID, "type": typ}
-
-	cur, err := r.Find(ctx, filter)
+	collections, err := r.Find(ctx, filter, options.Find().SetSort(bson.M{"updatedAt": -1}))
 	if err != nil {
 		return nil, err
 	}
-	defer cur.Close(ctx)
+	if len(collections) == 0 {
+		return collections, nil
+	}
 
-	collections := make([]*FlashcardCollection, 0)
-	if err := cur.All(ctx, &collections); err != nil {
+	ids := make([]primitive.ObjectID, len(collections))
+	for idx, collection := range collections {
+		ids[idx] = collection.ID
+	}
+	counts, err := r.countCards(ctx, ids, tag)
+	if err != nil {
 		return nil, err
 	}
+
+	for _, collection := range collections {
+		collection.TotalCount = counts[collection.ID].Total
+		collection.ViewedCount = counts[collection.ID].Viewed
+	}
+
 	return collections, nil
 }
 
-func (r *FlashcardsRepo) GetByUserID(
-	userID primitive.ObjectID,
-) ([]*FlashcardCollection, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
+// withFlashcards fills flashcards (of the tag if set) of the collections with the IDs of all and viewed ones,
+// like collections embedding their flashcards were read. Cards are read from the cards collection,
+// so collections are not limited by the size of a document
+func (r *FlashcardsRepo) withFlashcards(
+	ctx context.Context,
+	collections []*FlashcardCollection,
+	tag string,
+) error {
+	return r.fillCards(ctx, collections, tag, true)
+}
+
+// withFlashcardIDs fills only the IDs of all and viewed flashcards of the collections, like previews of
+// collections embedding their flashcards were read
+func (r *FlashcardsRepo) withFlashcardIDs(ctx context.Context, collections []*FlashcardCollection) error {
+	return r.fillCards(ctx, collections, "", false)
+}
+
+func (r *FlashcardsRepo) fillCards(
+	ctx context.Context,
+	collections []*FlashcardCollection,
+	tag string,
+	withFlashcards bool,
+) error {
+	if len(collections) == 0 {
+		return nil
+	}
+
+	byID := make(map[primitive.ObjectID]*FlashcardCollection, len(collections))
+	ids := make([]primitive.ObjectID, len(collections))
+	for idx, collection := range collections {
+		byID[collection.ID] = collection
+		ids[idx] = collection.ID
+		collection.Total = make([]primitive.ObjectID, 0)
+		collection.Viewed = make([]primitive.ObjectID, 0)
+		if withFlashcards {
+			flashcards := make([]*Flashcard, 0)
+			collection.FlashCards = &flashcards
+		}
+	}
 
-	// find and sort by field "updatedAt"
-	filter := bson.M{"userId": userID}
-	cur, err := r.Find(ctx, filter, options.Find().SetSort(bson.M{"updatedAt": -1}))
+	filter := bson.M{"collectionId": bson.M{"$in": ids}}
+	if tag != "" {
+		filter["tags"] = tag
+	}
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	if !withFlashcards {
+		opts.SetProjection(bson.M{"_id": 1, "collectionId": 1, "viewed": 1})
+	}
+	cards, err := r.Cards.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer cur.Close(ctx)
 
-	collections := make([]*FlashcardCollection, 0)
-	if err := cur.All(ctx, &collections); err != nil {
+	for _, card := range cards {
+		collection := byID[card.CollectionID]
+		if withFlashcards {
+			*collection.FlashCards = append(*collection.FlashCards, card)
+		}
+		collection.Total = append(collection.Total, card.ID)
+		if card.Viewed {
+			collection.Viewed = append(collection.Viewed, card.ID)
+		}
+	}
+
+	return nil
+}
+
+func (r *FlashcardsRepo) findCollection(
+	ctx context.Context,
+	filter bson.M,
+	tag string,
+) (*FlashcardCollection, error) {
+	collections, err := r.findCollections(ctx, filter, tag)
+	if err != nil {
 		return nil, err
 	}
 
@@ -108,39 +258,41 @@ func (r *FlashcardsRepo) GetByUserID(
 		return nil, mongo.ErrNoDocuments
 	}
 
-	return collections, nil
+	return collections[0], nil
 }
 
-func (r *FlashcardsRepo) UpdateFlashcardViewStatus(
-	collectionID,
-	flashcardID primitive.ObjectID,
-	viewStatus bool,
-) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+// collectionIDsOfUser returns IDs of collections of the user which are not deleted,
+// cards of deleted collections are kept so queries of cards of a user are scoped by these IDs
+func (r *FlashcardsRepo) collectionIDsOfUser(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) ([]primitive.ObjectID, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
 	defer cancel()
-	now := time.Now()
 
-	filter := bson.M{"_id": collectionID, "flashcards._id": flashcardID}
-	update := bson.M{"$set": bson.M{
-		"flashcards.$.updatedAt": primitive.NewDateTimeFromTime(now),
-		"updatedAt":              primitive.NewDateTimeFromTime(now),
-	}}
+	values, err := r.Distinct(ctx, "_id", dbutils.NotDeleted(bson.M{"userId": userID}))
+	if err != nil {
+		return nil, err
+	}
 
-	if viewStatus {
-		update["$addToSet"] = bson.M{
-			"viewed": flashcardID,
-		}
-	} else {
-		update["$pull"] = bson.M{
-			"viewed": flashcardID,
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			ids = append(ids, id)
 		}
 	}
 
-	cur, err := r.UpdateOne(
-		ctx,
-		filter,
-		update,
-		options.Update().SetUpsert(false),
+	return ids, nil
+}
+
+// touch sets updatedAt of the collection, so collections with changed cards are listed first
+func (r *FlashcardsRepo) touch(ctx context.Context, collectionID primitive.ObjectID) error {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	cur, err := r.UpdateOne(ctx,
+		dbutils.NotDeleted(bson.M{"_id": collectionID}),
+		bson.M{"$set": dbutils.Touched(ctx, bson.M{})},
 	)
 	if err != nil {
 		return err
@@ -153,75 +305,369 @@ func (r *FlashcardsRepo) UpdateFlashcardViewStatus(
 	return nil
 }
 
-func (r *FlashcardsRepo) GetCollectionsMetadataByID(
+// insertCards inserts the flashcards as cards of the collection
+func (r *FlashcardsRepo) insertCards(
+	ctx context.Context,
+	collection *FlashcardCollection,
+	flashcards []*Flashcard,
+) ([]*Flashcard, error) {
+	if len(flashcards) == 0 {
+		return flashcards, nil
+	}
+
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	actor, hasActor := dbutils.ActorFromContext(ctx)
+	docs := make([]any, len(flashcards))
+	for idx, flashcard := range flashcards {
+		flashcard.SetID(primitive.NewObjectID())
+		flashcard.SetInitTimeByNow()
+		if hasActor {
+			flashcard.SetCreatedBy(actor)
+		}
+		flashcard.CollectionID = collection.ID
+		flashcard.UserID = collection.UserID
+		docs[idx] = flashcard
+	}
+
+	if _, err := r.Cards.InsertMany(ctx, docs); err != nil {
+		return nil, err
+	}
+
+	return flashcards, nil
+}
+
+// updateCard updates the card of the collection and touches the collection
+func (r *FlashcardsRepo) updateCard(
+	ctx context.Context,
+	collectionID,
+	flashcardID primitive.ObjectID,
+	update bson.M,
+) error {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	cur, err := r.Cards.UpdateOne(ctx, bson.M{"_id": flashcardID, "collectionId": collectionID}, update)
+	if err != nil {
+		return err
+	}
+
+	if cur.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return r.touch(ctx, collectionID)
+}
+
+// InsertRaw inserts the collection and its flashcards as cards,
+// use a transaction to insert them together
+func (r *FlashcardsRepo) InsertRaw(
+	ctx context.Context,
+	collection *FlashcardCollection,
+) (*FlashcardCollection, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	collection.SetID(primitive.NewObjectID())
+	collection.SetInitTimeByNow()
+	if actor, ok := dbutils.ActorFromContext(ctx); ok {
+		collection.SetCreatedBy(actor)
+	}
+
+	var flashcards []*Flashcard
+	if collection.FlashCards != nil {
+		flashcards = *collection.FlashCards
+	}
+
+	doc := *collection
+	doc.FlashCards = nil
+	if _, err := r.InsertOne(ctx, &doc); err != nil {
+		return nil, err
+	}
+
+	flashcards, err := r.insertCards(ctx, collection, flashcards)
+	if err != nil {
+		return nil, err
+	}
+
+	collection.FlashCards = &flashcards
+	collection.Total = make([]primitive.ObjectID, len(flashcards))
+	collection.Viewed = make([]primitive.ObjectID, 0)
+	for idx, card := range flashcards {
+		collection.Total[idx] = card.ID
+		if card.Viewed {
+			collection.Viewed = append(collection.Viewed, card.ID)
+		}
+	}
+	collection.TotalCount, collection.ViewedCount = int64(len(collection.Total)), int64(len(collection.Viewed))
+
+	return collection, nil
+}
+
+// GetCollectionByID returns the collection with counts of its flashcards,
+// GetByID returns the collection document only
+func (r *FlashcardsRepo) GetCollectionByID(
+	ctx context.Context,
+	collectionID primitive.ObjectID,
+) (*FlashcardCollection, error) {
+	return r.findCollection(ctx, bson.M{"_id": collectionID}, "")
+}
+
+// GetCollectionByIDAndTag returns the collection with counts of its flashcards of the tag
+func (r *FlashcardsRepo) GetCollectionByIDAndTag(
+	ctx context.Context,
 	collectionID primitive.ObjectID,
+	tag string,
+) (*FlashcardCollection, error) {
+	return r.findCollection(ctx, bson.M{"_id": collectionID}, tag)
+}
+
+// GetCollectionWithFlashcards returns the collection with its flashcards (of the tag if set)
+func (r *FlashcardsRepo) GetCollectionWithFlashcards(
+	ctx context.Context,
+	collectionID primitive.ObjectID,
+	tag string,
+) (*FlashcardCollection, error) {
+	collection, err := r.GetCollectionByIDAndTag(ctx, collectionID, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return collection, r.withFlashcards(ctx, []*FlashcardCollection{collection}, tag)
+}
+
+const DefaultCollectionName = "Default"
+
+// GetOrCreateDefaultCollection returns the default collection of the user, it is created on the first call.
+// The ID of the default collection is the ID of the user, so each user has only one default collection
+func (r *FlashcardsRepo) GetOrCreateDefaultCollection(
+	ctx context.Context,
+	userID primitive.ObjectID,
 ) (*FlashcardCollection, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
 	defer cancel()
-	pipeline := []bson.M{
-		{"$match": bson.M{"_id": collectionID}},
-		{"$project": bson.M{"flashcards": 0}},
-		{"$sort": bson.M{"updatedAt": -1}},
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	onInsert := bson.M{
+		"type":        DefaultCollectionType,
+		"name":        DefaultCollectionName,
+		"description": "",
+		"userId":      userID,
+		"createdAt":   now,
+		"updatedAt":   now,
+	}
+	if actor, ok := dbutils.ActorFromContext(ctx); ok {
+		onInsert["createdBy"] = actor
+	}
+
+	_, err := r.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$setOnInsert": onInsert},
+		options.Update().SetUpsert(true),
+	)
+	// on duplicate key, concurrent upserts of the same ID and the other one inserted the collection
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return nil, err
 	}
 
-	cur, err := r.Aggregate(ctx, pipeline)
+	return r.GetCollectionByID(ctx, userID)
+}
+
+// GetOrCreateCollectionOfType returns the collection of the type of the user, it is created with the name
+// if missing. It is upserted by the user and type, FlashcardsOfTypeIndexes keeps concurrent calls from creating
+// more than one collection of explain logs, collections of other types are not unique
+func (r *FlashcardsRepo) GetOrCreateCollectionOfType(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	typ CollectionType,
+	name string,
+) (*FlashcardCollection, error) {
+	filter := dbutils.NotDeleted(bson.M{"userId": userID, "type": typ})
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	onInsert := bson.M{
+		"_id":         primitive.NewObjectID(),
+		"name":        name,
+		"description": "",
+		"createdAt":   now,
+		"updatedAt":   now,
+	}
+	if actor, ok := dbutils.ActorFromContext(ctx); ok {
+		onInsert["createdBy"] = actor
+	}
+
+	upsertCtx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	_, err := r.UpdateOne(upsertCtx, filter, bson.M{"$setOnInsert": onInsert}, options.Update().SetUpsert(true))
+	// concurrent upserts of a new collection, the collection is inserted by the other one
+	if mongo.IsDuplicateKeyError(err) {
+		_, err = r.UpdateOne(upsertCtx, filter, bson.M{"$setOnInsert": onInsert}, options.Update().SetUpsert(true))
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer cur.Close(ctx)
 
-	collections := make([]*FlashcardCollection, 0)
+	return r.findCollection(ctx, filter, "")
+}
 
-	if err := cur.All(ctx, &collections); err != nil {
+// RestoreCollectionOfUser restores the deleted collection if it belongs to the user
+func (r *FlashcardsRepo) RestoreCollectionOfUser(
+	ctx context.Context,
+	collectionID primitive.ObjectID,
+	userID primitive.ObjectID,
+) (*FlashcardCollection, error) {
+	if _, err := r.Restore(ctx, bson.M{"_id": collectionID, "userId": userID}); err != nil {
 		return nil, err
 	}
 
-	if len(collections) == 0 {
-		return nil, mongo.ErrNoDocuments
+	return r.GetCollectionByID(ctx, collectionID)
+}
+
+// GetSharedCollection returns the collection of the share token if it is shared by link or public,
+// with counts of its flashcards
+func (r *FlashcardsRepo) GetSharedCollection(
+	ctx context.Context,
+	shareToken string,
+) (*FlashcardCollection, error) {
+	return r.findCollection(ctx, bson.M{
+		"shareToken": shareToken,
+		"visibility": bson.M{"$in": []CollectionVisibility{LinkVisibility, PublicVisibility}},
+	}, "")
+}
+
+// UpdateCollectionVisibility sets the visibility of the collection, the share token is kept
+// once generated so shared links keep working when the collection is shared again
+func (r *FlashcardsRepo) UpdateCollectionVisibility(
+	ctx context.Context,
+	collectionID primitive.ObjectID,
+	visibility CollectionVisibility,
+	shareToken string,
+) (*FlashcardCollection, error) {
+	fields := bson.M{"visibility": visibility}
+	if shareToken != "" {
+		fields["shareToken"] = shareToken
 	}
 
-	return collections[0], nil
+	return r.UpdateFieldsByID(ctx, collectionID, fields)
 }
 
-func (r *FlashcardsRepo) GetCollectionsMetadataByUserID(
+func (r *FlashcardsRepo) GetCollectionsByType(
+	ctx context.Context,
 	userID primitive.ObjectID,
+	typ CollectionType,
 ) ([]*FlashcardCollection, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-	pipeline := []bson.M{
-		{"$match": bson.M{"userId": userID}},
-		{"$project": bson.M{"flashcards": 0}},
-		{"$sort": bson.M{"updatedAt": -1}},
+	return r.Find(ctx, bson.M{"userId": userID, "type": typ})
+}
+
+// GetByUserID returns collections of the user with their flashcards
+func (r *FlashcardsRepo) GetByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) ([]*FlashcardCollection, error) {
+	collections, err := r.findCollections(ctx, bson.M{"userId": userID}, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(collections) == 0 {
+		return nil, mongo.ErrNoDocuments
 	}
 
-	cur, err := r.Aggregate(ctx, pipeline)
+	return collections, r.withFlashcards(ctx, collections, "")
+}
+
+// GetByUserIDAndTag returns collections of the user having flashcards of the tag with their flashcards
+// of the tag, counts of the collections are of flashcards of the tag
+func (r *FlashcardsRepo) GetByUserIDAndTag(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	tag string,
+) ([]*FlashcardCollection, error) {
+	collections, err := r.findCollections(ctx, bson.M{"userId": userID}, tag)
 	if err != nil {
 		return nil, err
 	}
-	defer cur.Close(ctx)
 
-	collections := make([]*FlashcardCollection, 0)
+	tagged := make([]*FlashcardCollection, 0)
+	for _, collection := range collections {
+		if collection.TotalCount > 0 {
+			tagged = append(tagged, collection)
+		}
+	}
+
+	return tagged, r.withFlashcards(ctx, tagged, tag)
+}
+
+func (r *FlashcardsRepo) UpdateFlashcardViewStatus(
+	ctx context.Context,
+	collectionID,
+	flashcardID primitive.ObjectID,
+	viewStatus bool,
+) error {
+	update := bson.M{"$set": dbutils.Touched(ctx, bson.M{"viewed": viewStatus})}
+	return r.updateCard(ctx, collectionID, flashcardID, update)
+}
+
+// UpdateFlashcardReview sets the scheduling state of the flashcard (of its back if reversed) and marks it as viewed
+func (r *FlashcardsRepo) UpdateFlashcardReview(
+	ctx context.Context,
+	collectionID,
+	flashcardID primitive.ObjectID,
+	review srs.State,
+	reversed bool,
+) error {
+	field := "review"
+	if reversed {
+		field = "reverseReview"
+	}
+
+	update := bson.M{"$set": dbutils.Touched(ctx, bson.M{field: review, "viewed": true})}
+	return r.updateCard(ctx, collectionID, flashcardID, update)
+}
+
+func (r *FlashcardsRepo) GetCollectionsMetadataByID(
+	ctx context.Context,
+	collectionID primitive.ObjectID,
+) (*FlashcardCollection, error) {
+	return r.findCollection(ctx, bson.M{"_id": collectionID}, "")
+}
+
+// GetCollectionCountsByUserID returns collections of the user with counts of their flashcards only
+func (r *FlashcardsRepo) GetCollectionCountsByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) ([]*FlashcardCollection, error) {
+	return r.findCollections(ctx, bson.M{"userId": userID}, "")
+}
 
-	if err := cur.All(ctx, &collections); err != nil {
+// GetCollectionsMetadataByUserID returns collections of the user with IDs of their flashcards,
+// without the flashcards
+func (r *FlashcardsRepo) GetCollectionsMetadataByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) ([]*FlashcardCollection, error) {
+	collections, err := r.findCollections(ctx, bson.M{"userId": userID}, "")
+	if err != nil {
 		return nil, err
 	}
 
-	return collections, nil
+	return collections, r.withFlashcardIDs(ctx, collections)
 }
 
 func (r *FlashcardsRepo) UpdateCollectionMetadata(
+	ctx context.Context,
 	collectionID primitive.ObjectID,
 	metadata *FlashcardCollection,
 ) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 
-	filter := bson.M{"_id": collectionID}
-	update := bson.M{"$set": bson.M{
+	filter := dbutils.NotDeleted(bson.M{"_id": collectionID})
+	update := bson.M{"$set": dbutils.Touched(ctx, bson.M{
 		"name":        metadata.Name,
 		"description": metadata.Description,
-		"updatedAt":   primitive.NewDateTimeFromTime(time.Now()),
-	}}
+	})}
 
 	cur, err := r.UpdateOne(ctx, filter, update, options.Update().SetUpsert(false))
 	if err != nil {
@@ -235,111 +681,330 @@ func (r *FlashcardsRepo) UpdateCollectionMetadata(
 }
 
 func (r *FlashcardsRepo) AddFlashcardToCollection(
+	ctx context.Context,
 	collectionID primitive.ObjectID,
 	flashcard *Flashcard,
 ) (*Flashcard, error) {
-	flashcard.SetID(primitive.NewObjectID())
-	flashcard.SetInitTimeByNow()
-	update := bson.M{
-		"$push":     bson.M{"flashcards": flashcard},
-		"$set":      bson.M{"updatedAt": primitive.NewDateTimeFromTime(time.Now())},
-		"$addToSet": bson.M{"total": flashcard.ID},
+	flashcards, err := r.AddFlashcardsToCollection(ctx, collectionID, []*Flashcard{flashcard})
+	if err != nil {
+		return nil, err
+	}
+
+	return flashcards[0], nil
+}
+
+func (r *FlashcardsRepo) AddFlashcardsToCollection(
+	ctx context.Context,
+	collectionID primitive.ObjectID,
+	flashcards []*Flashcard,
+) ([]*Flashcard, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	// touch the collection first, it also checks the collection is not deleted
+	var collection *FlashcardCollection
+	err := r.FindOneAndUpdate(ctx,
+		dbutils.NotDeleted(bson.M{"_id": collectionID}),
+		bson.M{"$set": dbutils.Touched(ctx, bson.M{})},
+	).Decode(&collection)
+	if err != nil {
+		return nil, err
 	}
 
-	cur, err := r.Collection.UpdateByID(context.Background(), collectionID, update)
+	return r.insertCards(ctx, collection, flashcards)
+}
+
+// GetExplainLogIDsOfUser returns which of the explain logs already have flashcards in collections of the user
+func (r *FlashcardsRepo) GetExplainLogIDsOfUser(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	explainLogIDs []primitive.ObjectID,
+) ([]primitive.ObjectID, error) {
+	collectionIDs, err := r.collectionIDsOfUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	if cur.MatchedCount == 0 || cur.ModifiedCount == 0 {
-		return nil, mongo.ErrNoDocuments
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	values, err := r.Cards.Distinct(ctx, "metadata.explain_log_id", bson.M{
+		"userId":                  userID,
+		"collectionId":            bson.M{"$in": collectionIDs},
+		"metadata.explain_log_id": bson.M{"$in": explainLogIDs},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
 	}
 
-	return flashcard, nil
+	return ids, nil
 }
 
 func (r *FlashcardsRepo) GetFlashcardByID(
+	ctx context.Context,
 	collectionID primitive.ObjectID,
 	cardID primitive.ObjectID,
 ) (*Flashcard, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 
-	pipeline := []bson.M{
-		{"$match": bson.M{"_id": collectionID}},
-		{"$unwind": "$flashcards"},
-		{"$replaceRoot": bson.M{"newRoot": "$flashcards"}},
-		{"$match": bson.M{"_id": cardID}},
+	var flashcard *Flashcard
+	err := r.Cards.FindOne(ctx, bson.M{"_id": cardID, "collectionId": collectionID}).Decode(&flashcard)
+
+	return flashcard, err
+}
+
+// GetFlashcardsOfCollection pages flashcards of the collection by ID, oldest first.
+// If the tag is set, only flashcards of the tag are listed
+func (r *FlashcardsRepo) GetFlashcardsOfCollection(
+	ctx context.Context,
+	collectionID primitive.ObjectID,
+	tag string,
+	opts dbutils.ListOptions,
+) (dbutils.Page[*Flashcard], error) {
+	filter := bson.M{"collectionId": collectionID}
+	if tag != "" {
+		filter["tags"] = tag
 	}
 
-	cur, err := r.Collection.Aggregate(ctx, pipeline)
+	return r.Cards.List(ctx, filter, opts)
+}
+
+// EachFlashcardOfCollection calls fn with each flashcard of the collection from a cursor, oldest first,
+// so large collections are not loaded at once. It has no timeout, the context should be canceled by the caller
+func (r *FlashcardsRepo) EachFlashcardOfCollection(
+	ctx context.Context,
+	collectionID primitive.ObjectID,
+	fn func(flashcard *Flashcard) error,
+) error {
+	cur, err := r.Cards.Collection.Find(ctx,
+		bson.M{"collectionId": collectionID},
+		options.Find().SetSort(bson.M{"_id": 1}),
+	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer cur.Close(ctx)
 
-	flashcards := make([]*Flashcard, 0)
-	if err := cur.All(ctx, &flashcards); err != nil {
-		return nil, err
+	for cur.Next(ctx) {
+		var flashcard Flashcard
+		if err := cur.Decode(&flashcard); err != nil {
+			return err
+		}
+		if err := fn(&flashcard); err != nil {
+			return err
+		}
 	}
 
-	if len(flashcards) == 0 {
-		return nil, mongo.ErrNoDocuments
+	return cur.Err()
+}
+
+// copyBatchSize is the number of flashcards inserted at once by CopyFlashcards
+const copyBatchSize = 500
+
+// CopyFlashcards copies flashcards of the collection to the other collection without progress,
+// the copies get new IDs. Use a transaction to copy them with the insert of the other collection
+func (r *FlashcardsRepo) CopyFlashcards(
+	ctx context.Context,
+	from primitive.ObjectID,
+	to *FlashcardCollection,
+) (int64, error) {
+	var copied int64
+	batch := make([]*Flashcard, 0, copyBatchSize)
+	flush := func() error {
+		if _, err := r.insertCards(ctx, to, batch); err != nil {
+			return err
+		}
+		copied += int64(len(batch))
+		batch = batch[:0]
+		return nil
 	}
 
-	return flashcards[0], nil
+	err := r.EachFlashcardOfCollection(ctx, from, func(flashcard *Flashcard) error {
+		flashcard.RawModel = dbutils.RawModel{}
+		flashcard.ResetProgress()
+		batch = append(batch, flashcard)
+		if len(batch) < copyBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+
+	to.TotalCount += copied
+	return copied, nil
 }
 
-func (r *FlashcardsRepo) UpdateFlashCard(collectionID primitive.ObjectID, card Flashcard) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
+// GetDueFlashcards returns flashcards of all collections of the user due at the time, most overdue first.
+// Reversed flashcards are returned once for each due side
+func (r *FlashcardsRepo) GetDueFlashcards(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	at time.Time,
+	limit int64,
+) ([]*StudyFlashcard, error) {
+	match := bson.M{"side.review.dueAt": bson.M{"$lte": at}}
+	return r.getStudyFlashcards(ctx, userID, match, bson.M{"side.review.dueAt": 1}, limit)
+}
 
-	card.SetUpdatedAtByNow()
+// GetNewFlashcards returns never reviewed flashcards (or sides of reversed flashcards) of all collections
+// of the user, oldest first
+func (r *FlashcardsRepo) GetNewFlashcards(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	limit int64,
+) ([]*StudyFlashcard, error) {
+	match := bson.M{"side.review": bson.M{"$exists": false}}
+	return r.getStudyFlashcards(ctx, userID, match, bson.M{"createdAt": 1}, limit)
+}
 
-	filter := bson.M{"_id": collectionID, "flashcards._id": card.ID}
-	// explain the below update query?
-	update := bson.M{"$set": bson.M{
-		"flashcards.$.frontText": card.FrontText,
-		"flashcards.$.backText":  card.BackText,
-		"flashcards.$.updatedAt": card.UpdatedAt,
-		"updatedAt":              primitive.NewDateTimeFromTime(time.Now()),
-	}}
+func (r *FlashcardsRepo) getStudyFlashcards(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	match bson.M,
+	sort bson.M,
+	limit int64,
+) ([]*StudyFlashcard, error) {
+	flashcards := make([]*StudyFlashcard, 0)
+	if limit <= 0 {
+		return flashcards, nil
+	}
 
-	cur, err := r.UpdateOne(ctx, filter, update)
+	collectionIDs, err := r.collectionIDsOfUser(ctx, userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if cur.MatchedCount == 0 {
-		return mongo.ErrNoDocuments
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	// each side of a flashcard is studied with its own review state, only reversed flashcards have 2 sides
+	front := bson.M{"reversed": false, "review": "$review"}
+	back := bson.M{"reversed": true, "review": "$reverseReview"}
+	pipeline := []bson.M{
+		{"$match": bson.M{"userId": userID, "collectionId": bson.M{"$in": collectionIDs}}},
+		{"$set": bson.M{"side": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$kind", ReversedCardKind}},
+			bson.A{front, back},
+			bson.A{front},
+		}}}},
+		{"$unwind": "$side"},
+		{"$match": match},
+		{"$sort": sort},
+		{"$limit": limit},
+		{"$set": bson.M{"reversed": "$side.reversed"}},
+		{"$unset": "side"},
+	}
+
+	cur, err := r.Cards.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
 	}
+	defer cur.Close(ctx)
 
-	return nil
+	if err := cur.All(ctx, &flashcards); err != nil {
+		return nil, err
+	}
+
+	return flashcards, nil
+}
+
+func (r *FlashcardsRepo) UpdateFlashCard(
+	ctx context.Context,
+	collectionID primitive.ObjectID,
+	card Flashcard,
+) error {
+	update := bson.M{"$set": dbutils.Touched(ctx, bson.M{
+		"frontText":    card.FrontText,
+		"backText":     card.BackText,
+		"kind":         card.Kind,
+		"tags":         card.Tags,
+		"examples":     card.Examples,
+		"ipa":          card.IPA,
+		"partOfSpeech": card.PartOfSpeech,
+	})}
+
+	return r.updateCard(ctx, collectionID, card.ID, update)
 }
 
 func (r *FlashcardsRepo) DeleteFlashCard(
+	ctx context.Context,
 	collectionID primitive.ObjectID,
 	cardID primitive.ObjectID,
 ) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 
-	update := bson.M{
-		"$pull": bson.M{
-			"flashcards": bson.M{"_id": cardID},
-			"viewed":     cardID,
-			"total":      cardID,
-		},
-		"$set": bson.M{"updatedAt": primitive.NewDateTimeFromTime(time.Now())},
-	}
-	cur, err := r.UpdateByID(ctx, collectionID, update)
+	cur, err := r.Cards.DeleteOne(ctx, bson.M{"_id": cardID, "collectionId": collectionID})
 	if err != nil {
 		return err
 	}
 
-	if cur.MatchedCount == 0 || cur.ModifiedCount == 0 {
+	if cur.DeletedCount == 0 {
 		return mongo.ErrNoDocuments
 	}
 
-	return nil
+	return r.touch(ctx, collectionID)
+}
+
+func (r *FlashcardsRepo) DeleteByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	result, err := r.DeleteMany(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (r *FlashcardsRepo) CountByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	return r.CountDocuments(ctx, bson.M{"userId": userID})
+}
+
+func (r *FlashcardsRepo) DeleteFlashcardsByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	result, err := r.Cards.DeleteMany(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (r *FlashcardsRepo) CountFlashcardsByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	return r.Cards.CountDocuments(ctx, bson.M{"userId": userID})
 }
@@ -2,13 +2,17 @@ package repo_test
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	dbutils "blinders/packages/dbutils"
 	"blinders/services/practice/repo"
+	"blinders/services/practice/srs"
 
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -28,8 +32,6 @@ func TestInsertFlashcardCollection(t *testing.T) {
 		UserID: primitive.NewObjectID(),
 		Name:   "test collection",
 		Type:   "DefaultFlashcard",
-		Total:  []primitive.ObjectID{},
-		Viewed: []primitive.ObjectID{},
 		FlashCards: &[]*repo.Flashcard{
 			{
 				FrontText: "front text",
@@ -42,7 +44,7 @@ func TestInsertFlashcardCollection(t *testing.T) {
 		},
 	}
 
-	insertedCollection, err := r.InsertRaw(&collection)
+	insertedCollection, err := r.InsertRaw(context.Background(), &collection)
 	assert.NoError(t, err)
 	assert.NotNil(t, insertedCollection)
 
@@ -54,22 +56,24 @@ func TestInsertFlashcardCollection(t *testing.T) {
 	assert.Equal(t, collection.Name, insertedCollection.Name)
 	assert.Equal(t, collection.Type, insertedCollection.Type)
 
-	gotCollection, err := r.GetByID(insertedCollection.ID)
+	gotCollection, err := r.GetByID(context.Background(), insertedCollection.ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, gotCollection)
 
-	assert.NotNil(t, gotCollection.FlashCards)
-	assert.Equal(t, len(*collection.FlashCards), len(*gotCollection.FlashCards))
+	// the collection document only
+	assert.Nil(t, gotCollection.FlashCards)
+	assert.Equal(t, int64(0), gotCollection.TotalCount)
 	assert.Equal(t, insertedCollection.UserID, gotCollection.UserID)
 	assert.Equal(t, insertedCollection.Name, gotCollection.Name)
 	assert.Equal(t, insertedCollection.Type, gotCollection.Type)
 
-	gotCollection, err = r.GetCollectionByID(insertedCollection.ID)
+	gotCollection, err = r.GetCollectionByID(context.Background(), insertedCollection.ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, gotCollection)
 
-	assert.NotNil(t, gotCollection.FlashCards)
-	assert.Equal(t, len(*collection.FlashCards), len(*gotCollection.FlashCards))
+	assert.Nil(t, gotCollection.FlashCards)
+	assert.Equal(t, int64(len(*collection.FlashCards)), gotCollection.TotalCount)
+	assert.Equal(t, int64(0), gotCollection.ViewedCount)
 	assert.Equal(t, insertedCollection.UserID, gotCollection.UserID)
 	assert.Equal(t, insertedCollection.Name, gotCollection.Name)
 	assert.Equal(t, insertedCollection.Type, gotCollection.Type)
@@ -85,11 +89,9 @@ func TestGetByUserID(t *testing.T) {
 		Name:       "test collection",
 		Type:       "DefaultFlashcard",
 		FlashCards: &[]*repo.Flashcard{},
-		Total:      []primitive.ObjectID{},
-		Viewed:     []primitive.ObjectID{},
 	}
 
-	insertedCollection, err := r.InsertRaw(&collection)
+	insertedCollection, err := r.InsertRaw(context.Background(), &collection)
 	assert.NoError(t, err)
 	assert.NotNil(t, insertedCollection)
 
@@ -100,19 +102,21 @@ func TestGetByUserID(t *testing.T) {
 	assert.Equal(t, collection.Name, insertedCollection.Name)
 	assert.Equal(t, collection.Type, insertedCollection.Type)
 
-	collections, err := r.GetByUserID(insertedCollection.UserID)
+	collections, err := r.GetByUserID(context.Background(), insertedCollection.UserID)
 	assert.Nil(t, err)
 	assert.NotNil(t, collection)
 	assert.Equal(t, 1, len(collections))
 	gotCollection := collections[0]
 
-	assert.Equal(t, len(*collection.FlashCards), len(*gotCollection.FlashCards))
+	assert.Equal(t, int64(len(*collection.FlashCards)), gotCollection.TotalCount)
+	assert.Equal(t, insertedCollection.Total, gotCollection.Total)
+	assert.Equal(t, len(*insertedCollection.FlashCards), len(*gotCollection.FlashCards))
 	assert.Equal(t, insertedCollection.UserID, gotCollection.UserID)
 	assert.Equal(t, insertedCollection.Name, gotCollection.Name)
 	assert.Equal(t, insertedCollection.Type, gotCollection.Type)
 
 	invalidUserID := primitive.NewObjectID()
-	invalidCollections, err := r.GetByUserID(invalidUserID)
+	invalidCollections, err := r.GetByUserID(context.Background(), invalidUserID)
 	assert.NotNil(t, err)
 	assert.Nil(t, invalidCollections)
 }
@@ -130,45 +134,39 @@ func GetCollectionsByType(t *testing.T) {
 			Name:       "test collection1",
 			Type:       "DefaultFlashcard",
 			FlashCards: &[]*repo.Flashcard{},
-			Total:      []primitive.ObjectID{},
-			Viewed:     []primitive.ObjectID{},
 		},
 		{
 			UserID:     userID,
 			Name:       "test collection2",
 			Type:       "DefaultFlashcard",
 			FlashCards: &[]*repo.Flashcard{},
-			Total:      []primitive.ObjectID{},
-			Viewed:     []primitive.ObjectID{},
 		},
 		{
 			UserID:     userID,
 			Name:       "test collection3",
 			Type:       "CustomFlashcard",
 			FlashCards: &[]*repo.Flashcard{},
-			Total:      []primitive.ObjectID{},
-			Viewed:     []primitive.ObjectID{},
 		},
 	}
 
 	for idx, collection := range collections {
-		insertedCollection, err := r.InsertRaw(collection)
+		insertedCollection, err := r.InsertRaw(context.Background(), collection)
 		assert.NoError(t, err)
 		assert.NotNil(t, insertedCollection)
 		collections[idx] = insertedCollection
 	}
 
-	defaultCollections, err := r.GetCollectionsByType(userID, "DefaultFlashcard")
+	defaultCollections, err := r.GetCollectionsByType(context.Background(), userID, "DefaultFlashcard")
 	assert.NoError(t, err)
 	assert.NotNil(t, defaultCollections)
 	assert.Equal(t, 2, len(defaultCollections))
 
-	customCollections, err := r.GetCollectionsByType(userID, "CustomFlashcard")
+	customCollections, err := r.GetCollectionsByType(context.Background(), userID, "CustomFlashcard")
 	assert.NoError(t, err)
 	assert.NotNil(t, customCollections)
 	assert.Equal(t, 1, len(customCollections))
 
-	invalidCollections, err := r.GetCollectionsByType(userID, "InvalidType")
+	invalidCollections, err := r.GetCollectionsByType(context.Background(), userID, "InvalidType")
 	assert.NoError(t, err)
 	assert.NotNil(t, invalidCollections)
 	assert.Equal(t, 0, len(invalidCollections))
@@ -187,36 +185,34 @@ func TestGetCollectionMetadataByUserID(t *testing.T) {
 			Name:       "test collection1",
 			Type:       "DefaultFlashcard",
 			FlashCards: &[]*repo.Flashcard{},
-			Total:      []primitive.ObjectID{},
-			Viewed:     []primitive.ObjectID{},
 		},
 		{
 			UserID:     userID,
 			Name:       "test collection2",
 			Type:       "DefaultFlashcard",
 			FlashCards: &[]*repo.Flashcard{},
-			Total:      []primitive.ObjectID{},
-			Viewed:     []primitive.ObjectID{},
 		},
 	}
 
 	for idx, collection := range collections {
-		insertedCollection, err := r.InsertRaw(collection)
+		insertedCollection, err := r.InsertRaw(context.Background(), collection)
 		assert.NoError(t, err)
 		assert.NotNil(t, insertedCollection)
 		collections[idx] = insertedCollection
 	}
 
-	metadatas, err := r.GetCollectionsMetadataByUserID(userID)
+	metadatas, err := r.GetCollectionsMetadataByUserID(context.Background(), userID)
 	assert.NoError(t, err)
 	assert.NotNil(t, metadatas)
 
 	for _, metadata := range metadatas {
 		assert.Equal(t, userID, metadata.UserID)
+		assert.Nil(t, metadata.FlashCards)
 		for _, collection := range collections {
 			if collection.ID == metadata.ID {
 				assert.Equal(t, collection.Name, metadata.Name)
 				assert.Equal(t, collection.Type, metadata.Type)
+				assert.Equal(t, collection.Total, metadata.Total)
 				break
 			}
 		}
@@ -236,21 +232,17 @@ func TestUpdateCollectionMetadata(t *testing.T) {
 			Name:       "test collection",
 			Type:       "DefaultFlashcard",
 			FlashCards: &[]*repo.Flashcard{},
-			Total:      []primitive.ObjectID{},
-			Viewed:     []primitive.ObjectID{},
 		},
 		{
 			UserID:     userID,
 			Name:       "test collection",
 			Type:       "DefaultFlashcard",
 			FlashCards: &[]*repo.Flashcard{},
-			Total:      []primitive.ObjectID{},
-			Viewed:     []primitive.ObjectID{},
 		},
 	}
 
 	for idx, collection := range collections {
-		insertedCollection, err := r.InsertRaw(collection)
+		insertedCollection, err := r.InsertRaw(context.Background(), collection)
 		assert.NoError(t, err)
 		assert.NotNil(t, insertedCollection)
 		collections[idx] = insertedCollection
@@ -260,10 +252,10 @@ func TestUpdateCollectionMetadata(t *testing.T) {
 	update := collections[0]
 
 	update.Name = "updated collection"
-	err := r.UpdateCollectionMetadata(updateCollectionID, update)
+	err := r.UpdateCollectionMetadata(context.Background(), updateCollectionID, update)
 	assert.NoError(t, err)
 
-	updatedCollection, err := r.GetCollectionsMetadataByID(updateCollectionID)
+	updatedCollection, err := r.GetCollectionsMetadataByID(context.Background(), updateCollectionID)
 	assert.NoError(t, err)
 	assert.Equal(t, update.Name, updatedCollection.Name)
 	assert.Equal(t, update.Type, updatedCollection.Type)
@@ -271,7 +263,7 @@ func TestUpdateCollectionMetadata(t *testing.T) {
 	assert.LessOrEqual(t, update.UpdatedAt, updatedCollection.UpdatedAt)
 
 	invalidCollectionID := primitive.NewObjectID()
-	err = r.UpdateCollectionMetadata(invalidCollectionID, update)
+	err = r.UpdateCollectionMetadata(context.Background(), invalidCollectionID, update)
 	assert.Error(t, err)
 }
 
@@ -285,11 +277,9 @@ func TestAddFlashcardToCollection(t *testing.T) {
 		Name:       "test collection",
 		Type:       "DefaultFlashcard",
 		FlashCards: &[]*repo.Flashcard{},
-		Total:      []primitive.ObjectID{},
-		Viewed:     []primitive.ObjectID{},
 	}
 
-	insertedCollection, err := r.InsertRaw(&collection)
+	insertedCollection, err := r.InsertRaw(context.Background(), &collection)
 	assert.NoError(t, err)
 	assert.NotNil(t, insertedCollection)
 
@@ -305,17 +295,19 @@ func TestAddFlashcardToCollection(t *testing.T) {
 	}
 
 	for _, flashcard := range flashcards {
-		insertedFlashcard, err := r.AddFlashcardToCollection(insertedCollection.ID, flashcard)
+		insertedFlashcard, err := r.AddFlashcardToCollection(context.Background(), insertedCollection.ID, flashcard)
 		assert.Nil(t, err)
 		assert.NotNil(t, insertedFlashcard)
 	}
 
-	updatedCollection, err := r.GetByID(insertedCollection.ID)
+	updatedCollection, err := r.GetCollectionByID(context.Background(), insertedCollection.ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, updatedCollection)
-	assert.NotNil(t, updatedCollection.FlashCards)
+	assert.Equal(t, int64(len(flashcards)), updatedCollection.TotalCount)
 
-	for _, card := range *updatedCollection.FlashCards {
+	page, err := r.GetFlashcardsOfCollection(context.Background(), insertedCollection.ID, "", dbutils.ListOptions{})
+	assert.Nil(t, err)
+	for _, card := range page.Items {
 		for _, flashcard := range flashcards {
 			if card.ID == flashcard.ID {
 				assert.Equal(t, flashcard.FrontText, card.FrontText)
@@ -336,11 +328,9 @@ func TestGetFlashCardByID(t *testing.T) {
 		Name:       "test collection",
 		Type:       "DefaultFlashcard",
 		FlashCards: &[]*repo.Flashcard{},
-		Total:      []primitive.ObjectID{},
-		Viewed:     []primitive.ObjectID{},
 	}
 
-	insertedCollection, err := r.InsertRaw(&collection)
+	insertedCollection, err := r.InsertRaw(context.Background(), &collection)
 	assert.NoError(t, err)
 	assert.NotNil(t, insertedCollection)
 
@@ -349,11 +339,11 @@ func TestGetFlashCardByID(t *testing.T) {
 		BackText:  "back text",
 	}
 
-	insertedFlashcard, err := r.AddFlashcardToCollection(insertedCollection.ID, &flashcard)
+	insertedFlashcard, err := r.AddFlashcardToCollection(context.Background(), insertedCollection.ID, &flashcard)
 	assert.Nil(t, err)
 	assert.NotNil(t, insertedFlashcard)
 
-	gotFlashcard, err := r.GetFlashcardByID(insertedCollection.ID, flashcard.ID)
+	gotFlashcard, err := r.GetFlashcardByID(context.Background(), insertedCollection.ID, flashcard.ID)
 	assert.NoError(t, err)
 	assert.NotNil(t, insertedCollection)
 
@@ -373,7 +363,7 @@ func TestUpdateFlashCardByID(t *testing.T) {
 		FlashCards: &[]*repo.Flashcard{},
 	}
 
-	insertedCollection, err := r.InsertRaw(&collection)
+	insertedCollection, err := r.InsertRaw(context.Background(), &collection)
 	assert.NoError(t, err)
 	assert.NotNil(t, insertedCollection)
 
@@ -382,11 +372,11 @@ func TestUpdateFlashCardByID(t *testing.T) {
 		BackText:  "back text",
 	}
 
-	insertedFlashcard, err := r.AddFlashcardToCollection(insertedCollection.ID, flashcard)
+	insertedFlashcard, err := r.AddFlashcardToCollection(context.Background(), insertedCollection.ID, flashcard)
 	assert.Nil(t, err)
 	assert.NotNil(t, insertedFlashcard)
 
-	gotFlashcard, err := r.GetFlashcardByID(insertedCollection.ID, flashcard.ID)
+	gotFlashcard, err := r.GetFlashcardByID(context.Background(), insertedCollection.ID, flashcard.ID)
 	assert.NoError(t, err)
 	assert.NotNil(t, insertedCollection)
 
@@ -395,10 +385,10 @@ func TestUpdateFlashCardByID(t *testing.T) {
 	update.FrontText = "new front text"
 	update.BackText = "new back text"
 
-	err = r.UpdateFlashCard(insertedCollection.ID, update)
+	err = r.UpdateFlashCard(context.Background(), insertedCollection.ID, update)
 	assert.Nil(t, err)
 
-	updatedFlashcard, err := r.GetFlashcardByID(insertedCollection.ID, update.ID)
+	updatedFlashcard, err := r.GetFlashcardByID(context.Background(), insertedCollection.ID, update.ID)
 	assert.NoError(t, err)
 	assert.NotNil(t, updatedFlashcard)
 
@@ -417,11 +407,9 @@ func TestDeleteFlashcard(t *testing.T) {
 		Name:       "test collection",
 		Type:       "DefaultFlashcard",
 		FlashCards: &[]*repo.Flashcard{},
-		Total:      []primitive.ObjectID{},
-		Viewed:     []primitive.ObjectID{},
 	}
 
-	insertedCollection, err := r.InsertRaw(&collection)
+	insertedCollection, err := r.InsertRaw(context.Background(), &collection)
 	assert.NoError(t, err)
 	assert.NotNil(t, insertedCollection)
 
@@ -430,19 +418,19 @@ func TestDeleteFlashcard(t *testing.T) {
 		BackText:  "back text",
 	}
 
-	insertedFlashcard, err := r.AddFlashcardToCollection(insertedCollection.ID, flashcard)
+	insertedFlashcard, err := r.AddFlashcardToCollection(context.Background(), insertedCollection.ID, flashcard)
 	assert.Nil(t, err)
 	assert.NotNil(t, insertedFlashcard)
 
-	updatedCollection, err := r.GetByID(insertedCollection.ID)
+	updatedCollection, err := r.GetCollectionByID(context.Background(), insertedCollection.ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, insertedFlashcard)
-	assert.Equal(t, len(*insertedCollection.FlashCards)+1, len(*updatedCollection.FlashCards))
+	assert.Equal(t, insertedCollection.TotalCount+1, updatedCollection.TotalCount)
 
-	err = r.DeleteFlashCard(insertedCollection.ID, insertedFlashcard.ID)
+	err = r.DeleteFlashCard(context.Background(), insertedCollection.ID, insertedFlashcard.ID)
 	assert.Nil(t, err)
 
-	failed, err := r.GetFlashcardByID(insertedCollection.ID, insertedFlashcard.ID)
+	failed, err := r.GetFlashcardByID(context.Background(), insertedCollection.ID, insertedFlashcard.ID)
 	assert.NotNil(t, err)
 	assert.Nil(t, failed)
 }
@@ -457,11 +445,9 @@ func TestUpdateLastView(t *testing.T) {
 		Name:       "test collection",
 		Type:       "DefaultFlashcard",
 		FlashCards: &[]*repo.Flashcard{},
-		Total:      []primitive.ObjectID{},
-		Viewed:     []primitive.ObjectID{},
 	}
 
-	insertedCollection, err := r.InsertRaw(&collection)
+	insertedCollection, err := r.InsertRaw(context.Background(), &collection)
 	assert.NoError(t, err)
 	assert.NotNil(t, insertedCollection)
 
@@ -477,31 +463,474 @@ func TestUpdateLastView(t *testing.T) {
 	}
 
 	for idx, flashcard := range flashcards {
-		insertedFlashcard, err := r.AddFlashcardToCollection(insertedCollection.ID, flashcard)
+		insertedFlashcard, err := r.AddFlashcardToCollection(context.Background(), insertedCollection.ID, flashcard)
 		assert.Nil(t, err)
 		assert.NotNil(t, insertedFlashcard)
 		flashcards[idx] = insertedFlashcard
 	}
 
 	for _, flashcard := range flashcards {
-		col, err := r.GetByID(insertedCollection.ID)
+		col, err := r.GetCollectionByID(context.Background(), insertedCollection.ID)
 		assert.NoError(t, err)
-		assert.NotContains(t, col.Viewed, flashcard.ID)
+		assert.Equal(t, int64(0), col.ViewedCount)
 
-		err = r.UpdateFlashcardViewStatus(insertedCollection.ID, flashcard.ID, true)
+		err = r.UpdateFlashcardViewStatus(context.Background(), insertedCollection.ID, flashcard.ID, true)
 		assert.Nil(t, err)
 
-		col, err = r.GetByID(insertedCollection.ID)
+		col, err = r.GetCollectionByID(context.Background(), insertedCollection.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), col.ViewedCount)
+		viewed, err := r.GetFlashcardByID(context.Background(), insertedCollection.ID, flashcard.ID)
 		assert.NoError(t, err)
-		assert.Contains(t, col.Viewed, flashcard.ID)
+		assert.True(t, viewed.Viewed)
 
-		err = r.UpdateFlashcardViewStatus(insertedCollection.ID, flashcard.ID, false)
+		err = r.UpdateFlashcardViewStatus(context.Background(), insertedCollection.ID, flashcard.ID, false)
 		assert.Nil(t, err)
 
-		col, err = r.GetByID(insertedCollection.ID)
+		col, err = r.GetCollectionByID(context.Background(), insertedCollection.ID)
 		assert.NoError(t, err)
-		assert.NotContains(t, col.Viewed, flashcard.ID)
+		assert.Equal(t, int64(0), col.ViewedCount)
+	}
+}
+
+func TestSoftDeleteAndRestoreCollection(t *testing.T) {
+	t.Parallel()
+	r := GetFlashcardTestRepo(t)
+	defer CleanFlashcardRepo(t, r)
+
+	userID := primitive.NewObjectID()
+	ctx := dbutils.WithActor(context.Background(), userID)
+	collection, err := r.InsertRaw(ctx, &repo.FlashcardCollection{
+		UserID:     userID,
+		Name:       "test collection",
+		FlashCards: &[]*repo.Flashcard{{FrontText: "front text", BackText: "back text"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &userID, collection.CreatedBy)
+	assert.Equal(t, &userID, (*collection.FlashCards)[0].CreatedBy)
+
+	assert.NoError(t, r.DeleteByID(ctx, collection.ID))
+	assert.Equal(t, mongo.ErrNoDocuments, r.DeleteByID(ctx, collection.ID))
+
+	_, err = r.GetCollectionByID(ctx, collection.ID)
+	assert.Equal(t, mongo.ErrNoDocuments, err)
+	_, err = r.GetByUserID(ctx, userID)
+	assert.Equal(t, mongo.ErrNoDocuments, err)
+
+	_, err = r.RestoreCollectionOfUser(ctx, collection.ID, primitive.NewObjectID())
+	assert.Equal(t, mongo.ErrNoDocuments, err)
+
+	restored, err := r.RestoreCollectionOfUser(ctx, collection.ID, userID)
+	assert.NoError(t, err)
+	assert.False(t, restored.IsDeleted())
+	assert.Equal(t, &userID, restored.UpdatedBy)
+
+	got, err := r.GetCollectionByID(ctx, collection.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, collection.ID, got.ID)
+}
+
+func TestGetOrCreateDefaultCollection(t *testing.T) {
+	t.Parallel()
+	r := GetFlashcardTestRepo(t)
+	defer CleanFlashcardRepo(t, r)
+
+	userID := primitive.NewObjectID()
+	collection, err := r.GetOrCreateDefaultCollection(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, collection.ID)
+	assert.Equal(t, userID, collection.UserID)
+	assert.Equal(t, repo.DefaultCollectionType, collection.Type)
+	assert.Equal(t, int64(0), collection.TotalCount)
+
+	_, err = r.AddFlashcardToCollection(context.Background(), collection.ID, &repo.Flashcard{
+		FrontText: "front text",
+		BackText:  "back text",
+	})
+	assert.NoError(t, err)
+
+	// the existing collection is returned without changes
+	again, err := r.GetOrCreateDefaultCollection(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Equal(t, collection.ID, again.ID)
+	assert.Equal(t, int64(1), again.TotalCount)
+
+	count, err := r.CountByUserID(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestGetExplainLogIDsOfUser(t *testing.T) {
+	t.Parallel()
+	r := GetFlashcardTestRepo(t)
+	defer CleanFlashcardRepo(t, r)
+
+	userID := primitive.NewObjectID()
+	collection, err := r.InsertRaw(context.Background(), &repo.FlashcardCollection{
+		UserID:     userID,
+		Name:       "test collection",
+		Type:       repo.FromExplainLogCollectionType,
+		FlashCards: &[]*repo.Flashcard{},
+	})
+	assert.NoError(t, err)
+
+	synced, notSynced := primitive.NewObjectID(), primitive.NewObjectID()
+	added, err := r.AddFlashcardsToCollection(context.Background(), collection.ID, []*repo.Flashcard{
+		{
+			Type:      repo.ExplainLogToFlashcardType,
+			FrontText: "front text",
+			BackText:  "back text",
+			Metadata:  &repo.FlashcardMetadata{ExplainLogID: synced},
+		},
+		{FrontText: "front text 1", BackText: "back text 1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(added))
+
+	ids, err := r.GetExplainLogIDsOfUser(context.Background(), userID, []primitive.ObjectID{synced, notSynced})
+	assert.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{synced}, ids)
+
+	ids, err = r.GetExplainLogIDsOfUser(context.Background(), primitive.NewObjectID(), []primitive.ObjectID{synced})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(ids))
+}
+
+func TestGetOrCreateCollectionOfType(t *testing.T) {
+	t.Parallel()
+	r := GetFlashcardTestRepo(t)
+	defer CleanFlashcardRepo(t, r)
+
+	db := r.Collection.Database()
+	assert.NoError(t, dbutils.EnsureIndexes(context.Background(), db, repo.FlashcardsOfTypeIndexes...))
+
+	// concurrent calls get the same collection
+	userID := primitive.NewObjectID()
+	ids := make(chan primitive.ObjectID, 5)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collection, err := r.GetOrCreateCollectionOfType(context.Background(), userID,
+				repo.FromExplainLogCollectionType, "explain logs")
+			assert.NoError(t, err)
+			ids <- collection.ID
+		}()
 	}
+	wg.Wait()
+	close(ids)
+	first := <-ids
+	for id := range ids {
+		assert.Equal(t, first, id)
+	}
+
+	// a deleted collection does not prevent creating a new one
+	assert.NoError(t, r.DeleteByID(context.Background(), first))
+	collection, err := r.GetOrCreateCollectionOfType(context.Background(), userID,
+		repo.FromExplainLogCollectionType, "explain logs")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, collection.ID)
+}
+
+func TestSharedCollection(t *testing.T) {
+	t.Parallel()
+	r := GetFlashcardTestRepo(t)
+	defer CleanFlashcardRepo(t, r)
+
+	collection, err := r.InsertRaw(context.Background(), &repo.FlashcardCollection{
+		UserID:     primitive.NewObjectID(),
+		Name:       "test collection",
+		FlashCards: &[]*repo.Flashcard{{FrontText: "front text", BackText: "back text"}},
+	})
+	assert.NoError(t, err)
+
+	updated, err := r.UpdateCollectionVisibility(context.Background(), collection.ID, repo.LinkVisibility, "token")
+	assert.NoError(t, err)
+	assert.Equal(t, repo.LinkVisibility, updated.Visibility)
+	assert.Equal(t, "token", updated.ShareToken)
+
+	shared, err := r.GetSharedCollection(context.Background(), "token")
+	assert.NoError(t, err)
+	assert.Equal(t, collection.ID, shared.ID)
+	assert.Equal(t, int64(1), shared.TotalCount)
+
+	// the token is kept but private collections are not shared
+	updated, err = r.UpdateCollectionVisibility(context.Background(), collection.ID, repo.PrivateVisibility, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "token", updated.ShareToken)
+
+	_, err = r.GetSharedCollection(context.Background(), "token")
+	assert.Equal(t, mongo.ErrNoDocuments, err)
+}
+
+func TestGetFlashcardsOfCollection(t *testing.T) {
+	t.Parallel()
+	r := GetFlashcardTestRepo(t)
+	defer CleanFlashcardRepo(t, r)
+
+	collection, err := r.InsertRaw(context.Background(), &repo.FlashcardCollection{
+		UserID: primitive.NewObjectID(),
+		Name:   "test collection",
+		FlashCards: &[]*repo.Flashcard{
+			{FrontText: "front text", BackText: "back text", Tags: []string{"verb"}},
+			{FrontText: "front text 1", BackText: "back text 1"},
+			{FrontText: "front text 2", BackText: "back text 2", Tags: []string{"verb"}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), collection.TotalCount)
+
+	page, err := r.GetFlashcardsOfCollection(context.Background(), collection.ID, "", dbutils.ListOptions{Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(page.Items))
+	assert.Equal(t, "front text", page.Items[0].FrontText)
+	assert.NotEmpty(t, page.NextCursor)
+
+	cursor, _ := primitive.ObjectIDFromHex(page.NextCursor)
+	page, err = r.GetFlashcardsOfCollection(context.Background(), collection.ID, "",
+		dbutils.ListOptions{Cursor: cursor, Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(page.Items))
+	assert.Equal(t, "front text 2", page.Items[0].FrontText)
+	assert.Empty(t, page.NextCursor)
+
+	page, err = r.GetFlashcardsOfCollection(context.Background(), collection.ID, "verb", dbutils.ListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(page.Items))
+}
+
+func TestGetByUserIDAndTag(t *testing.T) {
+	t.Parallel()
+	r := GetFlashcardTestRepo(t)
+	defer CleanFlashcardRepo(t, r)
+
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	tagged, err := r.InsertRaw(ctx, &repo.FlashcardCollection{
+		UserID: userID,
+		Name:   "tagged",
+		FlashCards: &[]*repo.Flashcard{
+			{FrontText: "front text", BackText: "back text", Tags: []string{"verb", "travel"}},
+			{FrontText: "front text 1", BackText: "back text 1", Tags: []string{"noun"}},
+			{FrontText: "front text 2", BackText: "back text 2", Tags: []string{"verb"}, Viewed: true},
+		},
+	})
+	assert.NoError(t, err)
+	_, err = r.InsertRaw(ctx, &repo.FlashcardCollection{
+		UserID:     userID,
+		Name:       "untagged",
+		FlashCards: &[]*repo.Flashcard{{FrontText: "front text", BackText: "back text", Tags: []string{"noun"}}},
+	})
+	assert.NoError(t, err)
+
+	collections, err := r.GetByUserIDAndTag(ctx, userID, "verb")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(collections))
+	assert.Equal(t, tagged.ID, collections[0].ID)
+	assert.Equal(t, int64(2), collections[0].TotalCount)
+	assert.Equal(t, int64(1), collections[0].ViewedCount)
+
+	collections, err = r.GetByUserIDAndTag(ctx, userID, "noun")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(collections))
+
+	collections, err = r.GetByUserIDAndTag(ctx, userID, "missing")
+	assert.NoError(t, err)
+	assert.Empty(t, collections)
+
+	collection, err := r.GetCollectionByIDAndTag(ctx, tagged.ID, "travel")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), collection.TotalCount)
+
+	collection, err = r.GetCollectionWithFlashcards(ctx, tagged.ID, "verb")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(*collection.FlashCards))
+	assert.Equal(t, []primitive.ObjectID{(*tagged.FlashCards)[0].ID, (*tagged.FlashCards)[2].ID}, collection.Total)
+	assert.Equal(t, []primitive.ObjectID{(*tagged.FlashCards)[2].ID}, collection.Viewed)
+
+	page, err := r.GetFlashcardsOfCollection(ctx, tagged.ID, "travel", dbutils.ListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(page.Items))
+	assert.Equal(t, "front text", page.Items[0].FrontText)
+}
+
+func TestStudyFlashcardsOfReversedCards(t *testing.T) {
+	t.Parallel()
+	r := GetFlashcardTestRepo(t)
+	defer CleanFlashcardRepo(t, r)
+
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	collection, err := r.InsertRaw(ctx, &repo.FlashcardCollection{
+		UserID: userID,
+		Name:   "test collection",
+		FlashCards: &[]*repo.Flashcard{
+			{FrontText: "basic", BackText: "back text", Kind: repo.BasicCardKind},
+			{FrontText: "reversed", BackText: "back text", Kind: repo.ReversedCardKind},
+		},
+	})
+	assert.NoError(t, err)
+
+	// both sides of the reversed card are new
+	news, err := r.GetNewFlashcards(ctx, userID, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(news))
+	sides := map[string][]bool{}
+	for _, card := range news {
+		sides[card.FrontText] = append(sides[card.FrontText], card.Reversed)
+	}
+	assert.Equal(t, []bool{false}, sides["basic"])
+	assert.ElementsMatch(t, []bool{false, true}, sides["reversed"])
+
+	// only the back of the reversed card is reviewed, it is due while its front stays new
+	now := time.Now()
+	reversed := (*collection.FlashCards)[1]
+	review := srs.State{Ease: 2.5, Interval: 1, Repetitions: 1, DueAt: now.Add(-time.Hour), ReviewedAt: now.Add(-srs.Day)}
+	err = r.UpdateFlashcardReview(ctx, collection.ID, reversed.ID, review, true)
+	assert.NoError(t, err)
+
+	due, err := r.GetDueFlashcards(ctx, userID, now, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(due))
+	assert.Equal(t, reversed.ID, due[0].ID)
+	assert.True(t, due[0].Reversed)
+
+	news, err = r.GetNewFlashcards(ctx, userID, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(news))
+	for _, card := range news {
+		assert.False(t, card.Reversed)
+	}
+}
+
+func TestEachFlashcardOfCollection(t *testing.T) {
+	t.Parallel()
+	r := GetFlashcardTestRepo(t)
+	defer CleanFlashcardRepo(t, r)
+
+	collection, err := r.InsertRaw(context.Background(), &repo.FlashcardCollection{
+		UserID: primitive.NewObjectID(),
+		Name:   "test collection",
+		FlashCards: &[]*repo.Flashcard{
+			{FrontText: "front text", BackText: "back text"},
+			{FrontText: "front text 1", BackText: "back text 1"},
+		},
+	})
+	assert.NoError(t, err)
+
+	fronts := make([]string, 0)
+	err = r.EachFlashcardOfCollection(context.Background(), collection.ID, func(flashcard *repo.Flashcard) error {
+		fronts = append(fronts, flashcard.FrontText)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"front text", "front text 1"}, fronts)
+
+	stop := errors.New("stop")
+	err = r.EachFlashcardOfCollection(context.Background(), collection.ID, func(*repo.Flashcard) error {
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+}
+
+func TestCopyFlashcards(t *testing.T) {
+	t.Parallel()
+	r := GetFlashcardTestRepo(t)
+	defer CleanFlashcardRepo(t, r)
+
+	ctx := context.Background()
+	source, err := r.InsertRaw(ctx, &repo.FlashcardCollection{
+		UserID: primitive.NewObjectID(),
+		Name:   "source",
+		FlashCards: &[]*repo.Flashcard{
+			{FrontText: "front text", BackText: "back text", Viewed: true},
+			{FrontText: "front text 1", BackText: "back text 1"},
+		},
+	})
+	assert.NoError(t, err)
+
+	userID := primitive.NewObjectID()
+	clone, err := r.InsertRaw(ctx, &repo.FlashcardCollection{UserID: userID, Name: "clone"})
+	assert.NoError(t, err)
+
+	copied, err := r.CopyFlashcards(ctx, source.ID, clone)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), copied)
+	assert.Equal(t, int64(2), clone.TotalCount)
+
+	got, err := r.GetCollectionByID(ctx, clone.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), got.TotalCount)
+	assert.Equal(t, int64(0), got.ViewedCount)
+
+	page, err := r.GetFlashcardsOfCollection(ctx, clone.ID, "", dbutils.ListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(page.Items))
+	assert.Equal(t, userID, page.Items[0].UserID)
+	assert.NotEqual(t, (*source.FlashCards)[0].ID, page.Items[0].ID)
+}
+
+// not parallel, the migration moves flashcards of the whole test database
+func TestMoveFlashcardsToCards(t *testing.T) {
+	r := GetFlashcardTestRepo(t)
+	defer CleanFlashcardRepo(t, r)
+
+	userID, collectionID := primitive.NewObjectID(), primitive.NewObjectID()
+	viewed, notViewed := primitive.NewObjectID(), primitive.NewObjectID()
+	_, err := r.InsertOne(context.Background(), bson.M{
+		"_id":    collectionID,
+		"userId": userID,
+		"name":   "embedded collection",
+		"viewed": bson.A{viewed},
+		"total":  bson.A{viewed, notViewed},
+		"flashcards": bson.A{
+			bson.M{"_id": viewed, "frontText": "front text", "backText": "back text"},
+			bson.M{"_id": notViewed, "frontText": "front text 1", "backText": "back text 1"},
+		},
+	})
+	assert.NoError(t, err)
+
+	db := r.Collection.Database()
+	assert.NoError(t, dbutils.EnsureIndexes(context.Background(), db, repo.CardsIndexes...))
+	assert.NoError(t, repo.MoveFlashcardsToCards(context.Background(), db))
+	// moved cards are upserted, moving again changes nothing
+	assert.NoError(t, repo.MoveFlashcardsToCards(context.Background(), db))
+
+	raw, err := r.Collection.FindOne(context.Background(), bson.M{"_id": collectionID}).Raw()
+	assert.NoError(t, err)
+	_, err = raw.LookupErr("flashcards")
+	assert.Error(t, err)
+
+	collection, err := r.GetCollectionByID(context.Background(), collectionID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), collection.TotalCount)
+	assert.Equal(t, int64(1), collection.ViewedCount)
+
+	page, err := r.GetFlashcardsOfCollection(context.Background(), collectionID, "", dbutils.ListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{viewed, notViewed}, []primitive.ObjectID{page.Items[0].ID, page.Items[1].ID})
+	assert.True(t, page.Items[0].Viewed)
+	assert.Equal(t, userID, page.Items[0].UserID)
+
+	assert.NoError(t, repo.MoveCardsToFlashcards(context.Background(), db))
+
+	var embedded struct {
+		Viewed     []primitive.ObjectID `bson:"viewed"`
+		FlashCards []*repo.Flashcard    `bson:"flashcards"`
+	}
+	err = r.Collection.FindOne(context.Background(), bson.M{"_id": collectionID}).Decode(&embedded)
+	assert.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{viewed}, embedded.Viewed)
+	assert.Equal(t, 2, len(embedded.FlashCards))
+
+	// cards are emptied without dropping the indexes of their own migration
+	count, err := r.Cards.CountDocuments(context.Background(), bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+	specs, err := r.Cards.Indexes().ListSpecifications(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, len(repo.CardsIndexes)+1, len(specs))
 }
 
 func GetFlashcardTestRepo(t *testing.T) *repo.FlashcardsRepo {
@@ -527,4 +956,6 @@ func CleanFlashcardRepo(t *testing.T, repo *repo.FlashcardsRepo) {
 
 	err := repo.Collection.Drop(ctx)
 	assert.NoError(t, err)
+	err = repo.Cards.Drop(ctx)
+	assert.NoError(t, err)
 }
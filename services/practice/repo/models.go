@@ -1,15 +1,21 @@
 package repo
 
 import (
+	"errors"
+	"regexp"
+	"strings"
+
 	dbutils "blinders/packages/dbutils"
+	"blinders/services/practice/srs"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type (
-	CollectionType string
-	SnapshotType   string
-	FlashcardType  string
+	CollectionType       string
+	CollectionVisibility string
+	SnapshotType         string
+	FlashcardType        string
 )
 
 const (
@@ -17,6 +23,11 @@ const (
 	FromExplainLogCollectionType CollectionType = "FromExplainLogCollection"
 	DefaultCollectionType        CollectionType = "DefaultCollection"
 
+	// collections without visibility are private
+	PrivateVisibility CollectionVisibility = "private"
+	LinkVisibility    CollectionVisibility = "link"
+	PublicVisibility  CollectionVisibility = "public"
+
 	ExplainLogToFlashcardSnapshotType SnapshotType = "ExplainLogToFlashcardSnapshot"
 
 	ExplainLogToFlashcardType FlashcardType = "ExplainLogFlashcard"
@@ -24,33 +35,169 @@ const (
 	DefaultFlashcardType      FlashcardType = "ManualFlashcard"
 )
 
+// FlashcardCollection is stored without its flashcards, they are documents of the cards collection.
+// Reads of the repo fill ViewedCount and TotalCount from the cards of the collection. FlashCards, Viewed
+// and Total (IDs of the flashcards) are only filled by reads returning the collection with its flashcards
 type FlashcardCollection struct {
 	dbutils.RawModel `json:",inline" bson:",inline"`
 	Type             CollectionType       `json:"type"                 bson:"type"`
 	Name             string               `json:"name"                 bson:"name"`
 	Description      string               `json:"description"          bson:"description"`
-	Viewed           []primitive.ObjectID `json:"viewed"               bson:"viewed"`
-	Total            []primitive.ObjectID `json:"total"                bson:"total"`
+	Viewed           []primitive.ObjectID `json:"viewed"               bson:"-"`
+	Total            []primitive.ObjectID `json:"total"                bson:"-"`
+	ViewedCount      int64                `json:"viewedCount"          bson:"-"`
+	TotalCount       int64                `json:"totalCount"           bson:"-"`
 	UserID           primitive.ObjectID   `json:"userId"               bson:"userId"`
-	FlashCards       *[]*Flashcard        `json:"flashcards,omitempty" bson:"flashcards"`
+	FlashCards       *[]*Flashcard        `json:"flashcards,omitempty" bson:"flashcards,omitempty"`
 	Metadata         map[string]any       `json:"metadata,omitempty"   bson:"metadata,omitempty"`
+	Visibility       CollectionVisibility `json:"visibility,omitempty" bson:"visibility,omitempty"`
+	ShareToken       string               `json:"shareToken,omitempty" bson:"shareToken,omitempty"`
+	ClonedFrom       *CollectionSource    `json:"clonedFrom,omitempty" bson:"clonedFrom,omitempty"`
+}
+
+func (v CollectionVisibility) IsValid() bool {
+	return v == PrivateVisibility || v == LinkVisibility || v == PublicVisibility
+}
+
+// IsShared reports if users other than the owner can read the collection with its share token
+func (c *FlashcardCollection) IsShared() bool {
+	return c.Visibility == LinkVisibility || c.Visibility == PublicVisibility
+}
+
+// CollectionSource attributes a cloned collection to the collection it is cloned from
+type CollectionSource struct {
+	CollectionID primitive.ObjectID `json:"collectionId" bson:"collectionId"`
+	UserID       primitive.ObjectID `json:"userId"       bson:"userId"`
+	Name         string             `json:"name"         bson:"name"`
 }
 
 type Flashcard struct {
-	dbutils.RawModel `              json:",inline"            bson:",inline"`
-	Type             FlashcardType `json:"type"               bson:"type"`
-	FrontText        string        `json:"frontText"          bson:"frontText"`
-	BackText         string        `json:"backText"           bson:"backText"`
-	Metadata         any           `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	dbutils.RawModel `                   json:",inline"                 bson:",inline"`
+	CollectionID     primitive.ObjectID `json:"collectionId,omitempty"  bson:"collectionId"`
+	UserID           primitive.ObjectID `json:"userId,omitempty"        bson:"userId"`
+	Type             FlashcardType      `json:"type"                    bson:"type"`
+	Kind             CardKind           `json:"kind,omitempty"          bson:"kind,omitempty"`
+	FrontText        string             `json:"frontText"               bson:"frontText"`
+	BackText         string             `json:"backText"                bson:"backText"`
+	Tags             []string           `json:"tags,omitempty"          bson:"tags,omitempty"`
+	Examples         []string           `json:"examples,omitempty"      bson:"examples,omitempty"`
+	IPA              string             `json:"ipa,omitempty"           bson:"ipa,omitempty"`
+	PartOfSpeech     string             `json:"partOfSpeech,omitempty"  bson:"partOfSpeech,omitempty"`
+	Viewed           bool               `json:"viewed,omitempty"        bson:"viewed,omitempty"`
+	Metadata         *FlashcardMetadata `json:"metadata,omitempty"      bson:"metadata,omitempty"`
+	Review           *srs.State         `json:"review,omitempty"        bson:"review,omitempty"`
+	ReverseReview    *srs.State         `json:"reverseReview,omitempty" bson:"reverseReview,omitempty"`
+}
+
+// CardKind is how a flashcard is studied, flashcards without kind are basic.
+// Reversed cards are also studied from the back to the front, with their own review state.
+// Cloze cards hide the deletions of the front, e.g. "I {{c1::went}} home"
+type CardKind string
+
+const (
+	BasicCardKind    CardKind = "basic"
+	ReversedCardKind CardKind = "reversed"
+	ClozeCardKind    CardKind = "cloze"
+)
+
+var clozeDeletion = regexp.MustCompile(`\{\{c\d+::[^}]+\}\}`)
+
+var (
+	ErrInvalidCardKind = errors.New("kind must be basic, reversed or cloze")
+	ErrEmptyFrontText  = errors.New("front text is empty")
+	ErrNoClozeDeletion = errors.New("cloze card must have a deletion like {{c1::text}}")
+)
+
+// Validate checks the kind and the texts of the flashcard
+func (c *Flashcard) Validate() error {
+	switch {
+	case c.Kind != "" && c.Kind != BasicCardKind && c.Kind != ReversedCardKind && c.Kind != ClozeCardKind:
+		return ErrInvalidCardKind
+	case strings.TrimSpace(c.FrontText) == "":
+		return ErrEmptyFrontText
+	case c.Kind == ClozeCardKind && !clozeDeletion.MatchString(c.FrontText):
+		return ErrNoClozeDeletion
+	}
+	return nil
 }
 
-type ExplainLogFlashcardMetadata struct {
-	ExplainLogID primitive.ObjectID `json:"explainLogId" bson:"explain_log_id"`
+// ResetProgress clears the view status and the review states, e.g. for copies of the flashcard
+func (c *Flashcard) ResetProgress() {
+	c.Viewed = false
+	c.Review = nil
+	c.ReverseReview = nil
 }
 
+// FlashcardMetadata links a flashcard to where it is generated from
+type FlashcardMetadata struct {
+	ExplainLogID primitive.ObjectID `json:"explainLogId,omitempty" bson:"explain_log_id,omitempty"`
+}
+
+// ExplainLog is the read model of explanations stored by the suggest service
+type ExplainLog struct {
+	dbutils.RawModel `json:",inline" bson:",inline"`
+	UserID           primitive.ObjectID `json:"userId"   bson:"userId"`
+	Phrase           string             `json:"phrase"   bson:"phrase"`
+	Sentence         string             `json:"sentence" bson:"sentence"`
+	Response         ExplainLogResponse `json:"response" bson:"response"`
+}
+
+type ExplainLogResponse struct {
+	Translate       string            `json:"translate"       bson:"translate"`
+	IPA             string            `json:"IPA"             bson:"IPA"`
+	GrammarAnalysis ExplainLogGrammar `json:"grammarAnalysis" bson:"grammarAnalysis"`
+}
+
+type ExplainLogGrammar struct {
+	Tense struct {
+		Type string `json:"type" bson:"type"`
+	} `json:"tense"     bson:"tense"`
+	Structure struct {
+		Structure string `json:"structure" bson:"structure"`
+	} `json:"structure" bson:"structure"`
+}
+
+// PracticeSnapshot is the position of the user in a stream of documents, Current is the time of the last
+// document and CurrentID is its ID, documents created at the same time are ordered by ID
 type PracticeSnapshot struct {
 	dbutils.RawModel `json:",inline" bson:",inline"`
-	Type             SnapshotType       `json:"type"    bson:"type"`
-	UserID           primitive.ObjectID `json:"userId"  bson:"userId"`
-	Current          primitive.DateTime `json:"current" bson:"current"`
+	Type             SnapshotType       `json:"type"                bson:"type"`
+	UserID           primitive.ObjectID `json:"userId"              bson:"userId"`
+	Current          primitive.DateTime `json:"current"             bson:"current"`
+	CurrentID        primitive.ObjectID `json:"currentId,omitempty" bson:"currentId,omitempty"`
+}
+
+// ReviewLog records a review of a flashcard with the scheduling state after it,
+// IsNew is set on the first review of the flashcard and Duration is the time spent on it in milliseconds
+type ReviewLog struct {
+	dbutils.RawModel `json:",inline" bson:",inline"`
+	UserID           primitive.ObjectID `json:"userId"              bson:"userId"`
+	CollectionID     primitive.ObjectID `json:"collectionId"        bson:"collectionId"`
+	FlashcardID      primitive.ObjectID `json:"flashcardId"         bson:"flashcardId"`
+	Grade            srs.Grade          `json:"grade"               bson:"grade"`
+	State            srs.State          `json:"state"               bson:"state"`
+	IsNew            bool               `json:"isNew"               bson:"isNew"`
+	Reversed         bool               `json:"reversed,omitempty"  bson:"reversed,omitempty"`
+	SessionID        string             `json:"sessionId,omitempty" bson:"sessionId,omitempty"`
+	Duration         int64              `json:"duration,omitempty"  bson:"duration,omitempty"`
+}
+
+// ActivityLog counts the practice of a user in a day, Day is the local date (see activity.DayLayout)
+// in the timezone of the user. Reviews include the first reviews of new cards, which are also counted in NewCards.
+// TimeSpent is in milliseconds
+type ActivityLog struct {
+	dbutils.RawModel `json:",inline" bson:",inline"`
+	UserID           primitive.ObjectID `json:"userId"    bson:"userId"`
+	Day              string             `json:"day"       bson:"day"`
+	Reviews          int64              `json:"reviews"   bson:"reviews"`
+	Correct          int64              `json:"correct"   bson:"correct"`
+	NewCards         int64              `json:"newCards"  bson:"newCards"`
+	Views            int64              `json:"views"     bson:"views"`
+	TimeSpent        int64              `json:"timeSpent" bson:"timeSpent"`
+}
+
+// StudyFlashcard is a flashcard of a study session, reversed cards are studied twice, once with Reversed set
+type StudyFlashcard struct {
+	Flashcard `json:",inline" bson:",inline"`
+	Reversed  bool `json:"reversed" bson:"reversed"`
 }
@@ -0,0 +1,27 @@
+package repo_test
+
+import (
+	"testing"
+
+	"blinders/services/practice/repo"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlashcardValidate(t *testing.T) {
+	cases := []struct {
+		card repo.Flashcard
+		err  error
+	}{
+		{repo.Flashcard{FrontText: "hello"}, nil},
+		{repo.Flashcard{Kind: repo.ReversedCardKind, FrontText: "hello"}, nil},
+		{repo.Flashcard{Kind: repo.ClozeCardKind, FrontText: "I {{c1::went}} home"}, nil},
+		{repo.Flashcard{Kind: "unknown", FrontText: "hello"}, repo.ErrInvalidCardKind},
+		{repo.Flashcard{Kind: repo.BasicCardKind, FrontText: "  "}, repo.ErrEmptyFrontText},
+		{repo.Flashcard{Kind: repo.ClozeCardKind, FrontText: "I went home"}, repo.ErrNoClozeDeletion},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.err, c.card.Validate(), c.card.FrontText)
+	}
+}
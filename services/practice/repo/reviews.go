@@ -0,0 +1,143 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	dbutils "blinders/packages/dbutils"
+	"blinders/services/practice/srs"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const ReviewLogsColName = "review-logs"
+
+type ReviewLogsRepo struct {
+	dbutils.SingleCollectionRepo[*ReviewLog]
+}
+
+var ReviewLogsIndexes = []dbutils.IndexSpec{
+	{
+		// reviews of a user, recent first
+		Collection: ReviewLogsColName,
+		Name:       "userId_1_createdAt_-1",
+		Keys:       bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+	},
+	{
+		Collection: ReviewLogsColName,
+		Name:       "flashcardId_1_createdAt_-1",
+		Keys:       bson.D{{Key: "flashcardId", Value: 1}, {Key: "createdAt", Value: -1}},
+	},
+}
+
+func NewReviewLogsRepo(db *mongo.Database) *ReviewLogsRepo {
+	col := db.Collection(ReviewLogsColName)
+	return &ReviewLogsRepo{
+		SingleCollectionRepo: dbutils.SingleCollectionRepo[*ReviewLog]{
+			Collection: col,
+			Timeout:    time.Second * 5,
+		},
+	}
+}
+
+// GetByFlashcardID returns the review history of the flashcard in the collection, recent first
+func (r *ReviewLogsRepo) GetByFlashcardID(
+	ctx context.Context,
+	collectionID,
+	flashcardID primitive.ObjectID,
+) ([]*ReviewLog, error) {
+	filter := bson.M{"collectionId": collectionID, "flashcardId": flashcardID}
+	return r.Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": -1}))
+}
+
+// CountSince counts reviews of the user since the time, and how many of them are first reviews of new cards
+func (r *ReviewLogsRepo) CountSince(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	since time.Time,
+) (reviews int64, news int64, err error) {
+	filter := bson.M{
+		"userId":    userID,
+		"createdAt": bson.M{"$gte": primitive.NewDateTimeFromTime(since)},
+	}
+	if reviews, err = r.Count(ctx, filter); err != nil {
+		return 0, 0, err
+	}
+
+	filter["isNew"] = true
+	if news, err = r.Count(ctx, filter); err != nil {
+		return 0, 0, err
+	}
+
+	return reviews - news, news, nil
+}
+
+// CollectionReviews counts reviews of learned cards (without first reviews of new cards) of a collection
+type CollectionReviews struct {
+	CollectionID primitive.ObjectID `json:"collectionId" bson:"_id"`
+	Reviews      int64              `json:"reviews"      bson:"reviews"`
+	Correct      int64              `json:"correct"      bson:"correct"`
+}
+
+// CountByCollectionSince counts reviews of learned cards of the user since the time per collection
+func (r *ReviewLogsRepo) CountByCollectionSince(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	since time.Time,
+) ([]*CollectionReviews, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"userId":    userID,
+			"createdAt": bson.M{"$gte": primitive.NewDateTimeFromTime(since)},
+			"isNew":     false,
+		}},
+		{"$group": bson.M{
+			"_id":     "$collectionId",
+			"reviews": bson.M{"$sum": 1},
+			"correct": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$gte": bson.A{"$grade", srs.GradeHard}}, 1, 0,
+			}}},
+		}},
+	}
+
+	cur, err := r.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	counts := make([]*CollectionReviews, 0)
+	if err := cur.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func (r *ReviewLogsRepo) DeleteByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	result, err := r.DeleteMany(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (r *ReviewLogsRepo) CountByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	return r.Count(ctx, bson.M{"userId": userID})
+}
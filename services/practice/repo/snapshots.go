@@ -9,6 +9,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const SnapshotColName = "snapshots"
@@ -17,56 +18,140 @@ type SnapshotsRepo struct {
 	dbutils.SingleCollectionRepo[*PracticeSnapshot]
 }
 
+var SnapshotsIndexes = []dbutils.IndexSpec{
+	{
+		Collection: SnapshotColName,
+		Name:       "userId_1_type_1",
+		Keys:       bson.D{{Key: "userId", Value: 1}, {Key: "type", Value: 1}},
+	},
+}
+
+// SnapshotsUniqueIndexes replaces SnapshotsIndexes, each user has one snapshot of each type
+var SnapshotsUniqueIndexes = []dbutils.IndexSpec{
+	{
+		Collection: SnapshotColName,
+		Name:       "userId_1_type_1_unique",
+		Keys:       bson.D{{Key: "userId", Value: 1}, {Key: "type", Value: 1}},
+		Unique:     true,
+	},
+}
+
+// MakeSnapshotsUnique removes duplicated snapshots of a user and type, the most advanced one is kept,
+// and replaces SnapshotsIndexes with SnapshotsUniqueIndexes
+func MakeSnapshotsUnique(ctx context.Context, db *mongo.Database) error {
+	snapshots := db.Collection(SnapshotColName)
+
+	cur, err := snapshots.Aggregate(ctx, []bson.M{
+		{"$sort": bson.D{{Key: "current", Value: -1}, {Key: "currentId", Value: -1}}},
+		{"$group": bson.M{
+			"_id": bson.M{"userId": "$userId", "type": "$type"},
+			"ids": bson.M{"$push": "$_id"},
+		}},
+		{"$match": bson.M{"ids.1": bson.M{"$exists": true}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var duplicated struct {
+			IDs []primitive.ObjectID `bson:"ids"`
+		}
+		if err := cur.Decode(&duplicated); err != nil {
+			return err
+		}
+		if _, err := snapshots.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": duplicated.IDs[1:]}}); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	if err := dbutils.DropIndexes(ctx, db, SnapshotsIndexes...); err != nil {
+		return err
+	}
+	return dbutils.EnsureIndexes(ctx, db, SnapshotsUniqueIndexes...)
+}
+
+// MakeSnapshotsNonUnique replaces SnapshotsUniqueIndexes with SnapshotsIndexes
+func MakeSnapshotsNonUnique(ctx context.Context, db *mongo.Database) error {
+	if err := dbutils.DropIndexes(ctx, db, SnapshotsUniqueIndexes...); err != nil {
+		return err
+	}
+	return dbutils.EnsureIndexes(ctx, db, SnapshotsIndexes...)
+}
+
 func NewSnapshotsRepo(db *mongo.Database) *SnapshotsRepo {
 	col := db.Collection(SnapshotColName)
 	return &SnapshotsRepo{
-		SingleCollectionRepo: dbutils.SingleCollectionRepo[*PracticeSnapshot]{Collection: col},
+		SingleCollectionRepo: dbutils.SingleCollectionRepo[*PracticeSnapshot]{
+			Collection: col,
+			Timeout:    time.Second * 5,
+		},
 	}
 }
 
 func (r SnapshotsRepo) GetSnapshotOfUserByType(
+	ctx context.Context,
 	userID primitive.ObjectID,
 	typ SnapshotType,
 ) (*PracticeSnapshot, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-
 	filter := bson.M{
 		"userId": userID,
 		"type":   typ,
 	}
 
-	var snapshot *PracticeSnapshot
-	if err := r.FindOne(ctx, filter).Decode(&snapshot); err != nil {
+	snapshots, err := r.Find(ctx, filter, options.Find().SetLimit(1))
+	if err != nil {
 		return nil, err
 	}
+	if len(snapshots) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
 
-	return snapshot, nil
+	return snapshots[0], nil
 }
 
-func (r SnapshotsRepo) UpdateSnapshot(updateSnapshot *PracticeSnapshot) (*PracticeSnapshot, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-	updateSnapshot.SetUpdatedAtByNow()
+func (r SnapshotsRepo) UpdateSnapshot(
+	ctx context.Context,
+	updateSnapshot *PracticeSnapshot,
+) (*PracticeSnapshot, error) {
+	return r.UpdateFieldsByID(ctx, updateSnapshot.ID, bson.M{"current": updateSnapshot.Current})
+}
 
-	filter := bson.M{
-		"_id": updateSnapshot.ID,
-	}
-	update := bson.M{
-		"$set": bson.M{
-			"current":   updateSnapshot.Current,
-			"updatedAt": updateSnapshot.UpdatedAt,
-		},
-	}
+// AdvanceSnapshot sets the current position of the snapshot of the user to the document created at current
+// with the ID, the snapshot is created if missing
+func (r SnapshotsRepo) AdvanceSnapshot(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	typ SnapshotType,
+	current primitive.DateTime,
+	currentID primitive.ObjectID,
+) (*PracticeSnapshot, error) {
+	filter := bson.M{"userId": userID, "type": typ}
+	return r.Upsert(ctx, filter, &PracticeSnapshot{UserID: userID, Type: typ, Current: current, CurrentID: currentID})
+}
+
+func (r SnapshotsRepo) DeleteByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, r.Timeout)
+	defer cancel()
 
-	cur, err := r.Collection.UpdateOne(ctx, filter, update)
+	result, err := r.DeleteMany(ctx, bson.M{"userId": userID})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	if cur.MatchedCount == 0 {
-		return nil, mongo.ErrNoDocuments
-	}
+	return result.DeletedCount, nil
+}
 
-	return updateSnapshot, nil
+func (r SnapshotsRepo) CountByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	return r.Count(ctx, bson.M{"userId": userID})
 }
@@ -9,6 +9,7 @@ import (
 	"blinders/services/practice/repo"
 
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -24,7 +25,7 @@ func TestInsertSnapshot(t *testing.T) {
 		Current: primitive.NewDateTimeFromTime(time.Now()),
 	}
 
-	insertedSnapshot, err := snapshotRepo.InsertRaw(snapshot)
+	insertedSnapshot, err := snapshotRepo.InsertRaw(context.Background(), snapshot)
 	assert.NoError(t, err)
 
 	assert.NotNil(t, insertedSnapshot)
@@ -45,11 +46,12 @@ func TestGetSnapshot(t *testing.T) {
 		Current: primitive.NewDateTimeFromTime(time.Now()),
 	}
 
-	insertedSnapshot, err := snapshotRepo.InsertRaw(snapshot)
+	insertedSnapshot, err := snapshotRepo.InsertRaw(context.Background(), snapshot)
 	assert.NoError(t, err)
 	assert.NotNil(t, insertedSnapshot)
 
 	foundSnapshot, err := snapshotRepo.GetSnapshotOfUserByType(
+		context.Background(),
 		insertedSnapshot.UserID,
 		insertedSnapshot.Type,
 	)
@@ -63,6 +65,7 @@ func TestGetSnapshot(t *testing.T) {
 
 	invalidUserID := primitive.NewObjectID()
 	notFoundSnapshot, err := snapshotRepo.GetSnapshotOfUserByType(
+		context.Background(),
 		invalidUserID,
 		insertedSnapshot.Type,
 	)
@@ -71,6 +74,7 @@ func TestGetSnapshot(t *testing.T) {
 
 	var invalidType repo.SnapshotType = "invalid-type"
 	notFoundSnapshot, err = snapshotRepo.GetSnapshotOfUserByType(
+		context.Background(),
 		insertedSnapshot.UserID,
 		invalidType,
 	)
@@ -90,14 +94,14 @@ func TestUpdateSnapshot(t *testing.T) {
 		Current: primitive.NewDateTimeFromTime(time.Now()),
 	}
 
-	insertedSnapshot, err := snapshotRepo.InsertRaw(snapshot)
+	insertedSnapshot, err := snapshotRepo.InsertRaw(context.Background(), snapshot)
 	assert.NoError(t, err)
 	assert.NotNil(t, insertedSnapshot)
 
 	update := *insertedSnapshot
 	update.Current = primitive.NewDateTimeFromTime(time.Now().Add(time.Hour))
 
-	updatedSnapshot, err := snapshotRepo.UpdateSnapshot(&update)
+	updatedSnapshot, err := snapshotRepo.UpdateSnapshot(context.Background(), &update)
 	assert.NoError(t, err)
 	assert.NotNil(t, updatedSnapshot)
 
@@ -111,11 +115,67 @@ func TestUpdateSnapshot(t *testing.T) {
 	}
 	notExistedSnapshot.SetID(primitive.NewObjectID())
 
-	invalidUpdate, err := snapshotRepo.UpdateSnapshot(&notExistedSnapshot)
+	invalidUpdate, err := snapshotRepo.UpdateSnapshot(context.Background(), &notExistedSnapshot)
 	assert.Error(t, err)
 	assert.Nil(t, invalidUpdate)
 }
 
+func TestListAndCountSnapshots(t *testing.T) {
+	snapshotRepo := GetSnapshotTestRepo(t)
+	defer CleanSnapshotRepo(t, snapshotRepo)
+
+	userID := primitive.NewObjectID()
+	for _, typ := range []repo.SnapshotType{"type-1", "type-2", "type-3"} {
+		_, err := snapshotRepo.InsertRaw(context.Background(), &repo.PracticeSnapshot{
+			UserID:  userID,
+			Type:    typ,
+			Current: primitive.NewDateTimeFromTime(time.Now()),
+		})
+		assert.NoError(t, err)
+	}
+
+	count, err := snapshotRepo.CountByUserID(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	filter := bson.M{"userId": userID}
+	page, err := snapshotRepo.List(context.Background(), filter, dbutils.ListOptions{Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 2)
+	assert.NotEmpty(t, page.NextCursor)
+
+	cursor, err := primitive.ObjectIDFromHex(page.NextCursor)
+	assert.NoError(t, err)
+	page, err = snapshotRepo.List(context.Background(), filter, dbutils.ListOptions{Cursor: cursor, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestUpsertSnapshot(t *testing.T) {
+	snapshotRepo := GetSnapshotTestRepo(t)
+	defer CleanSnapshotRepo(t, snapshotRepo)
+
+	snapshot := &repo.PracticeSnapshot{
+		UserID:  primitive.NewObjectID(),
+		Type:    "test-type",
+		Current: primitive.NewDateTimeFromTime(time.Now()),
+	}
+	filter := bson.M{"userId": snapshot.UserID, "type": snapshot.Type}
+
+	inserted, err := snapshotRepo.Upsert(context.Background(), filter, snapshot)
+	assert.NoError(t, err)
+	assert.False(t, inserted.ID.IsZero())
+	assert.NotZero(t, inserted.CreatedAt)
+
+	snapshot.Current = primitive.NewDateTimeFromTime(time.Now().Add(time.Hour))
+	updated, err := snapshotRepo.Upsert(context.Background(), filter, snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, inserted.ID, updated.ID)
+	assert.Equal(t, inserted.CreatedAt, updated.CreatedAt)
+	assert.Equal(t, snapshot.Current, updated.Current)
+}
+
 func GetSnapshotTestRepo(t *testing.T) *repo.SnapshotsRepo {
 	t.Helper()
 	if client == nil {
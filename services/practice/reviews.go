@@ -0,0 +1,142 @@
+package practice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"blinders/packages/auth"
+	"blinders/services/practice/repo"
+	"blinders/services/practice/srs"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ReviewFlashcardBody is the grade of a recall, Reversed is set for reviews of the back of reversed cards.
+// Duration is the time spent on the card in milliseconds
+type ReviewFlashcardBody struct {
+	Grade     *srs.Grade `json:"grade"`
+	Reversed  bool       `json:"reversed"`
+	SessionID string     `json:"sessionId"`
+	Duration  int64      `json:"duration"`
+}
+
+var errFlashcardNotReversed = errors.New("flashcard is not reversed")
+
+// HandleReviewFlashcard schedules the next review of the flashcard by the grade of the recall,
+// records the review in the review history and adds it to the activity log of today
+func (s Service) HandleReviewFlashcard(ctx *fiber.Ctx) error {
+	collection, ok := ctx.Locals(CollectionKey).(*repo.FlashcardCollection)
+	if !ok {
+		log.Fatalln("cannot get collection from context")
+	}
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+
+	flashcardID, err := primitive.ObjectIDFromHex(ctx.Params("flashcardId"))
+	if err != nil {
+		log.Println("flashcardID is invalid", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "flashcardID is invalid"})
+	}
+
+	body := new(ReviewFlashcardBody)
+	if err := json.Unmarshal(ctx.Body(), body); err != nil || body.Grade == nil {
+		log.Println("invalid request body", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	loc, err := timezoneOf(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid timezone"})
+	}
+
+	// the flashcard is read in the transaction, concurrent reviews of it conflict and are retried
+	// instead of scheduling from the same state
+	var next srs.State
+	err = s.Tx.WithTransaction(ctx.UserContext(), func(txCtx context.Context) error {
+		flashcard, err := s.FlashcardRepo.GetFlashcardByID(txCtx, collection.ID, flashcardID)
+		if err != nil {
+			return err
+		}
+		if body.Reversed && flashcard.Kind != repo.ReversedCardKind {
+			return errFlashcardNotReversed
+		}
+
+		current := srs.State{}
+		review := flashcard.Review
+		if body.Reversed {
+			review = flashcard.ReverseReview
+		}
+		if review != nil {
+			current = *review
+		}
+		if next, err = srs.Schedule(current, *body.Grade, time.Now()); err != nil {
+			return err
+		}
+
+		reviewLog := &repo.ReviewLog{
+			UserID:       userID,
+			CollectionID: collection.ID,
+			FlashcardID:  flashcardID,
+			Grade:        *body.Grade,
+			State:        next,
+			IsNew:        current.IsNew(),
+			Reversed:     body.Reversed,
+			SessionID:    body.SessionID,
+			Duration:     timeSpent(body.Duration),
+		}
+		counts := repo.ActivityLog{Reviews: 1, TimeSpent: reviewLog.Duration}
+		if reviewLog.Grade.IsCorrect() {
+			counts.Correct = 1
+		}
+		if reviewLog.IsNew {
+			counts.NewCards = 1
+		}
+
+		if err := s.FlashcardRepo.UpdateFlashcardReview(txCtx, collection.ID, flashcardID, next, body.Reversed); err != nil {
+			return err
+		}
+		if _, err := s.ReviewLogRepo.InsertRaw(txCtx, reviewLog); err != nil {
+			return err
+		}
+		return s.recordActivity(txCtx, userID, loc, counts)
+	})
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		log.Println("flashcard not found in collection", flashcardID.Hex())
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot get flashcard"})
+	case errors.Is(err, errFlashcardNotReversed), errors.Is(err, srs.ErrInvalidGrade):
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		log.Println("cannot review flashcard", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot review flashcard"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(next)
+}
+
+// HandleGetFlashcardReviews returns the review history of the flashcard, recent first
+func (s Service) HandleGetFlashcardReviews(ctx *fiber.Ctx) error {
+	collection, ok := ctx.Locals(CollectionKey).(*repo.FlashcardCollection)
+	if !ok {
+		log.Fatalln("cannot get collection from context")
+	}
+
+	flashcardID, err := primitive.ObjectIDFromHex(ctx.Params("flashcardId"))
+	if err != nil {
+		log.Println("flashcardID is invalid", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "flashcardID is invalid"})
+	}
+
+	reviews, err := s.ReviewLogRepo.GetByFlashcardID(ctx.UserContext(), collection.ID, flashcardID)
+	if err != nil {
+		log.Println("cannot get flashcard reviews", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot get flashcard reviews"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(reviews)
+}
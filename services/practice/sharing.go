@@ -0,0 +1,168 @@
+package practice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+
+	"blinders/packages/auth"
+	"blinders/services/practice/repo"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type UpdateVisibilityBody struct {
+	Visibility repo.CollectionVisibility `json:"visibility"`
+}
+
+func newShareToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HandleUpdateFlashcardCollectionVisibility shares the collection by link or publicly, or makes it private again.
+// The share token is generated when the collection is shared the first time
+func (s Service) HandleUpdateFlashcardCollectionVisibility(ctx *fiber.Ctx) error {
+	collection, ok := ctx.Locals(CollectionKey).(*repo.FlashcardCollection)
+	if !ok {
+		log.Fatalln("cannot get collection from context")
+	}
+
+	body := new(UpdateVisibilityBody)
+	if err := json.Unmarshal(ctx.Body(), body); err != nil || !body.Visibility.IsValid() {
+		log.Println("invalid request body", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "visibility must be private, link or public"})
+	}
+
+	var shareToken string
+	if body.Visibility != repo.PrivateVisibility && collection.ShareToken == "" {
+		var err error
+		if shareToken, err = newShareToken(); err != nil {
+			log.Println("cannot generate share token", err)
+			return ctx.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"error": "cannot update collection visibility"})
+		}
+	}
+
+	updated, err := s.FlashcardRepo.UpdateCollectionVisibility(ctx.UserContext(), collection.ID, body.Visibility, shareToken)
+	if err != nil {
+		log.Println("cannot update collection visibility", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot update collection visibility"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"visibility": updated.Visibility,
+		"shareToken": updated.ShareToken,
+	})
+}
+
+// sharedView hides the progress of the owner from other users
+func sharedView(collection *repo.FlashcardCollection) *repo.FlashcardCollection {
+	view := *collection
+	view.ViewedCount = 0
+	return &view
+}
+
+// HandleGetSharedFlashcardCollection returns a collection shared by link or publicly, it is read only.
+// Its flashcards are paged by HandleGetSharedFlashcards
+func (s Service) HandleGetSharedFlashcardCollection(ctx *fiber.Ctx) error {
+	collection, err := s.FlashcardRepo.GetSharedCollection(ctx.UserContext(), ctx.Params("token"))
+	if err != nil {
+		log.Println("cannot get shared collection", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot get flashcard collection"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(sharedView(collection))
+}
+
+// HandleGetSharedFlashcards pages flashcards of a shared collection like HandleGetFlashcardsOfCollection,
+// without the progress of the owner
+func (s Service) HandleGetSharedFlashcards(ctx *fiber.Ctx) error {
+	opts, err := flashcardPageOptions(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	collection, err := s.FlashcardRepo.GetSharedCollection(ctx.UserContext(), ctx.Params("token"))
+	if err != nil {
+		log.Println("cannot get shared collection", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot get flashcard collection"})
+	}
+
+	page, err := s.FlashcardRepo.GetFlashcardsOfCollection(ctx.UserContext(), collection.ID, ctx.Query("tag"), opts)
+	if err != nil {
+		log.Println("cannot get flashcards", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot get flashcards"})
+	}
+	for _, flashcard := range page.Items {
+		flashcard.ResetProgress()
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(page)
+}
+
+// HandleCloneFlashcardCollection copies the collection with its cards to the user, the cards get new IDs
+// and no progress. The response has the counts of the clone, not its cards. Collections of other users can be cloned if they are public, or with the `token`
+// query param if they are shared by link
+func (s Service) HandleCloneFlashcardCollection(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+	collectionID, err := primitive.ObjectIDFromHex(ctx.Params("id"))
+	if err != nil {
+		log.Println("cannot parse collection id:", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot parse collection id"})
+	}
+
+	source, err := s.FlashcardRepo.GetByID(ctx.UserContext(), collectionID)
+	if err != nil {
+		log.Println("cannot get flashcard collection:", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot get flashcard collection"})
+	}
+
+	canRead := source.UserID == userID ||
+		source.Visibility == repo.PublicVisibility ||
+		(source.IsShared() && ctx.Query("token") == source.ShareToken)
+	if !canRead {
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "user does not have permission to access this collection"})
+	}
+
+	clone := &repo.FlashcardCollection{
+		Type:        repo.ManualCollectionType,
+		Name:        source.Name,
+		Description: source.Description,
+		UserID:      userID,
+		ClonedFrom: &repo.CollectionSource{
+			CollectionID: source.ID,
+			UserID:       source.UserID,
+			Name:         source.Name,
+		},
+	}
+
+	err = s.Tx.WithTransaction(ctx.UserContext(), func(txCtx context.Context) error {
+		var err error
+		if clone, err = s.FlashcardRepo.InsertRaw(txCtx, clone); err != nil {
+			return err
+		}
+		_, err = s.FlashcardRepo.CopyFlashcards(txCtx, source.ID, clone)
+		return err
+	})
+	if err != nil {
+		log.Println("cannot insert cloned collection:", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "cannot clone flashcard collection"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(clone)
+}
@@ -0,0 +1,21 @@
+package srs
+
+// Interleave spreads the new cards evenly between the review cards keeping the order of both,
+// so a study session does not start (or end) with all new cards
+func Interleave[T any](reviews, news []T) []T {
+	merged := make([]T, 0, len(reviews)+len(news))
+	total := len(reviews) + len(news)
+	taken := 0
+
+	for i := 0; i < total; i++ {
+		// the i-th card is new if the share of new cards so far is behind the overall share
+		if taken < len(news) && (i-taken >= len(reviews) || (taken+1)*total <= (i+1)*len(news)) {
+			merged = append(merged, news[taken])
+			taken++
+		} else {
+			merged = append(merged, reviews[i-taken])
+		}
+	}
+
+	return merged
+}
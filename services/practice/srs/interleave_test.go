@@ -0,0 +1,41 @@
+package srs_test
+
+import (
+	"testing"
+
+	"blinders/services/practice/srs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterleave(t *testing.T) {
+	tests := []struct {
+		name     string
+		reviews  []string
+		news     []string
+		expected []string
+	}{
+		{"empty", nil, nil, []string{}},
+		{"only reviews", []string{"r1", "r2"}, nil, []string{"r1", "r2"}},
+		{"only news", nil, []string{"n1", "n2"}, []string{"n1", "n2"}},
+		{"even", []string{"r1", "r2"}, []string{"n1", "n2"}, []string{"r1", "n1", "r2", "n2"}},
+		{
+			"more reviews",
+			[]string{"r1", "r2", "r3", "r4"},
+			[]string{"n1", "n2"},
+			[]string{"r1", "r2", "n1", "r3", "r4", "n2"},
+		},
+		{
+			"more news",
+			[]string{"r1"},
+			[]string{"n1", "n2", "n3"},
+			[]string{"r1", "n1", "n2", "n3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, srs.Interleave(test.reviews, test.news))
+		})
+	}
+}
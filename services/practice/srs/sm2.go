@@ -0,0 +1,96 @@
+// Package srs schedules flashcard reviews with the SM-2 algorithm,
+// see https://super-memory.com/english/ol/sm2.htm
+package srs
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Grade is the quality of a recall, from 0 (complete blackout) to 5 (perfect response).
+// Grades lower than GradeHard mean the card is forgotten
+type Grade int
+
+const (
+	GradeAgain Grade = 0
+	GradeHard  Grade = 3
+	GradeGood  Grade = 4
+	GradeEasy  Grade = 5
+)
+
+const (
+	DefaultEase = 2.5
+	MinEase     = 1.3
+	Day         = time.Hour * 24
+)
+
+var ErrInvalidGrade = errors.New("grade must be between 0 and 5")
+
+func (g Grade) IsValid() bool {
+	return g >= 0 && g <= 5
+}
+
+// IsCorrect reports if the card is recalled, i.e. it is not forgotten
+func (g Grade) IsCorrect() bool {
+	return g >= GradeHard
+}
+
+// State is the scheduling state of a card, the zero state is a new card.
+// Interval is the number of days until the due date and Repetitions is the number of successful reviews in a row
+type State struct {
+	Ease        float64   `json:"ease"        bson:"ease"`
+	Interval    int       `json:"interval"    bson:"interval"`
+	Repetitions int       `json:"repetitions" bson:"repetitions"`
+	Lapses      int       `json:"lapses"      bson:"lapses"`
+	DueAt       time.Time `json:"dueAt"       bson:"dueAt"`
+	ReviewedAt  time.Time `json:"reviewedAt"  bson:"reviewedAt"`
+}
+
+// IsNew reports if the card has never been reviewed
+func (s State) IsNew() bool {
+	return s.ReviewedAt.IsZero()
+}
+
+// IsDue reports if the card should be reviewed at the time, new cards are always due
+func (s State) IsDue(at time.Time) bool {
+	return s.IsNew() || !s.DueAt.After(at)
+}
+
+// Schedule returns the state after reviewing the card with the grade at the time,
+// it is deterministic and does not change the given state
+func Schedule(state State, grade Grade, at time.Time) (State, error) {
+	if !grade.IsValid() {
+		return state, ErrInvalidGrade
+	}
+
+	next := state
+	if next.Ease == 0 {
+		next.Ease = DefaultEase
+	}
+
+	if grade.IsCorrect() {
+		switch next.Repetitions {
+		case 0:
+			next.Interval = 1
+		case 1:
+			next.Interval = 6
+		default:
+			next.Interval = int(math.Round(float64(next.Interval) * next.Ease))
+		}
+		next.Repetitions++
+	} else {
+		if next.Repetitions > 0 {
+			next.Lapses++
+		}
+		next.Repetitions = 0
+		next.Interval = 1
+	}
+
+	q := float64(5 - grade)
+	next.Ease = math.Max(MinEase, next.Ease+0.1-q*(0.08+q*0.02))
+	next.ReviewedAt = at
+	next.DueAt = at.Add(time.Duration(next.Interval) * Day)
+
+	return next, nil
+}
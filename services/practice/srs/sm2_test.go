@@ -0,0 +1,98 @@
+package srs_test
+
+import (
+	"testing"
+	"time"
+
+	"blinders/services/practice/srs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2024, time.May, 1, 8, 0, 0, 0, time.UTC)
+
+func TestScheduleNewCard(t *testing.T) {
+	tests := []struct {
+		name     string
+		grade    srs.Grade
+		interval int
+		ease     float64
+		reps     int
+	}{
+		{"again", srs.GradeAgain, 1, 1.7, 0},
+		{"hard", srs.GradeHard, 1, 2.36, 1},
+		{"good", srs.GradeGood, 1, 2.5, 1},
+		{"easy", srs.GradeEasy, 1, 2.6, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state, err := srs.Schedule(srs.State{}, test.grade, now)
+			assert.NoError(t, err)
+			assert.Equal(t, test.interval, state.Interval)
+			assert.InDelta(t, test.ease, state.Ease, 1e-9)
+			assert.Equal(t, test.reps, state.Repetitions)
+			assert.Equal(t, 0, state.Lapses)
+			assert.Equal(t, now, state.ReviewedAt)
+			assert.Equal(t, now.Add(srs.Day), state.DueAt)
+		})
+	}
+}
+
+func TestScheduleSequence(t *testing.T) {
+	state := srs.State{}
+	grades := []srs.Grade{srs.GradeGood, srs.GradeGood, srs.GradeGood, srs.GradeAgain, srs.GradeGood}
+	intervals := []int{1, 6, 15, 1, 1}
+	lapses := []int{0, 0, 0, 1, 1}
+
+	at := now
+	for i, grade := range grades {
+		var err error
+		state, err = srs.Schedule(state, grade, at)
+		assert.NoError(t, err)
+		assert.Equal(t, intervals[i], state.Interval, "review %d", i)
+		assert.Equal(t, lapses[i], state.Lapses, "review %d", i)
+		assert.Equal(t, at.Add(time.Duration(intervals[i])*srs.Day), state.DueAt)
+		at = state.DueAt
+	}
+}
+
+func TestScheduleMinEase(t *testing.T) {
+	state := srs.State{}
+	for i := 0; i < 10; i++ {
+		var err error
+		state, err = srs.Schedule(state, srs.GradeAgain, now)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, srs.MinEase, state.Ease)
+}
+
+func TestScheduleIsDeterministic(t *testing.T) {
+	state := srs.State{Ease: 2.2, Interval: 10, Repetitions: 3}
+
+	first, err := srs.Schedule(state, srs.GradeHard, now)
+	assert.NoError(t, err)
+	second, err := srs.Schedule(state, srs.GradeHard, now)
+	assert.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.Equal(t, 22, first.Interval)
+	// the given state is not changed
+	assert.Equal(t, 10, state.Interval)
+}
+
+func TestScheduleInvalidGrade(t *testing.T) {
+	for _, grade := range []srs.Grade{-1, 6} {
+		_, err := srs.Schedule(srs.State{}, grade, now)
+		assert.ErrorIs(t, err, srs.ErrInvalidGrade)
+	}
+}
+
+func TestIsDue(t *testing.T) {
+	assert.True(t, srs.State{}.IsDue(now))
+
+	state, err := srs.Schedule(srs.State{}, srs.GradeGood, now)
+	assert.NoError(t, err)
+	assert.False(t, state.IsDue(now))
+	assert.True(t, state.IsDue(now.Add(srs.Day)))
+}
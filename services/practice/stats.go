@@ -0,0 +1,180 @@
+package practice
+
+import (
+	"context"
+	"log"
+	"time"
+	// embeds the timezone database, runtimes without it could not load timezones of users
+	_ "time/tzdata"
+
+	"blinders/packages/auth"
+	"blinders/services/practice/activity"
+	"blinders/services/practice/repo"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TimezoneHeader is the IANA timezone of the user (e.g. Asia/Ho_Chi_Minh), activity is logged
+// and streaks are counted by days in it. Requests without it are in UTC
+const TimezoneHeader = "X-Timezone"
+
+const (
+	// MaxActivityDuration caps the time spent of one review or view, e.g. when the app is left open
+	MaxActivityDuration = time.Minute * 10
+	// MaxStreakDays is the longest streak counted
+	MaxStreakDays = 3650
+)
+
+func timezoneOf(ctx *fiber.Ctx) (*time.Location, error) {
+	name := ctx.Get(TimezoneHeader)
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// timeSpent clamps the duration in milliseconds sent by clients
+func timeSpent(ms int64) int64 {
+	return min(max(ms, 0), MaxActivityDuration.Milliseconds())
+}
+
+// recordActivity adds the counts to the activity log of the user of today in the timezone
+func (s Service) recordActivity(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	loc *time.Location,
+	counts repo.ActivityLog,
+) error {
+	return s.ActivityLogRepo.AddActivity(ctx, userID, activity.Day(time.Now(), loc), counts)
+}
+
+// DailyStats is the activity of a day, or of the whole range for totals. CorrectRate is 0 without reviews
+type DailyStats struct {
+	Day         string  `json:"day,omitempty"`
+	Reviews     int64   `json:"reviews"`
+	Correct     int64   `json:"correct"`
+	CorrectRate float64 `json:"correctRate"`
+	NewCards    int64   `json:"newCards"`
+	Views       int64   `json:"views"`
+	TimeSpent   int64   `json:"timeSpent"`
+}
+
+// CollectionStats is the retention of a collection in the range,
+// the share of correct reviews of learned cards (first reviews of new cards are not counted)
+type CollectionStats struct {
+	CollectionID primitive.ObjectID `json:"collectionId"`
+	Name         string             `json:"name"`
+	Reviews      int64              `json:"reviews"`
+	Correct      int64              `json:"correct"`
+	Retention    float64            `json:"retention"`
+}
+
+type PracticeStats struct {
+	Days          int               `json:"days"`
+	Timezone      string            `json:"timezone"`
+	Streak        int               `json:"streak"`
+	LongestStreak int               `json:"longestStreak"`
+	Totals        DailyStats        `json:"totals"`
+	Series        []DailyStats      `json:"series"`
+	Collections   []CollectionStats `json:"collections"`
+}
+
+func rate(correct, reviews int64) float64 {
+	if reviews == 0 {
+		return 0
+	}
+	return float64(correct) / float64(reviews)
+}
+
+// HandleGetStats returns the daily activity of the `range` query param (e.g. 30d) ending today,
+// the current streak and the retention of each collection of the user
+func (s Service) HandleGetStats(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+
+	loc, err := timezoneOf(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid timezone"})
+	}
+	days, err := activity.ParseRange(ctx.Query("range"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rangeDays := activity.LastDays(time.Now(), loc, days)
+	from, today := rangeDays[0], rangeDays[len(rangeDays)-1]
+
+	logs, err := s.ActivityLogRepo.GetByUserIDBetween(ctx.UserContext(), userID, from, today)
+	if err != nil {
+		log.Println("cannot get activity logs", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot get stats"})
+	}
+	activeDays, err := s.ActivityLogRepo.GetActiveDays(ctx.UserContext(), userID, today, MaxStreakDays)
+	if err != nil {
+		log.Println("cannot get active days", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot get stats"})
+	}
+
+	start, _ := time.ParseInLocation(activity.DayLayout, from, loc)
+	reviews, err := s.ReviewLogRepo.CountByCollectionSince(ctx.UserContext(), userID, start)
+	if err != nil {
+		log.Println("cannot count reviews of collections", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot get stats"})
+	}
+	collections, err := s.FlashcardRepo.GetCollectionCountsByUserID(ctx.UserContext(), userID)
+	if err != nil {
+		log.Println("cannot get collections", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot get stats"})
+	}
+
+	stats := PracticeStats{
+		Days:        days,
+		Timezone:    loc.String(),
+		Streak:      activity.Streak(activeDays, today),
+		Series:      make([]DailyStats, len(rangeDays)),
+		Collections: make([]CollectionStats, len(collections)),
+	}
+
+	logOfDay := make(map[string]*repo.ActivityLog, len(logs))
+	for _, activityLog := range logs {
+		logOfDay[activityLog.Day] = activityLog
+	}
+	active := make([]bool, len(rangeDays))
+	for idx, day := range rangeDays {
+		daily := DailyStats{Day: day}
+		if activityLog, ok := logOfDay[day]; ok {
+			daily.Reviews = activityLog.Reviews
+			daily.Correct = activityLog.Correct
+			daily.CorrectRate = rate(activityLog.Correct, activityLog.Reviews)
+			daily.NewCards = activityLog.NewCards
+			daily.Views = activityLog.Views
+			daily.TimeSpent = activityLog.TimeSpent
+			active[idx] = true
+		}
+		stats.Series[idx] = daily
+
+		stats.Totals.Reviews += daily.Reviews
+		stats.Totals.Correct += daily.Correct
+		stats.Totals.NewCards += daily.NewCards
+		stats.Totals.Views += daily.Views
+		stats.Totals.TimeSpent += daily.TimeSpent
+	}
+	stats.Totals.CorrectRate = rate(stats.Totals.Correct, stats.Totals.Reviews)
+	stats.LongestStreak = activity.LongestStreak(active)
+
+	reviewsOfCollection := make(map[primitive.ObjectID]*repo.CollectionReviews, len(reviews))
+	for _, count := range reviews {
+		reviewsOfCollection[count.CollectionID] = count
+	}
+	for idx, collection := range collections {
+		collectionStats := CollectionStats{CollectionID: collection.ID, Name: collection.Name}
+		if count, ok := reviewsOfCollection[collection.ID]; ok {
+			collectionStats.Reviews = count.Reviews
+			collectionStats.Correct = count.Correct
+			collectionStats.Retention = rate(count.Correct, count.Reviews)
+		}
+		stats.Collections[idx] = collectionStats
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(stats)
+}
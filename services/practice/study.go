@@ -0,0 +1,102 @@
+package practice
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"blinders/packages/auth"
+	"blinders/services/practice/activity"
+	"blinders/services/practice/repo"
+	"blinders/services/practice/srs"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultStudyLimit = 20
+	MaxStudyLimit     = 100
+)
+
+// StudyConfig limits how many cards are studied per day, days start at midnight in the timezone of the user
+type StudyConfig struct {
+	NewPerDay     int64
+	ReviewsPerDay int64
+}
+
+var DefaultStudyConfig = StudyConfig{
+	NewPerDay:     20,
+	ReviewsPerDay: 200,
+}
+
+// StudySession is the next cards to study, reviews of the cards should be sent with the session ID.
+// NewRemaining and ReviewRemaining are the remaining limits of today, including cards of the session
+type StudySession struct {
+	SessionID       string                 `json:"sessionId"`
+	Cards           []*repo.StudyFlashcard `json:"cards"`
+	NewRemaining    int64                  `json:"newRemaining"`
+	ReviewRemaining int64                  `json:"reviewRemaining"`
+}
+
+// HandleGetNextStudyCards returns due and new cards of all collections of the user, interleaved.
+// Query params `newPerDay` and `reviewsPerDay` override the daily limits of the service,
+// the limits reset at midnight in the timezone of the TimezoneHeader (UTC by default)
+func (s Service) HandleGetNextStudyCards(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+
+	loc, err := timezoneOf(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid timezone"})
+	}
+
+	limit, err := strconv.Atoi(ctx.Query("limit", strconv.Itoa(DefaultStudyLimit)))
+	if err != nil || limit <= 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid limit"})
+	}
+	limit = min(limit, MaxStudyLimit)
+
+	config := s.Study
+	for param, value := range map[string]*int64{
+		"newPerDay":     &config.NewPerDay,
+		"reviewsPerDay": &config.ReviewsPerDay,
+	} {
+		if raw := ctx.Query(param); raw != "" {
+			parsed, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || parsed < 0 {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid " + param})
+			}
+			*value = parsed
+		}
+	}
+
+	now := time.Now()
+	reviewed, learned, err := s.ReviewLogRepo.CountSince(ctx.UserContext(), userID, activity.StartOfDay(now, loc))
+	if err != nil {
+		log.Println("cannot count reviews of today", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot get study cards"})
+	}
+	reviewRemaining := max(config.ReviewsPerDay-reviewed, 0)
+	newRemaining := max(config.NewPerDay-learned, 0)
+
+	due, err := s.FlashcardRepo.GetDueFlashcards(ctx.UserContext(), userID, now, min(reviewRemaining, int64(limit)))
+	if err != nil {
+		log.Println("cannot get due flashcards", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot get study cards"})
+	}
+
+	// due cards come first, new cards fill the rest of the session
+	newLimit := min(newRemaining, int64(limit-len(due)))
+	news, err := s.FlashcardRepo.GetNewFlashcards(ctx.UserContext(), userID, newLimit)
+	if err != nil {
+		log.Println("cannot get new flashcards", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot get study cards"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(StudySession{
+		SessionID:       primitive.NewObjectID().Hex(),
+		Cards:           srs.Interleave(due, news),
+		NewRemaining:    newRemaining,
+		ReviewRemaining: reviewRemaining,
+	})
+}
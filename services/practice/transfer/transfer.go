@@ -0,0 +1,257 @@
+// Package transfer parses and writes flashcards in CSV, Anki-compatible TSV and JSON
+package transfer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Format string
+
+const (
+	CSV  Format = "csv"
+	TSV  Format = "tsv"
+	JSON Format = "json"
+)
+
+// MaxRows limits the number of cards of one import
+const MaxRows = 5000
+
+var (
+	ErrUnknownFormat = errors.New("format must be csv, tsv or json")
+	ErrTooManyRows   = fmt.Errorf("import has more than %d rows", MaxRows)
+)
+
+// ParseFormat parses a format name or a content type, empty is CSV
+func ParseFormat(s string) (Format, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case s == "", s == "csv", strings.HasPrefix(s, "text/csv"):
+		return CSV, nil
+	case s == "tsv", s == "txt", strings.HasPrefix(s, "text/tab-separated-values"), strings.HasPrefix(s, "text/plain"):
+		return TSV, nil
+	case s == "json", strings.HasPrefix(s, "application/json"):
+		return JSON, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case TSV:
+		return "text/tab-separated-values; charset=utf-8"
+	case JSON:
+		return "application/json"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Card is a row of an import or export, tags are separated by spaces in CSV and TSV like Anki does.
+// CSV and TSV only have the front, back and tags columns (the Anki plain text layout), the other fields
+// of flashcards are only kept by JSON
+type Card struct {
+	FrontText    string   `json:"frontText"`
+	BackText     string   `json:"backText"`
+	Tags         []string `json:"tags,omitempty"`
+	Kind         string   `json:"kind,omitempty"`
+	Examples     []string `json:"examples,omitempty"`
+	IPA          string   `json:"ipa,omitempty"`
+	PartOfSpeech string   `json:"partOfSpeech,omitempty"`
+}
+
+// RowError is a validation error of a row, rows are lines of CSV and TSV and 1-based indexes of JSON arrays
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// Check validates a parsed card further, e.g. as a flashcard of the practice service
+type Check func(card Card) error
+
+// Parse reads the cards of the import, invalid rows (by the checks too) are skipped and reported by row errors.
+// The error is only set if the import can not be read at all
+func Parse(r io.Reader, format Format, checks ...Check) ([]Card, []RowError, error) {
+	switch format {
+	case CSV, TSV:
+		return parseDelimited(r, format, checks)
+	case JSON:
+		return parseJSON(r, checks)
+	}
+	return nil, nil, ErrUnknownFormat
+}
+
+func parseDelimited(r io.Reader, format Format, checks []Check) ([]Card, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if format == TSV {
+		reader.Comma = '\t'
+		// anki headers, e.g. #separator:tab
+		reader.Comment = '#'
+	}
+
+	cards := make([]Card, 0)
+	rowErrors := make([]RowError, 0)
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rowErrors = append(rowErrors, RowError{Row: parseErr.Line, Error: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if first && isHeader(record) {
+			continue
+		}
+		if len(cards)+len(rowErrors) >= MaxRows {
+			return nil, nil, ErrTooManyRows
+		}
+		if len(record) < 2 {
+			rowErrors = append(rowErrors, RowError{Row: line, Error: "row must have front and back columns"})
+			continue
+		}
+
+		card := Card{FrontText: record[0], BackText: record[1]}
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			card.Tags = strings.Fields(record[2])
+		}
+		if err := validate(card, checks); err != nil {
+			rowErrors = append(rowErrors, RowError{Row: line, Error: err.Error()})
+			continue
+		}
+		cards = append(cards, normalize(card))
+	}
+
+	return cards, rowErrors, nil
+}
+
+func isHeader(record []string) bool {
+	return len(record) >= 2 &&
+		strings.EqualFold(strings.TrimSpace(record[0]), "front") &&
+		strings.EqualFold(strings.TrimSpace(record[1]), "back")
+}
+
+func parseJSON(r io.Reader, checks []Check) ([]Card, []RowError, error) {
+	var rows []Card
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, nil, fmt.Errorf("invalid json: %v", err)
+	}
+	if len(rows) > MaxRows {
+		return nil, nil, ErrTooManyRows
+	}
+
+	cards := make([]Card, 0, len(rows))
+	rowErrors := make([]RowError, 0)
+	for idx, card := range rows {
+		if err := validate(card, checks); err != nil {
+			rowErrors = append(rowErrors, RowError{Row: idx + 1, Error: err.Error()})
+			continue
+		}
+		cards = append(cards, normalize(card))
+	}
+
+	return cards, rowErrors, nil
+}
+
+func validate(card Card, checks []Check) error {
+	switch {
+	case strings.TrimSpace(card.FrontText) == "":
+		return errors.New("front is empty")
+	case strings.TrimSpace(card.BackText) == "":
+		return errors.New("back is empty")
+	}
+	for _, check := range checks {
+		if err := check(normalize(card)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func normalize(card Card) Card {
+	card.FrontText = strings.TrimSpace(card.FrontText)
+	card.BackText = strings.TrimSpace(card.BackText)
+	return card
+}
+
+// Writer writes cards one by one, so large collections are streamed. Close must be called after the last card
+type Writer interface {
+	Write(card Card) error
+	Close() error
+}
+
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	switch format {
+	case CSV:
+		return &delimitedWriter{csv: csv.NewWriter(w)}, nil
+	case TSV:
+		writer := csv.NewWriter(w)
+		writer.Comma = '\t'
+		// headers of the anki plain text import
+		_, err := io.WriteString(w, "#separator:tab\n#html:false\n#tags column:3\n")
+		return &delimitedWriter{csv: writer}, err
+	case JSON:
+		return &jsonWriter{w: bufio.NewWriter(w)}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+type delimitedWriter struct {
+	csv *csv.Writer
+}
+
+func (w *delimitedWriter) Write(card Card) error {
+	return w.csv.Write([]string{card.FrontText, card.BackText, strings.Join(card.Tags, " ")})
+}
+
+func (w *delimitedWriter) Close() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+type jsonWriter struct {
+	w       *bufio.Writer
+	written int
+}
+
+func (w *jsonWriter) Write(card Card) error {
+	sep := ","
+	if w.written == 0 {
+		sep = "["
+	}
+	b, err := json.Marshal(card)
+	if err != nil {
+		return err
+	}
+	w.written++
+
+	if _, err := w.w.WriteString(sep); err != nil {
+		return err
+	}
+	_, err = w.w.Write(b)
+	return err
+}
+
+func (w *jsonWriter) Close() error {
+	end := "]"
+	if w.written == 0 {
+		end = "[]"
+	}
+	if _, err := w.w.WriteString(end + "\n"); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
@@ -0,0 +1,147 @@
+package transfer_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"blinders/services/practice/transfer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSV(t *testing.T) {
+	input := "front,back,tags\n" +
+		"hello,xin chào,greeting basic\n" +
+		"\"a, b\",\"c\nd\"\n" +
+		",missing front\n" +
+		"only front\n"
+
+	cards, rowErrors, err := transfer.Parse(strings.NewReader(input), transfer.CSV)
+	assert.NoError(t, err)
+	assert.Equal(t, []transfer.Card{
+		{FrontText: "hello", BackText: "xin chào", Tags: []string{"greeting", "basic"}},
+		{FrontText: "a, b", BackText: "c\nd"},
+	}, cards)
+	assert.Equal(t, []transfer.RowError{
+		{Row: 5, Error: "front is empty"},
+		{Row: 6, Error: "row must have front and back columns"},
+	}, rowErrors)
+}
+
+func TestParseAnkiTSV(t *testing.T) {
+	input := "#separator:tab\n#html:false\n" +
+		"apple\tquả táo\tfruit\n" +
+		"book\t\n"
+
+	cards, rowErrors, err := transfer.Parse(strings.NewReader(input), transfer.TSV)
+	assert.NoError(t, err)
+	assert.Equal(t, []transfer.Card{{FrontText: "apple", BackText: "quả táo", Tags: []string{"fruit"}}}, cards)
+	assert.Equal(t, []transfer.RowError{{Row: 4, Error: "back is empty"}}, rowErrors)
+}
+
+func TestParseJSON(t *testing.T) {
+	input := `[{"frontText": "hi", "backText": "chào"}, {"frontText": "bye"}]`
+
+	cards, rowErrors, err := transfer.Parse(strings.NewReader(input), transfer.JSON)
+	assert.NoError(t, err)
+	assert.Equal(t, []transfer.Card{{FrontText: "hi", BackText: "chào"}}, cards)
+	assert.Equal(t, []transfer.RowError{{Row: 2, Error: "back is empty"}}, rowErrors)
+
+	_, _, err = transfer.Parse(strings.NewReader(`{"frontText": "hi"}`), transfer.JSON)
+	assert.Error(t, err)
+}
+
+func TestParseWithChecks(t *testing.T) {
+	input := "front,back\nhello,xin chào\n  cloze  ,back\n"
+	noCloze := func(card transfer.Card) error {
+		if card.FrontText == "cloze" {
+			return errors.New("no cloze deletion")
+		}
+		return nil
+	}
+
+	cards, rowErrors, err := transfer.Parse(strings.NewReader(input), transfer.CSV, noCloze)
+	assert.NoError(t, err)
+	assert.Equal(t, []transfer.Card{{FrontText: "hello", BackText: "xin chào"}}, cards)
+	assert.Equal(t, []transfer.RowError{{Row: 3, Error: "no cloze deletion"}}, rowErrors)
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]transfer.Format{
+		"":                          transfer.CSV,
+		"CSV":                       transfer.CSV,
+		"text/csv; charset=utf-8":   transfer.CSV,
+		"tsv":                       transfer.TSV,
+		"text/tab-separated-values": transfer.TSV,
+		"application/json":          transfer.JSON,
+	}
+	for input, expected := range tests {
+		format, err := transfer.ParseFormat(input)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, format, input)
+	}
+
+	_, err := transfer.ParseFormat("xlsx")
+	assert.ErrorIs(t, err, transfer.ErrUnknownFormat)
+}
+
+func TestWriteAndParseBack(t *testing.T) {
+	cards := []transfer.Card{
+		{FrontText: "hello", BackText: "xin chào", Tags: []string{"greeting"}},
+		{FrontText: "tab\tand \"quote\"", BackText: "multi\nline"},
+	}
+
+	for _, format := range []transfer.Format{transfer.CSV, transfer.TSV, transfer.JSON} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := transfer.NewWriter(&buf, format)
+			assert.NoError(t, err)
+			for _, card := range cards {
+				assert.NoError(t, writer.Write(card))
+			}
+			assert.NoError(t, writer.Close())
+
+			parsed, rowErrors, err := transfer.Parse(&buf, format)
+			assert.NoError(t, err)
+			assert.Empty(t, rowErrors)
+			assert.Equal(t, cards, parsed)
+		})
+	}
+}
+
+func TestWriteEmptyJSON(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := transfer.NewWriter(&buf, transfer.JSON)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	cards := []transfer.Card{
+		{FrontText: "hi", BackText: "chào", Tags: []string{"greeting"}, Kind: "reversed"},
+		{
+			FrontText:    "I {{c1::went}} home",
+			BackText:     "tôi đã về nhà",
+			Kind:         "cloze",
+			Examples:     []string{"She went home early"},
+			IPA:          "wɛnt",
+			PartOfSpeech: "verb",
+		},
+	}
+
+	var b bytes.Buffer
+	writer, err := transfer.NewWriter(&b, transfer.JSON)
+	assert.NoError(t, err)
+	for _, card := range cards {
+		assert.NoError(t, writer.Write(card))
+	}
+	assert.NoError(t, writer.Close())
+
+	parsed, rowErrors, err := transfer.Parse(&b, transfer.JSON)
+	assert.NoError(t, err)
+	assert.Empty(t, rowErrors)
+	assert.Equal(t, cards, parsed)
+}
@@ -0,0 +1,81 @@
+package practice
+
+import (
+	"context"
+
+	"blinders/services/practice/repo"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CleanUserData deletes all flashcard collections, flashcards, snapshots, review logs and activity logs of the user.
+// With dry run, it only counts affected documents
+func (s Service) CleanUserData(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	dryRun bool,
+) (map[string]int64, error) {
+	report := make(map[string]int64)
+
+	if dryRun {
+		collections, err := s.FlashcardRepo.CountByUserID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		flashcards, err := s.FlashcardRepo.CountFlashcardsByUserID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		snapshots, err := s.SnapshotRepo.CountByUserID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		reviews, err := s.ReviewLogRepo.CountByUserID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		report[repo.FlashcardsColName] = collections
+		report[repo.CardsColName] = flashcards
+		report[repo.SnapshotColName] = snapshots
+		activities, err := s.ActivityLogRepo.CountByUserID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		report[repo.ReviewLogsColName] = reviews
+		report[repo.ActivityLogsColName] = activities
+
+		return report, nil
+	}
+
+	collections, err := s.FlashcardRepo.DeleteByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	report[repo.FlashcardsColName] = collections
+
+	flashcards, err := s.FlashcardRepo.DeleteFlashcardsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	report[repo.CardsColName] = flashcards
+
+	snapshots, err := s.SnapshotRepo.DeleteByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	report[repo.SnapshotColName] = snapshots
+
+	reviews, err := s.ReviewLogRepo.DeleteByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	report[repo.ReviewLogsColName] = reviews
+
+	activities, err := s.ActivityLogRepo.DeleteByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	report[repo.ActivityLogsColName] = activities
+
+	return report, nil
+}
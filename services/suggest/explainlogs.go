@@ -0,0 +1,85 @@
+package suggest
+
+import (
+	"context"
+	"time"
+
+	"blinders/packages/dbutils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExplainLogsColName is also read by the practice service to make flashcards of explanations
+const ExplainLogsColName = "explain-logs"
+
+// ExplainLog is an explanation requested by a user, Duration is the time of the model call in milliseconds
+type ExplainLog struct {
+	dbutils.RawModel `json:",inline" bson:",inline"`
+	UserID           primitive.ObjectID              `json:"userId"   bson:"userId"`
+	Phrase           string                          `json:"phrase"   bson:"phrase"`
+	Sentence         string                          `json:"sentence" bson:"sentence"`
+	Response         ExplainPhraseInSentenceResponse `json:"response" bson:"response"`
+	Duration         int64                           `json:"duration" bson:"duration"`
+	Model            string                          `json:"model"    bson:"model"`
+}
+
+type ExplainLogsRepo struct {
+	dbutils.SingleCollectionRepo[*ExplainLog]
+}
+
+var ExplainLogsIndexes = []dbutils.IndexSpec{
+	{
+		// history of a user, paged by ID
+		Collection: ExplainLogsColName,
+		Name:       "userId_1__id_-1",
+		Keys:       bson.D{{Key: "userId", Value: 1}, {Key: "_id", Value: -1}},
+	},
+}
+
+func NewExplainLogsRepo(db *mongo.Database) *ExplainLogsRepo {
+	col := db.Collection(ExplainLogsColName)
+	return &ExplainLogsRepo{
+		SingleCollectionRepo: dbutils.SingleCollectionRepo[*ExplainLog]{
+			Collection: col,
+			Timeout:    time.Second * 5,
+		},
+	}
+}
+
+// GetByUserID pages explain logs of the user, recent first
+func (r *ExplainLogsRepo) GetByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	cursor primitive.ObjectID,
+	limit int64,
+) (dbutils.Page[*ExplainLog], error) {
+	return r.List(ctx, bson.M{"userId": userID}, dbutils.ListOptions{
+		Cursor:     cursor,
+		Limit:      limit,
+		Descending: true,
+	})
+}
+
+func (r *ExplainLogsRepo) CountByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	return r.Count(ctx, bson.M{"userId": userID})
+}
+
+func (r *ExplainLogsRepo) DeleteByUserID(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	result, err := r.DeleteMany(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,78 @@
+package suggest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blinders/packages/dbutils"
+	"blinders/services/suggest"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	mongoTestURL    = "mongodb://localhost:27017"
+	mongoTestDBName = "blinders-test"
+	client          *mongo.Client
+)
+
+func TestGetExplainLogsByUserID(t *testing.T) {
+	r := GetExplainLogTestRepo(t)
+	defer CleanExplainLogRepo(t, r)
+
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	for _, phrase := range []string{"first", "second", "third"} {
+		_, err := r.InsertRaw(ctx, &suggest.ExplainLog{UserID: userID, Phrase: phrase, Sentence: phrase})
+		assert.NoError(t, err)
+	}
+	_, err := r.InsertRaw(ctx, &suggest.ExplainLog{UserID: primitive.NewObjectID(), Phrase: "other"})
+	assert.NoError(t, err)
+
+	page, err := r.GetByUserID(ctx, userID, primitive.NilObjectID, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(page.Items))
+	assert.Equal(t, "third", page.Items[0].Phrase)
+	assert.Equal(t, "second", page.Items[1].Phrase)
+
+	page, err = r.GetByUserID(ctx, userID, page.Items[1].ID, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(page.Items))
+	assert.Equal(t, "first", page.Items[0].Phrase)
+
+	count, err := r.DeleteByUserID(ctx, userID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	count, err = r.CountByUserID(ctx, userID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func GetExplainLogTestRepo(t *testing.T) *suggest.ExplainLogsRepo {
+	t.Helper()
+	if client == nil {
+		var err error
+		client, err = dbutils.InitMongoClient(mongoTestURL)
+		assert.NoError(t, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err := client.Ping(ctx, nil)
+	assert.NoError(t, err)
+
+	return suggest.NewExplainLogsRepo(client.Database(mongoTestDBName))
+}
+
+func CleanExplainLogRepo(t *testing.T, repo *suggest.ExplainLogsRepo) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err := repo.Collection.Drop(ctx)
+	assert.NoError(t, err)
+}
@@ -2,48 +2,67 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"os"
 
-	"blinders/packages/apigateway"
+	"blinders/packages/auth"
+	"blinders/packages/dbutils"
+	"blinders/packages/service"
 	"blinders/services/suggest"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	fiberadapter "github.com/awslabs/aws-lambda-go-api-proxy/fiber"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var brrc *bedrockruntime.Client
+var fiberLambda *fiberadapter.FiberLambda
 
 func init() {
 	env := os.Getenv("ENVIRONMENT")
 	log.Println("Peakee Suggest API is running on environment:", env)
 
-	brrc = suggest.InitBedrockRuntimeClientSync(context.Background())
+	authManager, mongoDB := optionalSetup(env)
+	brrc := suggest.InitBedrockRuntimeClientSync(context.Background())
+	suggestService := suggest.NewService(authManager, mongoDB, brrc)
+
+	app := fiber.New()
+	suggestService.InitFiberRoutes(app.Group("/suggest/v2"))
+
+	fiberLambda = service.NewFiberLambdaAdapter(app)
 }
 
-func HandleRequest(
-	_ context.Context,
-	req events.APIGatewayV2HTTPRequest,
-) (events.APIGatewayV2HTTPResponse, error) {
-	phrase, ok := req.QueryStringParameters["phrase"]
-	if !ok {
-		return apigateway.BadRequestResponse("required phrase param"), nil
+// optionalSetup is service.LambdaCommonSetup, it only fails softly in the local environment or when
+// SUGGEST_ANONYMOUS_ONLY is "true", then the anonymous explain is served without explain logs
+func optionalSetup(env string) (*auth.Manager, *mongo.Database) {
+	anonymousOnly := env == "local" || os.Getenv("SUGGEST_ANONYMOUS_ONLY") == "true"
+	fail := log.Fatalln
+	if anonymousOnly {
+		fail = log.Println
 	}
-	sentence, ok := req.QueryStringParameters["sentence"]
-	if !ok {
-		return apigateway.BadRequestResponse("required sentence param"), nil
+
+	mongoDB, err := dbutils.InitMongoDatabaseFromEnv()
+	if err != nil {
+		fail("failed to init database, explain logs are disabled:", err)
+		return nil, nil
 	}
 
-	explanation, err := suggest.ExplainPhraseInSentence(brrc, phrase, sentence)
+	authManager, err := auth.NewManagerFromEnv("firebase.admin.json", service.NewUserResolver(mongoDB))
 	if err != nil {
-		log.Println("error when explaining: ", err)
-		message := fmt.Sprintf("cannot explain \"%s\"", phrase)
-		return apigateway.BadRequestResponse(message), nil
+		fail("failed to init auth manager, explain logs are disabled:", err)
+		return nil, nil
 	}
+	authManager.Cache = service.NewTokenCacheFromEnv()
+
+	return authManager, mongoDB
+}
 
-	return apigateway.OkJSONResponse(explanation), nil
+func HandleRequest(
+	ctx context.Context,
+	req events.APIGatewayV2HTTPRequest,
+) (events.APIGatewayV2HTTPResponse, error) {
+	return fiberLambda.ProxyWithContextV2(ctx, req)
 }
 
 func main() {
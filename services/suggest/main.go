@@ -28,6 +28,9 @@ type LlamaResponse struct {
 	StopReason           string `json:"stop_reason"` // "stop" || "length"
 }
 
+// ExplainModelID is the bedrock model explaining phrases, it is recorded in explain logs
+const ExplainModelID = "meta.llama3-70b-instruct-v1:0"
+
 func ExplainPhraseInSentence(
 	brrc *bedrockruntime.Client,
 	phrase string,
@@ -42,7 +45,7 @@ func ExplainPhraseInSentence(
 	reqBytes, _ := json.Marshal(&req)
 
 	result, err := brrc.InvokeModel(context.TODO(), &bedrockruntime.InvokeModelInput{
-		ModelId:     aws.String("meta.llama3-70b-instruct-v1:0"),
+		ModelId:     aws.String(ExplainModelID),
 		ContentType: aws.String("application/json"),
 		Body:        reqBytes,
 	})
@@ -0,0 +1,170 @@
+package suggest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"blinders/packages/auth"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+type Service struct {
+	Auth           *auth.Manager
+	Bedrock        *bedrockruntime.Client
+	ExplainLogRepo *ExplainLogsRepo
+}
+
+// NewService makes the suggest service, without a database (nil db) only the anonymous explain is served
+func NewService(auth *auth.Manager, db *mongo.Database, brrc *bedrockruntime.Client) *Service {
+	s := &Service{
+		Auth:    auth,
+		Bedrock: brrc,
+	}
+	if db != nil {
+		s.ExplainLogRepo = NewExplainLogsRepo(db)
+	}
+	return s
+}
+
+func (s *Service) InitFiberRoutes(r fiber.Router) {
+	r.Get("/", s.HandleExplain)
+
+	if s.Auth == nil || s.ExplainLogRepo == nil {
+		log.Println("suggest service has no database or auth, explain logs are not served")
+		return
+	}
+	explainLogs := r.Group("/explain-logs", s.Auth.FiberAuthMiddleware(auth.Config{WithUser: true}))
+	explainLogs.Get("/", s.HandleGetExplainLogs)
+	explainLogs.Post("/", s.HandleExplainAndLog)
+}
+
+type ExplainBody struct {
+	Phrase   string `json:"phrase"`
+	Sentence string `json:"sentence"`
+}
+
+// HandleExplain explains the phrase in the sentence without recording it, it does not require authentication
+func (s Service) HandleExplain(ctx *fiber.Ctx) error {
+	phrase, sentence := ctx.Query("phrase"), ctx.Query("sentence")
+	if phrase == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "required phrase param"})
+	}
+	if sentence == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "required sentence param"})
+	}
+
+	explanation, err := ExplainPhraseInSentence(s.Bedrock, phrase, sentence)
+	if err != nil {
+		log.Println("error when explaining: ", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": fmt.Sprintf("cannot explain \"%s\"", phrase)})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(explanation)
+}
+
+// HandleExplainAndLog explains the phrase in the sentence and stores the explanation in the history of the user
+func (s Service) HandleExplainAndLog(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+
+	body := new(ExplainBody)
+	if err := ctx.BodyParser(body); err != nil {
+		log.Println("invalid request body", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	if body.Phrase == "" || body.Sentence == "" {
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "invalid request body, require phrase and sentence"})
+	}
+
+	start := time.Now()
+	explanation, err := ExplainPhraseInSentence(s.Bedrock, body.Phrase, body.Sentence)
+	if err != nil {
+		log.Println("error when explaining: ", err)
+		return ctx.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": fmt.Sprintf("cannot explain \"%s\"", body.Phrase)})
+	}
+
+	explainLog, err := s.ExplainLogRepo.InsertRaw(ctx.UserContext(), &ExplainLog{
+		UserID:   userID,
+		Phrase:   body.Phrase,
+		Sentence: body.Sentence,
+		Response: *explanation,
+		Duration: time.Since(start).Milliseconds(),
+		Model:    ExplainModelID,
+	})
+	if err != nil {
+		// the explanation is still useful to the user, only the history misses it,
+		// the log is returned without id as it is not stored
+		log.Println("cannot insert explain log", err)
+		explainLog.SetID(primitive.NilObjectID)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(explainLog)
+}
+
+// HandleGetExplainLogs pages the explanation history of the user with `cursor` and `limit` query params
+func (s Service) HandleGetExplainLogs(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+
+	var cursor primitive.ObjectID
+	if c := ctx.Query("cursor"); c != "" {
+		oid, err := primitive.ObjectIDFromHex(c)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cursor"})
+		}
+		cursor = oid
+	}
+
+	limit, err := strconv.Atoi(ctx.Query("limit", strconv.Itoa(DefaultPageLimit)))
+	if err != nil || limit <= 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid limit"})
+	}
+	limit = min(limit, MaxPageLimit)
+
+	page, err := s.ExplainLogRepo.GetByUserID(ctx.UserContext(), userID, cursor, int64(limit))
+	if err != nil {
+		log.Println("cannot get explain logs", err)
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot get explain logs"})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(page)
+}
+
+// CleanUserData deletes the explanation history of the user. With dry run, it only counts affected documents
+func (s Service) CleanUserData(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	dryRun bool,
+) (map[string]int64, error) {
+	if s.ExplainLogRepo == nil {
+		return map[string]int64{}, nil
+	}
+
+	var (
+		count int64
+		err   error
+	)
+	if dryRun {
+		count, err = s.ExplainLogRepo.CountByUserID(ctx, userID)
+	} else {
+		count, err = s.ExplainLogRepo.DeleteByUserID(ctx, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]int64{ExplainLogsColName: count}, nil
+}
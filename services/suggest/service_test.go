@@ -0,0 +1,74 @@
+package suggest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"blinders/packages/auth"
+	"blinders/services/suggest"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestExplainWithoutDatabase(t *testing.T) {
+	s := suggest.NewService(nil, nil, nil)
+	app := fiber.New()
+	s.InitFiberRoutes(app.Group("/suggest/v2"))
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/suggest/v2?sentence=hello", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, res.StatusCode)
+
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/suggest/v2?phrase=hello", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, res.StatusCode)
+
+	// explain logs need the database, they are not served
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/suggest/v2/explain-logs", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotFound, res.StatusCode)
+
+	stats, err := s.CleanUserData(context.Background(), primitive.NewObjectID(), true)
+	assert.NoError(t, err)
+	assert.Empty(t, stats)
+}
+
+func TestHandleGetExplainLogs(t *testing.T) {
+	r := GetExplainLogTestRepo(t)
+	defer CleanExplainLogRepo(t, r)
+
+	userID := primitive.NewObjectID()
+	for _, phrase := range []string{"first", "second"} {
+		_, err := r.InsertRaw(context.Background(), &suggest.ExplainLog{UserID: userID, Phrase: phrase})
+		assert.NoError(t, err)
+	}
+
+	s := suggest.Service{ExplainLogRepo: r}
+	app := fiber.New()
+	app.Get("/explain-logs", func(ctx *fiber.Ctx) error {
+		ctx.Locals(auth.UserIDKey, userID)
+		return ctx.Next()
+	}, s.HandleGetExplainLogs)
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/explain-logs?limit=1", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, res.StatusCode)
+
+	var page struct {
+		Items      []suggest.ExplainLog `json:"items"`
+		NextCursor string               `json:"nextCursor"`
+	}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&page))
+	assert.Equal(t, 1, len(page.Items))
+	assert.Equal(t, "second", page.Items[0].Phrase)
+	assert.NotEmpty(t, page.NextCursor)
+
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/explain-logs?cursor=invalid", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, res.StatusCode)
+}
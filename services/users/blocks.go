@@ -0,0 +1,59 @@
+package users
+
+import (
+	"log"
+	"net/http"
+
+	"blinders/packages/auth"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// blockedIDParam parses the ID of the blocked user, users can not block themselves
+func blockedIDParam(ctx *fiber.Ctx) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+	blockedID, err := primitive.ObjectIDFromHex(ctx.Params("blockedId"))
+	if err != nil || blockedID == userID {
+		return userID, blockedID, false
+	}
+	return userID, blockedID, true
+}
+
+// BlockUser blocks the user of the param, they are no longer friends and are hidden from each other
+// in searches and language partners
+func (s Service) BlockUser(ctx *fiber.Ctx) error {
+	userID, blockedID, ok := blockedIDParam(ctx)
+	if !ok {
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "invalid blocked user id",
+		})
+	}
+
+	if err := s.UsersRepo.BlockUser(ctx.UserContext(), userID, blockedID); err != nil {
+		log.Println("can not block user:", err)
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "can not block user",
+		})
+	}
+
+	return ctx.SendStatus(http.StatusOK)
+}
+
+func (s Service) UnblockUser(ctx *fiber.Ctx) error {
+	userID, blockedID, ok := blockedIDParam(ctx)
+	if !ok {
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "invalid blocked user id",
+		})
+	}
+
+	if err := s.UsersRepo.UnblockUser(ctx.UserContext(), userID, blockedID); err != nil {
+		log.Println("can not unblock user:", err)
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "can not unblock user",
+		})
+	}
+
+	return ctx.SendStatus(http.StatusOK)
+}
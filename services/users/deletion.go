@@ -0,0 +1,236 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"blinders/packages/auth"
+	"blinders/packages/session"
+	"blinders/services/users/repo"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserDataCleaner removes or anonymises data of a user owned by a service,
+// returns the number of affected documents by name. With dry run, it only counts them
+type UserDataCleaner interface {
+	CleanUserData(ctx context.Context, userID primitive.ObjectID, dryRun bool) (map[string]int64, error)
+}
+
+type DeletionReport struct {
+	UserID   primitive.ObjectID          `json:"userId"`
+	DryRun   bool                        `json:"dryRun"`
+	Services map[string]map[string]int64 `json:"services"`
+}
+
+// RegisterDataCleaner registers a cleaner of another service, it runs when a user deletes the account
+func (s *Service) RegisterDataCleaner(name string, cleaner UserDataCleaner) {
+	if s.DataCleaners == nil {
+		s.DataCleaners = make(map[string]UserDataCleaner)
+	}
+	s.DataCleaners[name] = cleaner
+}
+
+// RegisterExternalDataCleaner registers a cleaner of data outside of mongo (e.g. sessions in redis),
+// it runs after data in mongo is deleted since it could not be rolled back with the mongo transaction
+func (s *Service) RegisterExternalDataCleaner(name string, cleaner UserDataCleaner) {
+	if s.ExternalCleaners == nil {
+		s.ExternalCleaners = make(map[string]UserDataCleaner)
+	}
+	s.ExternalCleaners[name] = cleaner
+}
+
+// DeleteSelf deletes the account and all data of the user across services,
+// use query `dryRun=true` to get the report without deleting anything
+func (s Service) DeleteSelf(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+	userAuth := ctx.Locals(auth.UserAuthKey).(*auth.UserAuth)
+	dryRun := ctx.QueryBool("dryRun", false)
+
+	report, err := s.DeleteUserData(ctx.UserContext(), userID, dryRun)
+	if err != nil {
+		log.Println("can not delete user data:", err)
+		return ctx.Status(http.StatusInternalServerError).JSON(&fiber.Map{
+			"error":  "can not delete user data, please try again",
+			"report": report,
+		})
+	}
+
+	if !dryRun {
+		if err := s.Auth.DeleteIdentity(ctx.UserContext(), userAuth.AuthID); err != nil {
+			// user data is already deleted, the identity can be cleaned up later
+			log.Println("can not delete user identity:", err)
+		}
+		// cached tokens would still resolve the deleted user until they expire
+		if err := s.Auth.InvalidateIdentity(ctx.UserContext(), userAuth.AuthID); err != nil {
+			log.Println("can not invalidate cached tokens of user:", err)
+		}
+	}
+
+	return ctx.Status(http.StatusOK).JSON(report)
+}
+
+// DeleteUserData runs registered cleaners first, then cleans users data and deletes the user document last.
+// Data in mongo is deleted in a transaction so a failed deletion leaves nothing half deleted and can be retried.
+// External cleaners run after the transaction is committed, their failures are logged and left out of the report
+// since the user is already deleted
+func (s Service) DeleteUserData(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	dryRun bool,
+) (*DeletionReport, error) {
+	report := &DeletionReport{
+		UserID:   userID,
+		DryRun:   dryRun,
+		Services: make(map[string]map[string]int64),
+	}
+
+	if dryRun {
+		if err := s.runDataCleaners(ctx, report); err != nil {
+			return report, err
+		}
+		return report, runCleaners(ctx, s.ExternalCleaners, report)
+	}
+
+	err := s.Tx.WithTransaction(ctx, func(txCtx context.Context) error {
+		// the transaction could be retried, results of the failed attempt are dropped
+		clear(report.Services)
+		return s.runDataCleaners(txCtx, report)
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for name, cleaner := range s.ExternalCleaners {
+		result, err := cleaner.CleanUserData(ctx, userID, dryRun)
+		if err != nil {
+			log.Printf("can not clean %s data of deleted user %s: %v", name, userID.Hex(), err)
+			continue
+		}
+		report.Services[name] = result
+	}
+
+	return report, nil
+}
+
+// runDataCleaners runs the mongo cleaners and cleans users data
+func (s Service) runDataCleaners(ctx context.Context, report *DeletionReport) error {
+	if err := runCleaners(ctx, s.DataCleaners, report); err != nil {
+		return err
+	}
+
+	result, err := s.CleanUserData(ctx, report.UserID, report.DryRun)
+	if err != nil {
+		return fmt.Errorf("users: %w", err)
+	}
+	report.Services["users"] = result
+
+	return nil
+}
+
+func runCleaners(ctx context.Context, cleaners map[string]UserDataCleaner, report *DeletionReport) error {
+	for name, cleaner := range cleaners {
+		result, err := cleaner.CleanUserData(ctx, report.UserID, report.DryRun)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		report.Services[name] = result
+	}
+	return nil
+}
+
+// CleanUserData removes friend links, blocks and friend requests of the user, anonymises feedback
+// and deletes the user document
+func (s Service) CleanUserData(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	dryRun bool,
+) (map[string]int64, error) {
+	result := make(map[string]int64)
+
+	if dryRun {
+		friends, err := s.UsersRepo.CountUsersWithFriend(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		blocked, err := s.UsersRepo.CountUsersBlocking(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		requests, err := s.FriendRequestsRepo.CountFriendRequestsOfUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		feedback, err := s.FeedbackRepo.CountFeedbackOfUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		result["friends"] = friends
+		result["blocked"] = blocked
+		result[repo.FriendRequestsCollection] = requests
+		result[repo.FeedbackCollection] = feedback
+		result[repo.UsersCollection] = 1
+
+		return result, nil
+	}
+
+	friends, err := s.UsersRepo.RemoveFriendFromAllUsers(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	result["friends"] = friends
+
+	blocked, err := s.UsersRepo.RemoveBlockedFromAllUsers(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	result["blocked"] = blocked
+
+	requests, err := s.FriendRequestsRepo.DeleteFriendRequestsOfUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	result[repo.FriendRequestsCollection] = requests
+
+	feedback, err := s.FeedbackRepo.AnonymiseFeedbackOfUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	result[repo.FeedbackCollection] = feedback
+
+	if _, err := s.UsersRepo.DeleteUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	result[repo.UsersCollection] = 1
+
+	return result, nil
+}
+
+// SessionsCleaner removes websocket sessions of the user stored in redis, it is an external cleaner
+type SessionsCleaner struct {
+	*session.Manager
+}
+
+func (c SessionsCleaner) CleanUserData(
+	_ context.Context,
+	userID primitive.ObjectID,
+	dryRun bool,
+) (map[string]int64, error) {
+	var (
+		count int64
+		err   error
+	)
+	if dryRun {
+		count, err = c.CountSessions(userID.Hex())
+	} else {
+		count, err = c.RemoveAllSessions(userID.Hex())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]int64{"sessions": count}, nil
+}
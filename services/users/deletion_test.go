@@ -0,0 +1,178 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"blinders/packages/dbutils"
+	"blinders/services/users/repo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	mongoTestURL    = "mongodb://localhost:27017"
+	mongoTestDBName = "blinders-test"
+	client          *mongo.Client
+)
+
+// fakeCleaner records its calls with whether the user document still exists when it runs
+type fakeCleaner struct {
+	name  string
+	users *repo.UsersRepo
+	calls *[]string
+	err   error
+}
+
+func (c fakeCleaner) CleanUserData(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	dryRun bool,
+) (map[string]int64, error) {
+	call := c.name
+	if _, err := c.users.GetUserByID(ctx, userID); err != nil {
+		call += " after user deleted"
+	}
+	*c.calls = append(*c.calls, call)
+	if c.err != nil {
+		return nil, c.err
+	}
+	if dryRun {
+		return map[string]int64{"documents": 2}, nil
+	}
+	return map[string]int64{"documents": 1}, nil
+}
+
+// deletionTestUser inserts a user with a friend, a user blocking the user, a friend request and a feedback
+func deletionTestUser(t *testing.T, s *Service) (user repo.User, feedback *repo.Feedback) {
+	ctx := context.Background()
+	newUser := func() repo.User {
+		u, err := s.UsersRepo.InsertNewRawUser(ctx, repo.User{FirebaseUID: primitive.NewObjectID().Hex()})
+		assert.Nil(t, err)
+		return u
+	}
+	user, friend, blocker := newUser(), newUser(), newUser()
+
+	assert.Nil(t, s.UsersRepo.AddFriend(ctx, user.ID, friend.ID))
+	assert.Nil(t, s.UsersRepo.BlockUser(ctx, blocker.ID, user.ID))
+	_, err := s.FriendRequestsRepo.InsertNewRawFriendRequest(ctx, repo.FriendRequest{
+		From:   user.ID,
+		To:     blocker.ID,
+		Status: repo.FriendStatusPending,
+	})
+	assert.Nil(t, err)
+	feedback, err = s.FeedbackRepo.InsertNewFeedback(ctx, repo.Feedback{UserID: user.ID, Comment: "comment"})
+	assert.Nil(t, err)
+
+	return user, feedback
+}
+
+func GetDeletionTestService(t *testing.T, calls *[]string, cleanerErr, externalErr error) *Service {
+	t.Helper()
+	if client == nil {
+		var err error
+		client, err = dbutils.InitMongoClient(mongoTestURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewService(nil, client.Database(mongoTestDBName))
+	s.RegisterDataCleaner("practice", fakeCleaner{name: "practice", users: s.UsersRepo, calls: calls, err: cleanerErr})
+	s.RegisterExternalDataCleaner("sessions", fakeCleaner{
+		name:  "sessions",
+		users: s.UsersRepo,
+		calls: calls,
+		err:   externalErr,
+	})
+	return s
+}
+
+func TestDeleteUserDataDryRun(t *testing.T) {
+	var calls []string
+	s := GetDeletionTestService(t, &calls, nil, nil)
+	user, _ := deletionTestUser(t, s)
+
+	report, err := s.DeleteUserData(context.Background(), user.ID, true)
+	assert.Nil(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, map[string]int64{
+		"friends":                     1,
+		"blocked":                     1,
+		repo.FriendRequestsCollection: 1,
+		repo.FeedbackCollection:       1,
+		repo.UsersCollection:          1,
+	}, report.Services["users"])
+	assert.Equal(t, map[string]int64{"documents": 2}, report.Services["practice"])
+	assert.Equal(t, map[string]int64{"documents": 2}, report.Services["sessions"])
+	assert.Equal(t, []string{"practice", "sessions"}, calls)
+
+	// nothing is deleted
+	_, err = s.UsersRepo.GetUserByID(context.Background(), user.ID)
+	assert.Nil(t, err)
+	count, err := s.FeedbackRepo.CountFeedbackOfUser(context.Background(), user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestDeleteUserData(t *testing.T) {
+	var calls []string
+	s := GetDeletionTestService(t, &calls, nil, errors.New("redis is down"))
+	user, feedback := deletionTestUser(t, s)
+
+	report, err := s.DeleteUserData(context.Background(), user.ID, false)
+	assert.Nil(t, err)
+	assert.False(t, report.DryRun)
+
+	// cleaners of services run before the user document is deleted, external cleaners after the commit
+	assert.Equal(t, []string{"practice", "sessions after user deleted"}, calls)
+	assert.Equal(t, map[string]int64{"documents": 1}, report.Services["practice"])
+	// failures of external cleaners are left out of the report
+	assert.NotContains(t, report.Services, "sessions")
+
+	assert.Equal(t, map[string]int64{
+		"friends":                     1,
+		"blocked":                     1,
+		repo.FriendRequestsCollection: 1,
+		repo.FeedbackCollection:       1,
+		repo.UsersCollection:          1,
+	}, report.Services["users"])
+
+	_, err = s.UsersRepo.GetUserByID(context.Background(), user.ID)
+	assert.NotNil(t, err)
+	friends, err := s.UsersRepo.CountUsersWithFriend(context.Background(), user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), friends)
+	blocking, err := s.UsersRepo.CountUsersBlocking(context.Background(), user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), blocking)
+
+	// feedback is kept without the user
+	var anonymised repo.Feedback
+	err = s.FeedbackRepo.FindOne(context.Background(), bson.M{"_id": feedback.ID}).Decode(&anonymised)
+	assert.Nil(t, err)
+	assert.True(t, anonymised.UserID.IsZero())
+	assert.Equal(t, feedback.Comment, anonymised.Comment)
+}
+
+func TestDeleteUserDataRollsBackFailedCleaners(t *testing.T) {
+	var calls []string
+	failed := errors.New("practice is down")
+	s := GetDeletionTestService(t, &calls, failed, nil)
+	user, _ := deletionTestUser(t, s)
+
+	_, err := s.DeleteUserData(context.Background(), user.ID, false)
+	assert.ErrorIs(t, err, failed)
+	// external cleaners do not run when data in mongo is not deleted
+	assert.Equal(t, []string{"practice"}, calls)
+
+	_, err = s.UsersRepo.GetUserByID(context.Background(), user.ID)
+	assert.Nil(t, err)
+	friends, err := s.UsersRepo.CountUsersWithFriend(context.Background(), user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), friends)
+}
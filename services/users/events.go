@@ -0,0 +1,45 @@
+package users
+
+import (
+	"context"
+	"strings"
+
+	"blinders/packages/dbutils"
+	"blinders/services/users/repo"
+)
+
+// RegisterChangeHandlers reacts to changes of users made by any service or instance
+func (s Service) RegisterChangeHandlers(bus *dbutils.ChangeBus) {
+	repo.OnUserChanged(bus, s.invalidateResolvedUser)
+}
+
+// invalidateResolvedUser drops cached tokens and the cached user of auth middlewares when the user is deleted
+// or the roles change, so it takes effect without waiting for the caches to expire. Delete events have no
+// document, the caches are invalidated by the ID of the user
+func (s Service) invalidateResolvedUser(ctx context.Context, event repo.UserEvent) error {
+	if !changesResolvedUser(event) {
+		return nil
+	}
+
+	return s.Auth.InvalidateUser(ctx, event.DocumentID)
+}
+
+// changesResolvedUser reports if the event changes the user resolved by auth middlewares (the ID and roles)
+func changesResolvedUser(event repo.UserEvent) bool {
+	switch event.Operation {
+	case dbutils.DeleteOperation, dbutils.ReplaceOperation:
+		return true
+	case dbutils.UpdateOperation:
+		for field := range event.UpdatedFields {
+			if field == "roles" || strings.HasPrefix(field, "roles.") {
+				return true
+			}
+		}
+		for _, field := range event.RemovedFields {
+			if field == "roles" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package users
+
+import (
+	"testing"
+
+	"blinders/packages/dbutils"
+	"blinders/services/users/repo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestChangesResolvedUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   repo.UserEvent
+		changes bool
+	}{
+		{"deleted", repo.UserEvent{Operation: dbutils.DeleteOperation}, true},
+		{"replaced", repo.UserEvent{Operation: dbutils.ReplaceOperation}, true},
+		{"inserted", repo.UserEvent{Operation: dbutils.InsertOperation}, false},
+		{"role granted", repo.UserEvent{
+			Operation:     dbutils.UpdateOperation,
+			UpdatedFields: bson.M{"roles.1": "admin", "updatedAt": 1},
+		}, true},
+		{"roles removed", repo.UserEvent{Operation: dbutils.UpdateOperation, RemovedFields: []string{"roles"}}, true},
+		{"name changed", repo.UserEvent{Operation: dbutils.UpdateOperation, UpdatedFields: bson.M{"name": "name"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.changes, changesResolvedUser(test.event))
+		})
+	}
+}
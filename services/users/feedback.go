@@ -0,0 +1,142 @@
+package users
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"blinders/packages/auth"
+	"blinders/packages/utils"
+	"blinders/services/users/repo"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// a user can send at most FeedbackRateLimit feedback in each FeedbackRateWindow (windows start on the hour)
+	FeedbackRateLimit  = 5
+	FeedbackRateWindow = time.Hour
+
+	MaxFeedbackCommentLength = 5000
+)
+
+type CreateFeedbackDTO struct {
+	Comment    string                `json:"comment"`
+	Category   repo.FeedbackCategory `json:"category"`
+	AppVersion string                `json:"appVersion"`
+}
+
+func (s Service) CreateFeedback(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+
+	payload, err := utils.ParseJSON[CreateFeedbackDTO](ctx.Body())
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "invalid payload",
+		})
+	}
+	comment := strings.TrimSpace(payload.Comment)
+	if comment == "" || len(comment) > MaxFeedbackCommentLength {
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "invalid payload, require comment with at most 5000 characters",
+		})
+	}
+	if payload.Category != "" && !payload.Category.IsValid() {
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "invalid feedback category",
+		})
+	}
+
+	// count in database instead of in memory, lambda instances do not share memory
+	now := time.Now()
+	allowed, err := s.FeedbackRepo.TakeFeedbackQuota(ctx.UserContext(), userID, now, FeedbackRateWindow, FeedbackRateLimit)
+	if err != nil {
+		log.Println("can not take feedback quota:", err)
+		return ctx.Status(http.StatusInternalServerError).JSON(&fiber.Map{
+			"error": "can not send feedback",
+		})
+	}
+	if !allowed {
+		return ctx.Status(http.StatusTooManyRequests).JSON(&fiber.Map{
+			"error": "too many feedback, please try again later",
+		})
+	}
+
+	feedback, err := s.FeedbackRepo.InsertNewFeedback(ctx.UserContext(), repo.Feedback{
+		UserID:     userID,
+		Comment:    comment,
+		Category:   payload.Category,
+		AppVersion: strings.TrimSpace(payload.AppVersion),
+	})
+	if err != nil {
+		log.Println("can not insert feedback:", err)
+		// the feedback is not sent, it does not count toward the limit
+		if err := s.FeedbackRepo.GiveBackFeedbackQuota(ctx.UserContext(), userID, now, FeedbackRateWindow); err != nil {
+			log.Println("can not give back feedback quota:", err)
+		}
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "can not send feedback",
+		})
+	}
+
+	return ctx.Status(http.StatusCreated).JSON(feedback)
+}
+
+// ListFeedback supports filters by `userId`, `category` and
+// created time range `from`, `to` in RFC3339 format
+func (s Service) ListFeedback(ctx *fiber.Ctx) error {
+	cursor, limit, err := ParsePagination(ctx)
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var filter repo.FeedbackFilter
+	if userID := ctx.Query("userId"); userID != "" {
+		filter.UserID, err = primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+				"error": "invalid user id",
+			})
+		}
+	}
+	if category := repo.FeedbackCategory(ctx.Query("category")); category != "" {
+		if !category.IsValid() {
+			return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+				"error": "invalid feedback category",
+			})
+		}
+		filter.Category = category
+	}
+	if from := ctx.Query("from"); from != "" {
+		filter.From, err = time.Parse(time.RFC3339, from)
+		if err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+				"error": "invalid from time, require RFC3339 format",
+			})
+		}
+	}
+	if to := ctx.Query("to"); to != "" {
+		filter.To, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+				"error": "invalid to time, require RFC3339 format",
+			})
+		}
+	}
+
+	feedbacks, err := s.FeedbackRepo.ListFeedback(ctx.UserContext(), filter, cursor, limit)
+	if err != nil {
+		log.Println("can not list feedback:", err)
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "can not list feedback",
+		})
+	}
+
+	return ctx.Status(http.StatusOK).JSON(NewPage(feedbacks, limit, func(f repo.Feedback) primitive.ObjectID {
+		return f.ID
+	}))
+}
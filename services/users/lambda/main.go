@@ -6,6 +6,11 @@ import (
 	"os"
 
 	"blinders/packages/service"
+	"blinders/packages/session"
+	"blinders/packages/utils"
+	"blinders/services/chat"
+	"blinders/services/practice"
+	"blinders/services/suggest"
 	"blinders/services/users"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -23,6 +28,17 @@ func init() {
 	auth, mongoDB := service.LambdaCommonSetup()
 	usersService := users.NewService(auth, mongoDB)
 
+	// other services share the same database, their cleaners run when a user deletes the account
+	usersService.RegisterDataCleaner("chat", chat.NewService(auth, mongoDB))
+	usersService.RegisterDataCleaner("practice", practice.NewService(auth, mongoDB))
+	// cleaning explain logs does not call bedrock, so the suggest service has no client here
+	usersService.RegisterDataCleaner("suggest", suggest.NewService(auth, mongoDB, nil))
+	if os.Getenv("REDIS_HOST") != "" {
+		sm := session.NewManager(utils.NewRedisClientFromEnv(context.Background()))
+		usersService.Sessions = sm
+		usersService.RegisterExternalDataCleaner("sessions", users.SessionsCleaner{Manager: sm})
+	}
+
 	app := fiber.New()
 	usersService.InitFiberRoutes(app.Group("/users"))
 
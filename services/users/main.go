@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"blinders/packages/auth"
+	"blinders/packages/dbutils"
+	"blinders/packages/session"
 	"blinders/packages/utils"
 
 	"blinders/services/users/repo"
@@ -21,6 +25,14 @@ type Service struct {
 	Auth               *auth.Manager
 	UsersRepo          *repo.UsersRepo
 	FriendRequestsRepo *repo.FriendRequestsRepo
+	FeedbackRepo       *repo.FeedbackRepo
+	DataCleaners       map[string]UserDataCleaner
+	// ExternalCleaners clean data outside of mongo, they run after the mongo transaction is committed
+	ExternalCleaners map[string]UserDataCleaner
+	Tx               *dbutils.Transactor
+
+	// Sessions is required to issue websocket tickets
+	Sessions *session.Manager
 }
 
 func NewService(auth *auth.Manager, db *mongo.Database) *Service {
@@ -28,6 +40,8 @@ func NewService(auth *auth.Manager, db *mongo.Database) *Service {
 		Auth:               auth,
 		UsersRepo:          repo.NewUsersRepo(db),
 		FriendRequestsRepo: repo.NewFriendRequestsRepo(db),
+		FeedbackRepo:       repo.NewFeedbackRepo(db),
+		Tx:                 dbutils.NewTransactor(db),
 	}
 }
 
@@ -38,6 +52,14 @@ func (s Service) InitFiberRoutes(r fiber.Router) {
 	authorized.Post("/self", s.CreateNewUserBySelf)
 
 	authorized = r.Group("/", s.Auth.FiberAuthMiddleware(auth.Config{WithUser: true}))
+	authorized.Get("/self/partners", s.GetLanguagePartners)
+	authorized.Delete("/self", s.DeleteSelf)
+	authorized.Post("/self/ws-ticket", s.IssueWebsocketTicket)
+	authorized.Put("/self/languages", s.UpdateSelfLanguages)
+	authorized.Put("/self/blocked/:blockedId", s.BlockUser)
+	authorized.Delete("/self/blocked/:blockedId", s.UnblockUser)
+	authorized.Post("/self/feedback", s.CreateFeedback)
+	authorized.Get("/feedback", auth.RequireRoles(auth.RoleAdmin), s.ListFeedback)
 	authorized.Get("/:id", ValidateUserIDParam(ValidateOptions{PublicQuery: true}), s.GetUserByID)
 	authorized.Get("/:id/friend-requests", ValidateUserIDParam(), s.GetPendingFriendRequests)
 	authorized.Post("/:id/friend-requests", ValidateUserIDParam(), s.CreateAddFriendRequest)
@@ -50,7 +72,7 @@ func (s Service) GetSelfFromAuth(ctx *fiber.Ctx) error {
 		return fmt.Errorf("required user auth")
 	}
 
-	user, err := s.UsersRepo.GetUserByFirebaseUID(userAuth.AuthID)
+	user, err := s.UsersRepo.GetUserByFirebaseUID(ctx.UserContext(), userAuth.AuthID)
 	if err == mongo.ErrNoDocuments {
 		return ctx.Status(http.StatusNotFound).JSON(nil)
 	} else if err != nil {
@@ -71,7 +93,7 @@ func (s Service) GetUserByID(ctx *fiber.Ctx) error {
 		})
 	}
 
-	user, err := s.UsersRepo.GetUserByID(oid)
+	user, err := s.UsersRepo.GetUserByID(ctx.UserContext(), oid)
 	if err != nil {
 		log.Println("can not get user:", err)
 		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
@@ -85,7 +107,7 @@ func (s Service) GetUserByID(ctx *fiber.Ctx) error {
 func (s Service) GetUsers(ctx *fiber.Ctx) error {
 	email := ctx.Query("email", "")
 	if email != "" {
-		user, err := s.UsersRepo.GetUserByEmail(email)
+		user, err := s.UsersRepo.GetUserByEmail(ctx.UserContext(), email)
 		if err != nil {
 			return ctx.SendStatus(http.StatusBadRequest)
 		}
@@ -93,13 +115,163 @@ func (s Service) GetUsers(ctx *fiber.Ctx) error {
 		return ctx.Status(http.StatusOK).JSON([]repo.User{user})
 	}
 
+	name := ctx.Query("name", "")
+	if name != "" {
+		cursor, limit, err := ParsePagination(ctx)
+		if err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		// blocked users are excluded both ways, they are lists of the searcher
+		userAuth := ctx.Locals(auth.UserAuthKey).(*auth.UserAuth)
+		searcher, err := s.UsersRepo.GetUserByFirebaseUID(ctx.UserContext(), userAuth.AuthID)
+		if err != nil {
+			log.Println("can not get user:", err)
+			return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+				"error": "can not get user",
+			})
+		}
+
+		users, err := s.UsersRepo.SearchUsersByName(ctx.UserContext(), searcher, name, cursor, limit)
+		if err != nil {
+			log.Println("can not search users:", err)
+			return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+				"error": "can not search users",
+			})
+		}
+
+		return ctx.Status(http.StatusOK).JSON(NewPage(users, limit, userCursor))
+	}
+
 	return nil
 }
 
+func (s Service) GetLanguagePartners(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+	cursor, limit, err := ParsePagination(ctx)
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	user, err := s.UsersRepo.GetUserByID(ctx.UserContext(), userID)
+	if err != nil {
+		log.Println("can not get user:", err)
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "can not get user",
+		})
+	}
+
+	partners, err := s.UsersRepo.FindLanguagePartners(ctx.UserContext(), user, cursor, limit)
+	if err != nil {
+		log.Println("can not find language partners:", err)
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "can not find language partners",
+		})
+	}
+
+	return ctx.Status(http.StatusOK).JSON(NewPage(partners, limit, userCursor))
+}
+
+type UpdateLanguagesDTO struct {
+	NativeLanguage    string   `json:"nativeLanguage"`
+	LearningLanguages []string `json:"learningLanguages"`
+}
+
+func (s Service) UpdateSelfLanguages(ctx *fiber.Ctx) error {
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+	payload, err := utils.ParseJSON[UpdateLanguagesDTO](ctx.Body())
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "invalid payload",
+		})
+	}
+
+	native, learnings := NormalizeLanguages(payload.NativeLanguage, payload.LearningLanguages)
+	if native == "" || len(learnings) == 0 {
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "invalid payload, require native language and at least one different learning language",
+		})
+	}
+
+	err = s.UsersRepo.UpdateUserLanguages(ctx.UserContext(), userID, native, learnings)
+	if err != nil {
+		log.Println("can not update user languages:", err)
+		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"error": "can not update user languages",
+		})
+	}
+
+	return ctx.SendStatus(http.StatusOK)
+}
+
+// NormalizeLanguages lowercases language codes, drops empty ones and the native language from learning languages
+func NormalizeLanguages(native string, learnings []string) (string, []string) {
+	native = strings.ToLower(strings.TrimSpace(native))
+	normalized := make([]string, 0, len(learnings))
+	for _, lang := range learnings {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if lang != "" && lang != native {
+			normalized = append(normalized, lang)
+		}
+	}
+
+	return native, normalized
+}
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// NewPage sets the next cursor only if the page is full, it means there could be more items
+func NewPage[T any](items []T, limit int64, cursorOf func(T) primitive.ObjectID) Page[T] {
+	page := Page[T]{Items: items}
+	if int64(len(items)) == limit && limit > 0 {
+		page.NextCursor = cursorOf(items[len(items)-1]).Hex()
+	}
+
+	return page
+}
+
+func userCursor(u repo.User) primitive.ObjectID { return u.ID }
+
+// ParsePagination parses `cursor` and `limit` query params
+func ParsePagination(ctx *fiber.Ctx) (primitive.ObjectID, int64, error) {
+	var cursor primitive.ObjectID
+	if c := ctx.Query("cursor", ""); c != "" {
+		oid, err := primitive.ObjectIDFromHex(c)
+		if err != nil {
+			return cursor, 0, fmt.Errorf("invalid cursor")
+		}
+		cursor = oid
+	}
+
+	limit, err := strconv.Atoi(ctx.Query("limit", strconv.Itoa(DefaultPageLimit)))
+	if err != nil || limit <= 0 {
+		return cursor, 0, fmt.Errorf("invalid limit")
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	return cursor, int64(limit), nil
+}
+
 type CreateUserDTO struct {
-	Email    string `json:"email"`
-	Name     string `json:"name"`
-	ImageURL string `json:"imageUrl"`
+	Email             string   `json:"email"`
+	Name              string   `json:"name"`
+	ImageURL          string   `json:"imageUrl"`
+	NativeLanguage    string   `json:"nativeLanguage"`
+	LearningLanguages []string `json:"learningLanguages"`
 }
 
 func (s Service) CreateNewUserBySelf(ctx *fiber.Ctx) error {
@@ -121,12 +293,16 @@ func (s Service) CreateNewUserBySelf(ctx *fiber.Ctx) error {
 		return fmt.Errorf("required user auth")
 	}
 
-	user, err := s.UsersRepo.InsertNewRawUser(repo.User{
+	native, learnings := NormalizeLanguages(userDTO.NativeLanguage, userDTO.LearningLanguages)
+	user, err := s.UsersRepo.InsertNewRawUser(ctx.UserContext(), repo.User{
 		Name:        userDTO.Name,
 		Email:       userDTO.Email,
 		ImageURL:    userDTO.ImageURL,
 		FirebaseUID: userAuth.AuthID,
 		FriendIDs:   make([]primitive.ObjectID, 0),
+
+		NativeLanguage:    native,
+		LearningLanguages: learnings,
 	})
 	if err != nil {
 		log.Println("can not create user:", err)
@@ -146,6 +322,7 @@ func (s Service) GetPendingFriendRequests(ctx *fiber.Ctx) error {
 	}
 
 	requests, err := s.FriendRequestsRepo.GetFriendRequestByTo(
+		ctx.UserContext(),
 		userID,
 		repo.FriendStatusPending,
 	)
@@ -186,7 +363,7 @@ func (s Service) CreateAddFriendRequest(ctx *fiber.Ctx) error {
 	}
 
 	var user repo.User
-	err = s.UsersRepo.FindOne(context.Background(), bson.M{
+	err = s.UsersRepo.FindOne(ctx.UserContext(), bson.M{
 		"_id":     userID,
 		"friends": bson.M{"$all": []primitive.ObjectID{friendID}},
 	}).Decode(&user)
@@ -197,6 +374,7 @@ func (s Service) CreateAddFriendRequest(ctx *fiber.Ctx) error {
 	}
 
 	r, err := s.FriendRequestsRepo.InsertNewRawFriendRequest(
+		ctx.UserContext(),
 		repo.FriendRequest{
 			From:   userID,
 			To:     friendID,
@@ -248,11 +426,18 @@ func (s Service) RespondFriendRequest(ctx *fiber.Ctx) error {
 		})
 	}
 
-	request, err := s.FriendRequestsRepo.UpdateFriendRequestStatusByID(
-		requestID,
-		userID,
-		status,
-	)
+	// the request and friends of both users are updated together, so a failure can be retried
+	var request *repo.FriendRequest
+	err = s.Tx.WithTransaction(ctx.UserContext(), func(txCtx context.Context) error {
+		request, err = s.FriendRequestsRepo.UpdateFriendRequestStatusByID(txCtx, requestID, userID, status)
+		if err != nil {
+			return err
+		}
+		if status == repo.FriendStatusAccepted {
+			return s.UsersRepo.AddFriend(txCtx, request.From, request.To)
+		}
+		return nil
+	})
 	if err != nil {
 		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
 			"error": err.Error(),
@@ -4,23 +4,123 @@ import (
 	"context"
 	"time"
 
+	"blinders/packages/dbutils"
+
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-const FeedbackCollection = "feedback"
+const (
+	FeedbackCollection = "feedback"
+	// FeedbackRatesCollection counts feedback of each user in each window for rate limiting
+	FeedbackRatesCollection = "feedback-rates"
+)
 
 type FeedbackRepo struct {
 	*mongo.Collection
+	Rates *mongo.Collection
+}
+
+var FeedbackIndexes = []dbutils.IndexSpec{
+	{
+		// used by rate limiting and listing feedback of a user
+		Collection: FeedbackCollection,
+		Name:       "userID_1_createdAt_-1",
+		Keys:       bson.D{{Key: "userID", Value: 1}, {Key: "createdAt", Value: -1}},
+	},
+}
+
+// FeedbackRatesIndexes removes counters once their window ends at expireAt
+var FeedbackRatesIndexes = []dbutils.IndexSpec{
+	{
+		Collection: FeedbackRatesCollection,
+		Name:       "expireAt_1",
+		Keys:       bson.D{{Key: "expireAt", Value: 1}},
+		TTL:        true,
+	},
 }
 
 func NewFeedbackRepo(db *mongo.Database) *FeedbackRepo {
-	return &FeedbackRepo{db.Collection(FeedbackCollection)}
+	return &FeedbackRepo{
+		Collection: db.Collection(FeedbackCollection),
+		Rates:      db.Collection(FeedbackRatesCollection),
+	}
+}
+
+// feedbackRate is the counter of feedback of a user in the window starting at the time of the ID
+type feedbackRate struct {
+	ID struct {
+		UserID primitive.ObjectID `bson:"userID"`
+		Window primitive.DateTime `bson:"window"`
+	} `bson:"_id"`
+	Count    int64              `bson:"count"`
+	ExpireAt primitive.DateTime `bson:"expireAt"`
+}
+
+// feedbackRateFilter matches the counter of the user in the window containing at
+func feedbackRateFilter(userID primitive.ObjectID, at time.Time, window time.Duration) bson.M {
+	return bson.M{"_id": bson.D{
+		{Key: "userID", Value: userID},
+		{Key: "window", Value: primitive.NewDateTimeFromTime(at.Truncate(window))},
+	}}
+}
+
+// TakeFeedbackQuota counts a feedback of the user in the window containing at, returns false if the user
+// already sent limit feedback in the window. The counter is incremented atomically, so concurrent requests
+// could not exceed the limit
+func (r *FeedbackRepo) TakeFeedbackQuota(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	at time.Time,
+	window time.Duration,
+	limit int64,
+) (bool, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx)
+	defer cancel()
+
+	filter := feedbackRateFilter(userID, at, window)
+	update := bson.M{
+		"$inc":         bson.M{"count": 1},
+		"$setOnInsert": bson.M{"expireAt": primitive.NewDateTimeFromTime(at.Truncate(window).Add(window))},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var rate feedbackRate
+	err := r.Rates.FindOneAndUpdate(ctx, filter, update, opts).Decode(&rate)
+	// concurrent upserts of a new window, the counter is inserted by the other one
+	if mongo.IsDuplicateKeyError(err) {
+		err = r.Rates.FindOneAndUpdate(ctx, filter, update, opts).Decode(&rate)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return rate.Count <= limit, nil
 }
 
-func (r *FeedbackRepo) InsertNewFeedback(f Feedback) (*Feedback, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+// GiveBackFeedbackQuota uncounts a feedback taken with TakeFeedbackQuota at the same time,
+// e.g. when the feedback could not be inserted
+func (r *FeedbackRepo) GiveBackFeedbackQuota(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	at time.Time,
+	window time.Duration,
+) error {
+	ctx, cancel := dbutils.WithTimeout(ctx)
 	defer cancel()
+
+	filter := feedbackRateFilter(userID, at, window)
+	filter["count"] = bson.M{"$gt": 0}
+	_, err := r.Rates.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"count": -1}})
+	return err
+}
+
+func (r *FeedbackRepo) InsertNewFeedback(ctx context.Context, f Feedback) (*Feedback, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	f.ID = primitive.NewObjectID()
 	f.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
 
 	_, err := r.InsertOne(ctx, f)
@@ -29,3 +129,87 @@ func (r *FeedbackRepo) InsertNewFeedback(f Feedback) (*Feedback, error) {
 	}
 	return &f, nil
 }
+
+// FeedbackFilter is used to filter feedback listing, zero values are ignored
+type FeedbackFilter struct {
+	UserID   primitive.ObjectID
+	Category FeedbackCategory
+	From     time.Time
+	To       time.Time
+}
+
+// ListFeedback returns feedback sorted from newest to oldest,
+// the last ID of a page is used as the cursor of the next page
+func (r *FeedbackRepo) ListFeedback(
+	ctx context.Context,
+	f FeedbackFilter,
+	cursor primitive.ObjectID,
+	limit int64,
+) ([]Feedback, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	filter := bson.M{}
+	if !f.UserID.IsZero() {
+		filter["userID"] = f.UserID
+	}
+	if f.Category != "" {
+		filter["category"] = f.Category
+	}
+	createdAt := bson.M{}
+	if !f.From.IsZero() {
+		createdAt["$gte"] = primitive.NewDateTimeFromTime(f.From)
+	}
+	if !f.To.IsZero() {
+		createdAt["$lt"] = primitive.NewDateTimeFromTime(f.To)
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+	if !cursor.IsZero() {
+		filter["_id"] = bson.M{"$lt": cursor}
+	}
+
+	cur, err := r.Find(ctx, filter, options.Find().
+		SetSort(bson.M{"_id": -1}).
+		SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	feedbacks := make([]Feedback, 0)
+	if err := cur.All(ctx, &feedbacks); err != nil {
+		return nil, err
+	}
+
+	return feedbacks, nil
+}
+
+// AnonymiseFeedbackOfUser keeps feedback for the team but unlinks it from the user
+func (r *FeedbackRepo) AnonymiseFeedbackOfUser(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	result, err := r.UpdateMany(ctx,
+		bson.M{"userID": userID},
+		bson.M{"$set": bson.M{"userID": primitive.NilObjectID}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *FeedbackRepo) CountFeedbackOfUser(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx)
+	defer cancel()
+
+	return r.CountDocuments(ctx, bson.M{"userID": userID})
+}
@@ -0,0 +1,103 @@
+package repo_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blinders/services/users/repo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var feedbackRepo = repo.NewFeedbackRepo(uclient.Database("blinders"))
+
+func TestInsertAndCountFeedback(t *testing.T) {
+	userID := primitive.NewObjectID()
+
+	feedback, err := feedbackRepo.InsertNewFeedback(context.Background(), repo.Feedback{
+		UserID:   userID,
+		Comment:  "comment",
+		Category: repo.FeedbackBug,
+	})
+	assert.Nil(t, err)
+	assert.False(t, feedback.ID.IsZero())
+
+	count, err := feedbackRepo.CountFeedbackOfUser(context.Background(), userID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestTakeFeedbackQuota(t *testing.T) {
+	userID := primitive.NewObjectID()
+	now := time.Now()
+
+	// concurrent requests could not exceed the limit
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int64
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := feedbackRepo.TakeFeedbackQuota(context.Background(), userID, now, time.Hour, 5)
+			assert.Nil(t, err)
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(5), allowed.Load())
+
+	// a given back quota can be taken again
+	otherID := primitive.NewObjectID()
+	for i := 0; i < 5; i++ {
+		ok, err := feedbackRepo.TakeFeedbackQuota(context.Background(), otherID, now, time.Hour, 5)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	assert.Nil(t, feedbackRepo.GiveBackFeedbackQuota(context.Background(), otherID, now, time.Hour))
+	ok, err := feedbackRepo.TakeFeedbackQuota(context.Background(), otherID, now, time.Hour, 5)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = feedbackRepo.TakeFeedbackQuota(context.Background(), otherID, now, time.Hour, 5)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// other users have their own quota
+	ok, err = feedbackRepo.TakeFeedbackQuota(context.Background(), primitive.NewObjectID(), now, time.Hour, 5)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestListFeedback(t *testing.T) {
+	userID := primitive.NewObjectID()
+	for _, category := range []repo.FeedbackCategory{repo.FeedbackBug, repo.FeedbackBug, repo.FeedbackFeature} {
+		_, err := feedbackRepo.InsertNewFeedback(context.Background(), repo.Feedback{
+			UserID:   userID,
+			Comment:  "comment",
+			Category: category,
+		})
+		assert.Nil(t, err)
+	}
+
+	page, err := feedbackRepo.ListFeedback(context.Background(), repo.FeedbackFilter{
+		UserID:   userID,
+		Category: repo.FeedbackBug,
+	}, primitive.NilObjectID, 1)
+	assert.Nil(t, err)
+	assert.Len(t, page, 1)
+
+	nextPage, err := feedbackRepo.ListFeedback(context.Background(), repo.FeedbackFilter{
+		UserID:   userID,
+		Category: repo.FeedbackBug,
+	}, page[0].ID, 10)
+	assert.Nil(t, err)
+	assert.Len(t, nextPage, 1)
+	assert.Less(t, nextPage[0].ID.Hex(), page[0].ID.Hex())
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"time"
 
+	"blinders/packages/dbutils"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -18,17 +20,29 @@ type FriendRequestsRepo struct {
 	*mongo.Collection
 }
 
+var FriendRequestsIndexes = []dbutils.IndexSpec{
+	{
+		// mostly querying pending requests to someone
+		Collection: FriendRequestsCollection,
+		Name:       "to_1_status_1",
+		Keys:       bson.D{{Key: "to", Value: 1}, {Key: "status", Value: 1}},
+	},
+	{
+		Collection: FriendRequestsCollection,
+		Name:       "from_1_to_1",
+		Keys:       bson.D{{Key: "from", Value: 1}, {Key: "to", Value: 1}},
+	},
+}
+
 func NewFriendRequestsRepo(db *mongo.Database) *FriendRequestsRepo {
-	// TODO: need to add index for `to` and `status` for optimization,
-	// mostly querying pending requests to someone
 	return &FriendRequestsRepo{db.Collection(FriendRequestsCollection)}
 }
 
 func (r *FriendRequestsRepo) InsertNewRawFriendRequest(
+	ctx context.Context,
 	request FriendRequest,
 ) (*FriendRequest, error) {
-	ctx, cancel := context.WithTimeout(
-		context.Background(), time.Second)
+	ctx, cancel := dbutils.WithTimeout(ctx)
 	defer cancel()
 
 	request.ID = primitive.NewObjectID()
@@ -52,11 +66,11 @@ func (r *FriendRequestsRepo) InsertNewRawFriendRequest(
 }
 
 func (r *FriendRequestsRepo) GetFriendRequestByFrom(
+	ctx context.Context,
 	from primitive.ObjectID,
 	status FriendRequestStatus,
 ) ([]FriendRequest, error) {
-	ctx, cancel := context.WithTimeout(
-		context.Background(), time.Second)
+	ctx, cancel := dbutils.WithTimeout(ctx)
 	defer cancel()
 
 	var filter bson.M
@@ -82,11 +96,11 @@ func (r *FriendRequestsRepo) GetFriendRequestByFrom(
 }
 
 func (r *FriendRequestsRepo) GetFriendRequestByTo(
+	ctx context.Context,
 	to primitive.ObjectID,
 	status FriendRequestStatus,
 ) ([]FriendRequest, error) {
-	ctx, cancel := context.WithTimeout(
-		context.Background(), time.Second)
+	ctx, cancel := dbutils.WithTimeout(ctx)
 	defer cancel()
 
 	var filter bson.M
@@ -112,9 +126,10 @@ func (r *FriendRequestsRepo) GetFriendRequestByTo(
 }
 
 func (r *FriendRequestsRepo) GetFriendRequestByID(
+	ctx context.Context,
 	id primitive.ObjectID,
 ) (*FriendRequest, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	ctx, cancel := dbutils.WithTimeout(ctx)
 	defer cancel()
 
 	var request FriendRequest
@@ -130,12 +145,12 @@ func (r *FriendRequestsRepo) GetFriendRequestByID(
 }
 
 func (r *FriendRequestsRepo) UpdateFriendRequestStatusByID(
+	ctx context.Context,
 	id primitive.ObjectID,
 	userID primitive.ObjectID,
 	status FriendRequestStatus,
 ) (*FriendRequest, error) {
-	ctx, cancel := context.WithTimeout(
-		context.Background(), time.Second)
+	ctx, cancel := dbutils.WithTimeout(ctx)
 	defer cancel()
 
 	result, err := r.UpdateOne(
@@ -145,7 +160,7 @@ func (r *FriendRequestsRepo) UpdateFriendRequestStatusByID(
 	)
 	if err != nil {
 		log.Println("can not update friend request:", err)
-		return nil, fmt.Errorf("can not update friend request")
+		return nil, fmt.Errorf("can not update friend request: %w", err)
 	}
 	if result.MatchedCount == 0 {
 		return nil, fmt.Errorf("not found this friend request")
@@ -154,8 +169,34 @@ func (r *FriendRequestsRepo) UpdateFriendRequestStatusByID(
 	err = r.FindOne(ctx, bson.M{"_id": id}).Decode(&request)
 	if err != nil {
 		log.Println("can not get friend request:", err)
-		return nil, fmt.Errorf("something went wrong")
+		return nil, fmt.Errorf("something went wrong: %w", err)
 	}
 
 	return &request, nil
 }
+
+// DeleteFriendRequestsOfUser deletes all requests sent from or to the user
+func (r *FriendRequestsRepo) DeleteFriendRequestsOfUser(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	result, err := r.DeleteMany(ctx, bson.M{"$or": []bson.M{{"from": userID}, {"to": userID}}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (r *FriendRequestsRepo) CountFriendRequestsOfUser(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cancel := dbutils.WithTimeout(ctx)
+	defer cancel()
+
+	return r.CountDocuments(ctx, bson.M{"$or": []bson.M{{"from": userID}, {"to": userID}}})
+}
@@ -3,14 +3,20 @@ package repo
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type User struct {
-	ID          primitive.ObjectID   `bson:"_id"         json:"id"`
-	Name        string               `bson:"name"        json:"name"`
-	Email       string               `bson:"email"       json:"email"`
-	FirebaseUID string               `bson:"firebaseUID" json:"firebaseUID"`
-	ImageURL    string               `bson:"imageURL"    json:"imageURL"`
-	FriendIDs   []primitive.ObjectID `bson:"friends"     json:"friends"`
-	CreatedAt   primitive.DateTime   `bson:"createdAt"   json:"createdAt"`
-	UpdatedAt   primitive.DateTime   `bson:"updatedAt"   json:"updatedAt"`
+	ID   primitive.ObjectID `bson:"_id"                         json:"id"`
+	Name string             `bson:"name"                        json:"name"`
+	// NameLower is the lowercase name, it is indexed for case insensitive prefix search of names
+	NameLower         string               `bson:"nameLower,omitempty"         json:"-"`
+	Email             string               `bson:"email"                       json:"email"`
+	FirebaseUID       string               `bson:"firebaseUID"                 json:"firebaseUID"`
+	ImageURL          string               `bson:"imageURL"                    json:"imageURL"`
+	FriendIDs         []primitive.ObjectID `bson:"friends"                     json:"friends"`
+	BlockedIDs        []primitive.ObjectID `bson:"blocked,omitempty"           json:"blocked,omitempty"`
+	NativeLanguage    string               `bson:"nativeLanguage,omitempty"    json:"nativeLanguage,omitempty"`
+	LearningLanguages []string             `bson:"learningLanguages,omitempty" json:"learningLanguages,omitempty"`
+	Roles             []string             `bson:"roles,omitempty"             json:"roles,omitempty"`
+	CreatedAt         primitive.DateTime   `bson:"createdAt"                   json:"createdAt"`
+	UpdatedAt         primitive.DateTime   `bson:"updatedAt"                   json:"updatedAt"`
 	// Conversations []EmbeddedConversation `bson:"conversations" json:"conversations"`
 }
 
@@ -45,8 +51,28 @@ type FriendRequest struct {
 	UpdatedAt primitive.DateTime  `bson:"updatedAt" json:"updatedAt"`
 }
 
+type FeedbackCategory string
+
+const (
+	FeedbackBug     FeedbackCategory = "bug"
+	FeedbackFeature FeedbackCategory = "feature"
+	FeedbackContent FeedbackCategory = "content"
+	FeedbackOther   FeedbackCategory = "other"
+)
+
+func (c FeedbackCategory) IsValid() bool {
+	switch c {
+	case FeedbackBug, FeedbackFeature, FeedbackContent, FeedbackOther:
+		return true
+	}
+	return false
+}
+
 type Feedback struct {
-	UserID    primitive.ObjectID `json:"userID,omitempty"    bson:"userID"`
-	Comment   string             `json:"comment,omitempty"   bson:"comment"`
-	CreatedAt primitive.DateTime `json:"createdAt,omitempty" bson:"createdAt"`
+	ID         primitive.ObjectID `json:"id,omitempty"         bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `json:"userID,omitempty"     bson:"userID"`
+	Comment    string             `json:"comment,omitempty"    bson:"comment"`
+	Category   FeedbackCategory   `json:"category,omitempty"   bson:"category,omitempty"`
+	AppVersion string             `json:"appVersion,omitempty" bson:"appVersion,omitempty"`
+	CreatedAt  primitive.DateTime `json:"createdAt,omitempty"  bson:"createdAt"`
 }
@@ -0,0 +1,34 @@
+package repo
+
+import (
+	"context"
+
+	"blinders/packages/auth"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UserResolver resolves users by firebase UID for auth middlewares
+type UserResolver struct {
+	*UsersRepo
+}
+
+func NewUserResolver(r *UsersRepo) *UserResolver {
+	return &UserResolver{UsersRepo: r}
+}
+
+func (r UserResolver) ResolveUser(ctx context.Context, authID string) (*auth.User, error) {
+	user, err := r.GetUserByFirebaseUID(ctx, authID)
+	if err == mongo.ErrNoDocuments {
+		return nil, auth.ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	roles := make([]auth.Role, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		roles = append(roles, auth.Role(role))
+	}
+
+	return &auth.User{ID: user.ID, Roles: roles}, nil
+}
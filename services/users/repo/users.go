@@ -4,8 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"regexp"
+	"strings"
 	"time"
 
+	"blinders/packages/dbutils"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -18,49 +22,139 @@ type UsersRepo struct {
 	*mongo.Collection
 }
 
-func NewUsersRepo(db *mongo.Database) *UsersRepo {
-	col := db.Collection(UsersCollection)
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
-	defer cal()
+// UsersIndexes are created by migrations, names are the default names of mongo
+// so indexes created before migrations are kept
+var UsersIndexes = []dbutils.IndexSpec{
+	{
+		Collection: UsersCollection,
+		Name:       "firebaseUID_1",
+		Keys:       bson.D{{Key: "firebaseUID", Value: 1}},
+		Unique:     true,
+	},
+	usersNameIndex,
+	{
+		// language partners discovery, see FindLanguagePartners
+		Collection: UsersCollection,
+		Name:       "nativeLanguage_1_learningLanguages_1__id_1",
+		Keys: bson.D{
+			{Key: "nativeLanguage", Value: 1},
+			{Key: "learningLanguages", Value: 1},
+			{Key: "_id", Value: 1},
+		},
+	},
+}
 
-	_, err := col.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys:    bson.M{"firebaseUID": 1},
-		Options: options.Index().SetUnique(true),
-	})
+// usersNameIndex is replaced by UsersNameLowerIndexes, case insensitive regexes could not use its bounds
+var usersNameIndex = dbutils.IndexSpec{
+	Collection: UsersCollection,
+	Name:       "name_1__id_1",
+	Keys:       bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}},
+}
+
+// UsersNameLowerIndexes is the index of prefix search by name, see SearchUsersByName
+var UsersNameLowerIndexes = []dbutils.IndexSpec{
+	{
+		Collection: UsersCollection,
+		Name:       "nameLower_1__id_1",
+		Keys:       bson.D{{Key: "nameLower", Value: 1}, {Key: "_id", Value: 1}},
+	},
+}
+
+// SetUsersNameLower sets the lowercase name of existing users and replaces the name index
+// with UsersNameLowerIndexes
+func SetUsersNameLower(ctx context.Context, db *mongo.Database) error {
+	users := db.Collection(UsersCollection)
+
+	cur, err := users.Find(ctx, bson.M{"nameLower": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"name": 1}))
 	if err != nil {
-		log.Println("can not create index for firebaseUID:", err)
-		return nil
+		return err
+	}
+	defer cur.Close(ctx)
+
+	models := make([]mongo.WriteModel, 0)
+	for cur.Next(ctx) {
+		var user User
+		if err := cur.Decode(&user); err != nil {
+			return err
+		}
+		if user.Name == "" {
+			continue
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": user.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"nameLower": strings.ToLower(user.Name)}}))
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	if len(models) > 0 {
+		if _, err := users.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
 	}
 
-	return &UsersRepo{col}
+	if err := dbutils.EnsureIndexes(ctx, db, UsersNameLowerIndexes...); err != nil {
+		return err
+	}
+	return dbutils.DropIndexes(ctx, db, usersNameIndex)
 }
 
-func (r *UsersRepo) InsertNewUser(u User) (User, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+// UnsetUsersNameLower reverts SetUsersNameLower
+func UnsetUsersNameLower(ctx context.Context, db *mongo.Database) error {
+	if err := dbutils.EnsureIndexes(ctx, db, usersNameIndex); err != nil {
+		return err
+	}
+	if err := dbutils.DropIndexes(ctx, db, UsersNameLowerIndexes...); err != nil {
+		return err
+	}
+
+	_, err := db.Collection(UsersCollection).UpdateMany(ctx,
+		bson.M{"nameLower": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"nameLower": ""}},
+	)
+	return err
+}
+
+type UserEvent = dbutils.ChangeEvent[User]
+
+// OnUserChanged subscribes the handler to changes of users
+func OnUserChanged(bus *dbutils.ChangeBus, handler func(ctx context.Context, event UserEvent) error) {
+	dbutils.Subscribe(bus, UsersCollection, handler)
+}
+
+func NewUsersRepo(db *mongo.Database) *UsersRepo {
+	return &UsersRepo{db.Collection(UsersCollection)}
+}
+
+func (r *UsersRepo) InsertNewUser(ctx context.Context, u User) (User, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
+	u.NameLower = strings.ToLower(u.Name)
 	_, err := r.InsertOne(ctx, u)
 
 	return u, err
 }
 
 // this function creates new ID and time and insert the document to database
-func (r *UsersRepo) InsertNewRawUser(u User) (User, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+func (r *UsersRepo) InsertNewRawUser(ctx context.Context, u User) (User, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
 	u.ID = primitive.NewObjectID()
 	now := primitive.NewDateTimeFromTime(time.Now())
 	u.CreatedAt = now
 	u.UpdatedAt = now
+	u.NameLower = strings.ToLower(u.Name)
 
 	_, err := r.InsertOne(ctx, u)
 
 	return u, err
 }
 
-func (r *UsersRepo) GetUserByID(id primitive.ObjectID) (User, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+func (r *UsersRepo) GetUserByID(ctx context.Context, id primitive.ObjectID) (User, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
 	var user User
@@ -69,8 +163,8 @@ func (r *UsersRepo) GetUserByID(id primitive.ObjectID) (User, error) {
 	return user, err
 }
 
-func (r *UsersRepo) GetUserByFirebaseUID(firebaseUID string) (User, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+func (r *UsersRepo) GetUserByFirebaseUID(ctx context.Context, firebaseUID string) (User, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
 	var user User
@@ -79,8 +173,8 @@ func (r *UsersRepo) GetUserByFirebaseUID(firebaseUID string) (User, error) {
 	return user, err
 }
 
-func (r *UsersRepo) GetUserByEmail(email string) (User, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+func (r *UsersRepo) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
 	var user User
@@ -89,8 +183,8 @@ func (r *UsersRepo) GetUserByEmail(email string) (User, error) {
 	return user, err
 }
 
-func (r *UsersRepo) DeleteUserByID(userID primitive.ObjectID) (User, error) {
-	ctx, cal := context.WithTimeout(context.Background(), time.Second)
+func (r *UsersRepo) DeleteUserByID(ctx context.Context, userID primitive.ObjectID) (User, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
 	defer cal()
 
 	usr := User{}
@@ -98,8 +192,41 @@ func (r *UsersRepo) DeleteUserByID(userID primitive.ObjectID) (User, error) {
 	return usr, err
 }
 
-func (r *UsersRepo) AddFriend(user1ID primitive.ObjectID, user2ID primitive.ObjectID) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+// AddUserRole grants the role to the user, it does nothing if the user already has the role
+func (r *UsersRepo) AddUserRole(ctx context.Context, userID primitive.ObjectID, role string) error {
+	return r.updateUserRoles(ctx, userID, bson.M{"$addToSet": bson.M{"roles": role}})
+}
+
+func (r *UsersRepo) RemoveUserRole(ctx context.Context, userID primitive.ObjectID, role string) error {
+	return r.updateUserRoles(ctx, userID, bson.M{"$pull": bson.M{"roles": role}})
+}
+
+func (r *UsersRepo) updateUserRoles(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	update bson.M,
+) error {
+	ctx, cal := dbutils.WithTimeout(ctx)
+	defer cal()
+
+	update["$set"] = bson.M{"updatedAt": primitive.NewDateTimeFromTime(time.Now())}
+	result, err := r.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *UsersRepo) AddFriend(
+	ctx context.Context,
+	user1ID primitive.ObjectID,
+	user2ID primitive.ObjectID,
+) error {
+	ctx, cancel := dbutils.WithTimeout(ctx)
 	defer cancel()
 
 	result, err := r.BulkWrite(
@@ -115,7 +242,7 @@ func (r *UsersRepo) AddFriend(user1ID primitive.ObjectID, user2ID primitive.Obje
 	)
 	if err != nil {
 		log.Println("can not add friend:", err)
-		return fmt.Errorf("something went wrong")
+		return fmt.Errorf("something went wrong: %w", err)
 	} else if result.ModifiedCount != 2 {
 		log.Println("wrong updated count when add friend")
 		return fmt.Errorf("update friend failed, wrong updated count")
@@ -123,3 +250,231 @@ func (r *UsersRepo) AddFriend(user1ID primitive.ObjectID, user2ID primitive.Obje
 
 	return nil
 }
+
+// BlockUser adds the blocked user to the blocked list of the user, they are no longer friends.
+// Blocked users and users blocking the user are excluded from searches and partners of the user
+func (r *UsersRepo) BlockUser(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	blockedID primitive.ObjectID,
+) error {
+	ctx, cancel := dbutils.WithTimeout(ctx)
+	defer cancel()
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	result, err := r.BulkWrite(ctx, []mongo.WriteModel{
+		mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": userID}).
+			SetUpdate(bson.M{
+				"$addToSet": bson.M{"blocked": blockedID},
+				"$pull":     bson.M{"friends": blockedID},
+				"$set":      bson.M{"updatedAt": now},
+			}),
+		mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": blockedID}).
+			SetUpdate(bson.M{"$pull": bson.M{"friends": userID}}),
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// UnblockUser removes the user from the blocked list of the user
+func (r *UsersRepo) UnblockUser(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	blockedID primitive.ObjectID,
+) error {
+	ctx, cancel := dbutils.WithTimeout(ctx)
+	defer cancel()
+
+	result, err := r.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
+		"$pull": bson.M{"blocked": blockedID},
+		"$set":  bson.M{"updatedAt": primitive.NewDateTimeFromTime(time.Now())},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// private fields are excluded when users are listed to other users
+var publicUserProjection = bson.M{
+	"email":       0,
+	"firebaseUID": 0,
+	"friends":     0,
+	"blocked":     0,
+	"roles":       0,
+}
+
+// SearchUsersByName returns users whose name starts with the prefix (case insensitive), excluding users
+// blocked by the searcher and users blocking the searcher. The prefix is matched on the lowercase name,
+// an anchored case sensitive regex is bounded by its index. Users are sorted by ID, the last ID of a page
+// is used as the cursor of the next page
+func (r *UsersRepo) SearchUsersByName(
+	ctx context.Context,
+	searcher User,
+	prefix string,
+	cursor primitive.ObjectID,
+	limit int64,
+) ([]User, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
+	defer cal()
+
+	idFilter := bson.M{"$nin": append([]primitive.ObjectID{}, searcher.BlockedIDs...)}
+	if !cursor.IsZero() {
+		idFilter["$gt"] = cursor
+	}
+	filter := bson.M{
+		"nameLower": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(strings.ToLower(prefix))},
+		"_id":       idFilter,
+		"blocked":   bson.M{"$ne": searcher.ID},
+	}
+
+	return r.findUsersPage(ctx, filter, limit)
+}
+
+// FindLanguagePartners returns users whose native language is one of the languages
+// the user is learning and who are learning the user's native language.
+// Friends, users blocked by the user and users blocking the user are excluded
+func (r *UsersRepo) FindLanguagePartners(
+	ctx context.Context,
+	user User,
+	cursor primitive.ObjectID,
+	limit int64,
+) ([]User, error) {
+	if user.NativeLanguage == "" || len(user.LearningLanguages) == 0 {
+		return make([]User, 0), nil
+	}
+
+	ctx, cal := dbutils.WithTimeout(ctx)
+	defer cal()
+
+	excluded := make([]primitive.ObjectID, 0, len(user.FriendIDs)+len(user.BlockedIDs)+1)
+	excluded = append(excluded, user.ID)
+	excluded = append(excluded, user.FriendIDs...)
+	excluded = append(excluded, user.BlockedIDs...)
+
+	idFilter := bson.M{"$nin": excluded}
+	if !cursor.IsZero() {
+		idFilter["$gt"] = cursor
+	}
+	filter := bson.M{
+		"nativeLanguage":    bson.M{"$in": user.LearningLanguages},
+		"learningLanguages": user.NativeLanguage,
+		"_id":               idFilter,
+		"blocked":           bson.M{"$ne": user.ID},
+	}
+
+	return r.findUsersPage(ctx, filter, limit)
+}
+
+func (r *UsersRepo) findUsersPage(ctx context.Context, filter bson.M, limit int64) ([]User, error) {
+	cur, err := r.Find(ctx, filter, options.Find().
+		SetSort(bson.M{"_id": 1}).
+		SetLimit(limit).
+		SetProjection(publicUserProjection))
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]User, 0)
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r *UsersRepo) UpdateUserLanguages(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	nativeLanguage string,
+	learningLanguages []string,
+) error {
+	ctx, cal := dbutils.WithTimeout(ctx)
+	defer cal()
+
+	result, err := r.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{
+		"nativeLanguage":    nativeLanguage,
+		"learningLanguages": learningLanguages,
+		"updatedAt":         primitive.NewDateTimeFromTime(time.Now()),
+	}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// RemoveFriendFromAllUsers pulls the user out of friend lists of all other users,
+// returns the number of updated users
+func (r *UsersRepo) RemoveFriendFromAllUsers(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cal := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cal()
+
+	result, err := r.UpdateMany(ctx,
+		bson.M{"friends": userID},
+		bson.M{"$pull": bson.M{"friends": userID}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *UsersRepo) CountUsersWithFriend(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
+	defer cal()
+
+	return r.CountDocuments(ctx, bson.M{"friends": userID})
+}
+
+// RemoveBlockedFromAllUsers pulls the user out of blocked lists of all other users,
+// returns the number of updated users
+func (r *UsersRepo) RemoveBlockedFromAllUsers(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cal := dbutils.WithTimeout(ctx, time.Second*5)
+	defer cal()
+
+	result, err := r.UpdateMany(ctx,
+		bson.M{"blocked": userID},
+		bson.M{"$pull": bson.M{"blocked": userID}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *UsersRepo) CountUsersBlocking(
+	ctx context.Context,
+	userID primitive.ObjectID,
+) (int64, error) {
+	ctx, cal := dbutils.WithTimeout(ctx)
+	defer cal()
+
+	return r.CountDocuments(ctx, bson.M{"blocked": userID})
+}
@@ -1,13 +1,20 @@
 package repo_test
 
 import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
 	"testing"
 
+	"blinders/packages/auth"
 	dbutils "blinders/packages/dbutils"
 	"blinders/services/users/repo"
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
@@ -15,11 +22,22 @@ var (
 	userRepo   = repo.NewUsersRepo(uclient.Database("blinders"))
 )
 
+func TestMain(m *testing.M) {
+	// indexes are created by migrations, the unique index of firebaseUID is required by tests
+	if uclient != nil {
+		err := dbutils.EnsureIndexes(context.Background(), uclient.Database("blinders"), repo.UsersIndexes...)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	os.Exit(m.Run())
+}
+
 func TestInsertUser(t *testing.T) {
 	user := repo.User{
 		FirebaseUID: primitive.NewObjectID().String(),
 	}
-	newUser, err := userRepo.InsertNewRawUser(user)
+	newUser, err := userRepo.InsertNewRawUser(context.Background(), user)
 	assert.Nil(t, err)
 	assert.NotEqual(t, newUser.ID, primitive.ObjectID{})
 	assert.Equal(t, user.ID, primitive.ObjectID{})
@@ -29,8 +47,8 @@ func TestInsertUserFailedWithDuplicatedFirebaseUID(t *testing.T) {
 	user := repo.User{
 		FirebaseUID: primitive.NewObjectID().String(),
 	}
-	_, _ = userRepo.InsertNewRawUser(user)
-	_, err := userRepo.InsertNewRawUser(user)
+	_, _ = userRepo.InsertNewRawUser(context.Background(), user)
+	_, err := userRepo.InsertNewRawUser(context.Background(), user)
 	assert.NotNil(t, err)
 }
 
@@ -38,8 +56,8 @@ func TestGetUserByFirebaseUID(t *testing.T) {
 	user := repo.User{
 		FirebaseUID: primitive.NewObjectID().String(),
 	}
-	user, _ = userRepo.InsertNewRawUser(user)
-	queriedUser, err := userRepo.GetUserByFirebaseUID(user.FirebaseUID)
+	user, _ = userRepo.InsertNewRawUser(context.Background(), user)
+	queriedUser, err := userRepo.GetUserByFirebaseUID(context.Background(), user.FirebaseUID)
 	assert.Nil(t, err)
 	assert.Equal(t, user, queriedUser)
 }
@@ -48,19 +66,19 @@ func TestGetUserByID(t *testing.T) {
 	user := repo.User{
 		FirebaseUID: primitive.NewObjectID().String(),
 	}
-	user, _ = userRepo.InsertNewRawUser(user)
-	queriedUser, err := userRepo.GetUserByID(user.ID)
+	user, _ = userRepo.InsertNewRawUser(context.Background(), user)
+	queriedUser, err := userRepo.GetUserByID(context.Background(), user.ID)
 	assert.Nil(t, err)
 	assert.Equal(t, user, queriedUser)
 }
 
 func TestGetUserByIDNotFound(t *testing.T) {
-	_, err := userRepo.GetUserByID(primitive.NewObjectID())
+	_, err := userRepo.GetUserByID(context.Background(), primitive.NewObjectID())
 	assert.NotNil(t, err)
 }
 
 func TestGetUserByFirebaseUIDNotFound(t *testing.T) {
-	_, err := userRepo.GetUserByFirebaseUID(primitive.NewObjectID().String())
+	_, err := userRepo.GetUserByFirebaseUID(context.Background(), primitive.NewObjectID().String())
 	assert.NotNil(t, err)
 }
 
@@ -68,33 +86,222 @@ func TestDeleteUserByUserID(t *testing.T) {
 	user := repo.User{
 		FirebaseUID: primitive.NewObjectID().String(),
 	}
-	user, _ = userRepo.InsertNewRawUser(user)
+	user, _ = userRepo.InsertNewRawUser(context.Background(), user)
 
-	queriedUser, err := userRepo.GetUserByID(user.ID)
+	queriedUser, err := userRepo.GetUserByID(context.Background(), user.ID)
 	assert.Nil(t, err)
 	assert.Equal(t, user, queriedUser)
 
-	deleted, err := userRepo.DeleteUserByID(user.ID)
+	deleted, err := userRepo.DeleteUserByID(context.Background(), user.ID)
 	assert.Nil(t, err)
 	assert.Equal(t, user, deleted)
 
-	failedDelete, err := userRepo.DeleteUserByID(user.ID)
+	failedDelete, err := userRepo.DeleteUserByID(context.Background(), user.ID)
 	assert.NotNil(t, err)
 	assert.Equal(t, repo.User{}, failedDelete)
 }
 
 func TestAddFriend(t *testing.T) {
-	user1, _ := userRepo.InsertNewRawUser(repo.User{
+	user1, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
 		FirebaseUID: primitive.NewObjectID().Hex(),
 		FriendIDs:   make([]primitive.ObjectID, 0),
 	})
-	user2, _ := userRepo.InsertNewRawUser(repo.User{
+	user2, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
 		FirebaseUID: primitive.NewObjectID().Hex(),
 		FriendIDs:   make([]primitive.ObjectID, 0),
 	})
 
-	err := userRepo.AddFriend(user1.ID, user2.ID)
+	err := userRepo.AddFriend(context.Background(), user1.ID, user2.ID)
 	assert.Nil(t, err)
-	err = userRepo.AddFriend(user1.ID, user2.ID)
+	err = userRepo.AddFriend(context.Background(), user1.ID, user2.ID)
 	assert.NotNil(t, err)
 }
+
+func TestAddFriendInTransaction(t *testing.T) {
+	tx := dbutils.NewTransactor(uclient.Database("blinders"))
+	user1, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		FirebaseUID: primitive.NewObjectID().Hex(),
+		FriendIDs:   make([]primitive.ObjectID, 0),
+	})
+	user2, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		FirebaseUID: primitive.NewObjectID().Hex(),
+		FriendIDs:   make([]primitive.ObjectID, 0),
+	})
+
+	// friends are not added if the unit of work fails
+	errAborted := errors.New("aborted")
+	err := tx.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if err := userRepo.AddFriend(ctx, user1.ID, user2.ID); err != nil {
+			return err
+		}
+		return errAborted
+	})
+	assert.Equal(t, errAborted, err)
+	queried, _ := userRepo.GetUserByID(context.Background(), user1.ID)
+	assert.Empty(t, queried.FriendIDs)
+
+	err = tx.WithTransaction(context.Background(), func(ctx context.Context) error {
+		return userRepo.AddFriend(ctx, user1.ID, user2.ID)
+	})
+	assert.Nil(t, err)
+	queried, _ = userRepo.GetUserByID(context.Background(), user1.ID)
+	assert.Equal(t, []primitive.ObjectID{user2.ID}, queried.FriendIDs)
+}
+
+func TestSearchUsersByName(t *testing.T) {
+	prefix := primitive.NewObjectID().Hex()
+	for i := 0; i < 3; i++ {
+		_, err := userRepo.InsertNewRawUser(context.Background(), repo.User{
+			Name:        prefix + " User",
+			FirebaseUID: primitive.NewObjectID().Hex(),
+		})
+		assert.Nil(t, err)
+	}
+	searcher := repo.User{ID: primitive.NewObjectID()}
+
+	page, err := userRepo.SearchUsersByName(context.Background(), searcher, strings.ToUpper(prefix), primitive.NilObjectID, 2)
+	assert.Nil(t, err)
+	assert.Len(t, page, 2)
+	assert.Empty(t, page[0].FirebaseUID)
+	assert.Equal(t, prefix+" User", page[0].Name)
+
+	nextPage, err := userRepo.SearchUsersByName(context.Background(), searcher, prefix+" u", page[1].ID, 2)
+	assert.Nil(t, err)
+	assert.Len(t, nextPage, 1)
+	assert.Greater(t, nextPage[0].ID.Hex(), page[1].ID.Hex())
+}
+
+func TestSearchUsersByNameExcludesBlocked(t *testing.T) {
+	prefix := primitive.NewObjectID().Hex()
+	searcher, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		Name:        "searcher",
+		FirebaseUID: primitive.NewObjectID().Hex(),
+	})
+	visible, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		Name:        prefix + " visible",
+		FirebaseUID: primitive.NewObjectID().Hex(),
+	})
+	blocked, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		Name:        prefix + " blocked",
+		FirebaseUID: primitive.NewObjectID().Hex(),
+	})
+	blocking, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		Name:        prefix + " blocking",
+		FirebaseUID: primitive.NewObjectID().Hex(),
+	})
+
+	assert.Nil(t, userRepo.BlockUser(context.Background(), searcher.ID, blocked.ID))
+	assert.Nil(t, userRepo.BlockUser(context.Background(), blocking.ID, searcher.ID))
+	searcher, _ = userRepo.GetUserByID(context.Background(), searcher.ID)
+	assert.Equal(t, []primitive.ObjectID{blocked.ID}, searcher.BlockedIDs)
+
+	users, err := userRepo.SearchUsersByName(context.Background(), searcher, prefix, primitive.NilObjectID, 10)
+	assert.Nil(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, visible.ID, users[0].ID)
+
+	assert.Nil(t, userRepo.UnblockUser(context.Background(), searcher.ID, blocked.ID))
+	searcher, _ = userRepo.GetUserByID(context.Background(), searcher.ID)
+	users, err = userRepo.SearchUsersByName(context.Background(), searcher, prefix, primitive.NilObjectID, 10)
+	assert.Nil(t, err)
+	assert.Len(t, users, 2)
+}
+
+func TestFindLanguagePartners(t *testing.T) {
+	native := primitive.NewObjectID().Hex()
+	learning := primitive.NewObjectID().Hex()
+
+	user, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		FirebaseUID:       primitive.NewObjectID().Hex(),
+		NativeLanguage:    native,
+		LearningLanguages: []string{learning},
+	})
+	partner, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		FirebaseUID:       primitive.NewObjectID().Hex(),
+		NativeLanguage:    learning,
+		LearningLanguages: []string{native},
+	})
+	friend, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		FirebaseUID:       primitive.NewObjectID().Hex(),
+		NativeLanguage:    learning,
+		LearningLanguages: []string{native},
+	})
+	_, _ = userRepo.InsertNewRawUser(context.Background(), repo.User{
+		FirebaseUID:       primitive.NewObjectID().Hex(),
+		NativeLanguage:    learning,
+		LearningLanguages: []string{native},
+		BlockedIDs:        []primitive.ObjectID{user.ID},
+	})
+	user.FriendIDs = []primitive.ObjectID{friend.ID}
+
+	partners, err := userRepo.FindLanguagePartners(context.Background(), user, primitive.NilObjectID, 10)
+	assert.Nil(t, err)
+	assert.Len(t, partners, 1)
+	assert.Equal(t, partner.ID, partners[0].ID)
+}
+
+func TestRemoveFriendFromAllUsers(t *testing.T) {
+	user1, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		FirebaseUID: primitive.NewObjectID().Hex(),
+		FriendIDs:   make([]primitive.ObjectID, 0),
+	})
+	user2, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		FirebaseUID: primitive.NewObjectID().Hex(),
+		FriendIDs:   make([]primitive.ObjectID, 0),
+	})
+	err := userRepo.AddFriend(context.Background(), user1.ID, user2.ID)
+	assert.Nil(t, err)
+
+	count, err := userRepo.CountUsersWithFriend(context.Background(), user1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+
+	removed, err := userRepo.RemoveFriendFromAllUsers(context.Background(), user1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	queriedUser, err := userRepo.GetUserByID(context.Background(), user2.ID)
+	assert.Nil(t, err)
+	assert.NotContains(t, queriedUser.FriendIDs, user1.ID)
+}
+
+func TestRemoveBlockedFromAllUsers(t *testing.T) {
+	user1, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		FirebaseUID: primitive.NewObjectID().Hex(),
+	})
+	user2, _ := userRepo.InsertNewRawUser(context.Background(), repo.User{
+		FirebaseUID: primitive.NewObjectID().Hex(),
+	})
+	err := userRepo.BlockUser(context.Background(), user2.ID, user1.ID)
+	assert.Nil(t, err)
+
+	count, err := userRepo.CountUsersBlocking(context.Background(), user1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+
+	removed, err := userRepo.RemoveBlockedFromAllUsers(context.Background(), user1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	queriedUser, err := userRepo.GetUserByID(context.Background(), user2.ID)
+	assert.Nil(t, err)
+	assert.NotContains(t, queriedUser.BlockedIDs, user1.ID)
+}
+
+func TestUserRoles(t *testing.T) {
+	user, err := userRepo.InsertNewRawUser(context.Background(), repo.User{FirebaseUID: primitive.NewObjectID().String()})
+	assert.Nil(t, err)
+
+	assert.Nil(t, userRepo.AddUserRole(context.Background(), user.ID, "admin"))
+	assert.Nil(t, userRepo.AddUserRole(context.Background(), user.ID, "admin"))
+	resolved, err := repo.NewUserResolver(userRepo).ResolveUser(context.Background(), user.FirebaseUID)
+	assert.Nil(t, err)
+	assert.Equal(t, []auth.Role{auth.RoleAdmin}, resolved.Roles)
+
+	assert.Nil(t, userRepo.RemoveUserRole(context.Background(), user.ID, "admin"))
+	found, err := userRepo.GetUserByID(context.Background(), user.ID)
+	assert.Nil(t, err)
+	assert.Empty(t, found.Roles)
+
+	assert.ErrorIs(t, userRepo.AddUserRole(context.Background(), primitive.NewObjectID(), "admin"), mongo.ErrNoDocuments)
+}
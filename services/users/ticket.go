@@ -0,0 +1,49 @@
+package users
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"blinders/packages/auth"
+	"blinders/packages/session"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WebsocketTicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// IssueWebsocketTicket issues a single-use ticket to connect to the websocket api,
+// the client connects with query `ticket=<ticket>` before it expires
+func (s Service) IssueWebsocketTicket(ctx *fiber.Ctx) error {
+	if s.Sessions == nil {
+		return ctx.Status(http.StatusServiceUnavailable).JSON(&fiber.Map{
+			"error": "websocket is not available",
+		})
+	}
+
+	userID := ctx.Locals(auth.UserIDKey).(primitive.ObjectID)
+	userAuth := ctx.Locals(auth.UserAuthKey).(*auth.UserAuth)
+	userAuthBytes, _ := json.Marshal(userAuth)
+
+	ticket, err := s.Sessions.IssueTicket(ctx.UserContext(), session.Ticket{
+		UserID: userID.Hex(),
+		Data:   string(userAuthBytes),
+	}, session.DefaultTicketTTL)
+	if err != nil {
+		log.Println("can not issue websocket ticket:", err)
+		return ctx.Status(http.StatusInternalServerError).JSON(&fiber.Map{
+			"error": "can not issue websocket ticket",
+		})
+	}
+
+	return ctx.Status(http.StatusCreated).JSON(WebsocketTicketResponse{
+		Ticket:    ticket,
+		ExpiresAt: time.Now().Add(session.DefaultTicketTTL),
+	})
+}
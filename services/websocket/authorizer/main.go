@@ -2,13 +2,10 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 
-	"blinders/packages/auth"
-	dbutils "blinders/packages/dbutils"
+	"blinders/packages/session"
 	"blinders/packages/utils"
-	usersrepo "blinders/services/users/repo"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -19,51 +16,30 @@ type APIGatewayWebsocketProxyRequest struct {
 	MethodArn                              string `json:"methodArn"` // ??? refs: https://gist.github.com/praveen001/1b045d1c31cd9c72e4e6638e9f883f83
 }
 
-var (
-	authManager *auth.Manager
-	usersRepo   *usersrepo.UsersRepo
-)
+var sessionManager *session.Manager
 
 func init() {
-	mongoDB, err := dbutils.InitMongoDatabaseFromEnv()
-	if err != nil {
-		log.Fatal(err)
-	}
-	usersRepo = usersrepo.NewUsersRepo(mongoDB)
-
-	adminConfig, err := utils.GetFile("firebase.admin.json")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	authManager, err = auth.NewFirebaseManager(adminConfig, usersRepo)
-	if err != nil {
-		log.Fatal(err)
-	}
+	sessionManager = session.NewManager(utils.NewRedisClientFromEnv(context.Background()))
 }
 
+// HandleRequest authorizes the connection by a single-use ticket issued by `POST /users/self/ws-ticket`,
+// the ID token is not accepted to avoid leaking long-lived tokens into access logs
 func HandleRequest(
-	_ context.Context,
+	ctx context.Context,
 	request APIGatewayWebsocketProxyRequest,
 ) (events.APIGatewayCustomAuthorizerResponse, error) {
-	jwt := request.QueryStringParameters["token"]
-	authUser, err := authManager.Verify(jwt)
-	if err != nil {
-		return events.APIGatewayCustomAuthorizerResponse{}, err
-	}
-
-	user, err := usersRepo.GetUserByFirebaseUID(authUser.AuthID)
+	ticket, err := sessionManager.ConsumeTicket(ctx, request.QueryStringParameters["ticket"])
 	if err != nil {
+		log.Println("[authorizer] can not consume ticket:", err)
 		return events.APIGatewayCustomAuthorizerResponse{}, err
 	}
 
 	// Is it secure to log the id out to cloudwatch?
 	// how to log the request tracking efficient and secure
-	log.Println("[authorizer] issued user's policy of", user.ID.Hex())
+	log.Println("[authorizer] issued user's policy of", ticket.UserID)
 
-	userBytes, _ := json.Marshal(authUser)
 	return events.APIGatewayCustomAuthorizerResponse{
-		PrincipalID: user.ID.Hex(),
+		PrincipalID: ticket.UserID,
 		PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
 			Version: "2012-10-17",
 			Statement: []events.IAMPolicyStatement{
@@ -75,7 +51,7 @@ func HandleRequest(
 			},
 		},
 		Context: map[string]interface{}{
-			"user": string(userBytes),
+			"user": ticket.Data,
 		},
 	}, nil
 }
@@ -1,6 +1,7 @@
 package wschat
 
 import (
+	"blinders/packages/dbutils"
 	"blinders/packages/session"
 
 	chatrepo "blinders/services/chat/repo"
@@ -14,6 +15,7 @@ type App struct {
 	Session      *session.Manager
 	MessagesRepo *chatrepo.MessagesRepo
 	ConvsRepo    *chatrepo.ConversationsRepo
+	Tx           *dbutils.Transactor
 }
 
 // init app construct an app instance for internal use
@@ -23,6 +25,7 @@ func InitChatApp(sm *session.Manager, mongoDB *mongo.Database) *App {
 		Session:      sm,
 		MessagesRepo: chatrepo.NewMessagesRepo(mongoDB),
 		ConvsRepo:    chatrepo.NewConversationsRepo(mongoDB),
+		Tx:           dbutils.NewTransactor(mongoDB),
 	}
 
 	return app
@@ -1,6 +1,7 @@
 package wschat
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
@@ -12,6 +13,7 @@ import (
 )
 
 func HandleSendMessage(
+	ctx context.Context,
 	rawUserID string, // for all case, userID must be valid and user existed
 	connectionID string,
 	payload UserSendMessagePayload,
@@ -33,13 +35,13 @@ func HandleSendMessage(
 		}
 	}
 
-	conversation, err := queryConversationOfUser(conversationID, userID)
+	conversation, err := queryConversationOfUser(ctx, conversationID, userID)
 	if err != nil {
 		return dCh, fmt.Errorf("failed to query conversation: %v", err)
 	}
 
 	if !replyTo.IsZero() {
-		err := checkValidReplyTo(replyTo, conversationID)
+		err := checkValidReplyTo(ctx, replyTo, conversationID)
 		if err != nil {
 			return dCh, fmt.Errorf("cannot reply to message %s", payload.ReplyTo)
 		}
@@ -73,7 +75,12 @@ func HandleSendMessage(
 	wg.Add(1)
 	go func() {
 		// do we need to wait for inserting success to distribute message to users?
-		_, err := app.MessagesRepo.InsertNewMessage(message)
+		err := app.Tx.WithTransaction(ctx, func(txCtx context.Context) error {
+			if _, err := app.MessagesRepo.InsertNewMessage(txCtx, message); err != nil {
+				return err
+			}
+			return app.ConvsRepo.UpdateLatestMessage(txCtx, conversationID, message)
+		})
 		if err != nil {
 			log.Fatalln("[dangerous] failed to insert message", err)
 		}
@@ -91,10 +98,11 @@ func HandleSendMessage(
 // query conversation by id
 // just send conversation via channel if user is a member
 func queryConversationOfUser(
+	ctx context.Context,
 	conversationID primitive.ObjectID,
 	userID primitive.ObjectID,
 ) (*chatrepo.Conversation, error) {
-	conversation, err := app.ConvsRepo.GetConversationByID(conversationID)
+	conversation, err := app.ConvsRepo.GetConversationByID(ctx, conversationID)
 	if err != nil {
 		return nil, err
 	}
@@ -112,8 +120,12 @@ func queryConversationOfUser(
 	)
 }
 
-func checkValidReplyTo(replyTo primitive.ObjectID, conversationID primitive.ObjectID) error {
-	repliedMessage, err := app.MessagesRepo.GetMessageByID(replyTo)
+func checkValidReplyTo(
+	ctx context.Context,
+	replyTo primitive.ObjectID,
+	conversationID primitive.ObjectID,
+) error {
+	repliedMessage, err := app.MessagesRepo.GetMessageByID(ctx, replyTo)
 	if err != nil {
 		return err
 	} else if repliedMessage.ConversationID != conversationID {
@@ -1,6 +1,7 @@
 package wschat
 
 import (
+	"context"
 	"testing"
 
 	dbutils "blinders/packages/dbutils"
@@ -26,6 +27,7 @@ func init() {
 
 func TestSendMessageFailedWithWrongPayload(t *testing.T) {
 	_, err := HandleSendMessage(
+		context.Background(),
 		primitive.NewObjectID().Hex(),
 		primitive.NewObjectID().Hex(),
 		UserSendMessagePayload{
@@ -38,6 +40,7 @@ func TestSendMessageFailedWithWrongPayload(t *testing.T) {
 	assert.NotNil(t, err)
 
 	_, err = HandleSendMessage(
+		context.Background(),
 		primitive.NewObjectID().Hex(),
 		primitive.NewObjectID().Hex(),
 		UserSendMessagePayload{
@@ -52,6 +55,7 @@ func TestSendMessageFailedWithWrongPayload(t *testing.T) {
 
 func TestSendMessageFailedWithConversationNotFound(t *testing.T) {
 	_, err := HandleSendMessage(
+		context.Background(),
 		primitive.NewObjectID().Hex(),
 		primitive.NewObjectID().Hex(),
 		UserSendMessagePayload{
@@ -64,8 +68,9 @@ func TestSendMessageFailedWithConversationNotFound(t *testing.T) {
 }
 
 func TestSendMessageFailedWithUserIsNotMember(t *testing.T) {
-	conversation, _ := app.ConvsRepo.InsertNewConversation(chatrepo.Conversation{})
+	conversation, _ := app.ConvsRepo.InsertNewConversation(context.Background(), chatrepo.Conversation{})
 	_, err := HandleSendMessage(
+		context.Background(),
 		primitive.NewObjectID().Hex(),
 		primitive.NewObjectID().Hex(),
 		UserSendMessagePayload{
@@ -78,11 +83,12 @@ func TestSendMessageFailedWithUserIsNotMember(t *testing.T) {
 }
 
 func TestSendMessageWithNoError(t *testing.T) {
-	user, _ := userRepo.InsertNewRawUser(usersrepo.User{})
-	conversation, _ := app.ConvsRepo.InsertNewRawConversation(chatrepo.Conversation{
+	user, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
+	conversation, _ := app.ConvsRepo.InsertNewRawConversation(context.Background(), chatrepo.Conversation{
 		Members: []chatrepo.Member{{UserID: user.ID}},
 	})
 	_, err := HandleSendMessage(
+		context.Background(),
 		user.ID.Hex(),
 		primitive.NewObjectID().Hex(),
 		UserSendMessagePayload{
@@ -96,6 +102,7 @@ func TestSendMessageWithNoError(t *testing.T) {
 
 func TestSendMessageFailedWithInvalidMessageToReply(t *testing.T) {
 	_, err := HandleSendMessage(
+		context.Background(),
 		primitive.NewObjectID().Hex(),
 		primitive.NewObjectID().Hex(),
 		UserSendMessagePayload{
@@ -109,15 +116,16 @@ func TestSendMessageFailedWithInvalidMessageToReply(t *testing.T) {
 }
 
 func TestSendMessageWithValidMessageToReply(t *testing.T) {
-	user, _ := userRepo.InsertNewRawUser(usersrepo.User{})
-	conversation, _ := app.ConvsRepo.InsertNewRawConversation(chatrepo.Conversation{
+	user, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
+	conversation, _ := app.ConvsRepo.InsertNewRawConversation(context.Background(), chatrepo.Conversation{
 		Members: []chatrepo.Member{{UserID: user.ID}},
 	})
-	message, _ := app.MessagesRepo.InsertNewRawMessage(chatrepo.Message{
+	message, _ := app.MessagesRepo.InsertNewRawMessage(context.Background(), chatrepo.Message{
 		ConversationID: conversation.ID,
 	})
 
 	_, err := HandleSendMessage(
+		context.Background(),
 		user.ID.Hex(),
 		primitive.NewObjectID().Hex(),
 		UserSendMessagePayload{
@@ -131,11 +139,12 @@ func TestSendMessageWithValidMessageToReply(t *testing.T) {
 }
 
 func TestSendMessageSuccess(t *testing.T) {
-	user, _ := userRepo.InsertNewRawUser(usersrepo.User{})
-	conversation, _ := app.ConvsRepo.InsertNewRawConversation(chatrepo.Conversation{
+	user, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
+	conversation, _ := app.ConvsRepo.InsertNewRawConversation(context.Background(), chatrepo.Conversation{
 		Members: []chatrepo.Member{{UserID: user.ID}},
 	})
 	_, err := HandleSendMessage(
+		context.Background(),
 		user.ID.Hex(),
 		primitive.NewObjectID().Hex(),
 		UserSendMessagePayload{
@@ -148,10 +157,11 @@ func TestSendMessageSuccess(t *testing.T) {
 }
 
 func TestSendMessageWithDistribution(t *testing.T) {
-	sender, _ := userRepo.InsertNewRawUser(usersrepo.User{})
-	recipient1, _ := userRepo.InsertNewRawUser(usersrepo.User{})
-	recipient2, _ := userRepo.InsertNewRawUser(usersrepo.User{})
+	sender, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
+	recipient1, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
+	recipient2, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
 	conversation, _ := app.ConvsRepo.InsertNewRawConversation(
+		context.Background(),
 		chatrepo.Conversation{
 			Members: []chatrepo.Member{
 				{UserID: sender.ID},
@@ -169,6 +179,7 @@ func TestSendMessageWithDistribution(t *testing.T) {
 	resolveID := primitive.NewObjectID().Hex()
 	content := "hello world"
 	dCh, err := HandleSendMessage(
+		context.Background(),
 		sender.ID.Hex(),
 		sConnID,
 		UserSendMessagePayload{
@@ -216,10 +227,11 @@ func TestSendMessageWithDistribution(t *testing.T) {
 }
 
 func TestSendMessageWithDistributionWithOfflineRecipient(t *testing.T) {
-	sender, _ := userRepo.InsertNewRawUser(usersrepo.User{})
-	recipient1, _ := userRepo.InsertNewRawUser(usersrepo.User{})
-	recipient2, _ := userRepo.InsertNewRawUser(usersrepo.User{})
+	sender, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
+	recipient1, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
+	recipient2, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
 	conversation, _ := app.ConvsRepo.InsertNewRawConversation(
+		context.Background(),
 		chatrepo.Conversation{
 			Members: []chatrepo.Member{
 				{UserID: sender.ID},
@@ -235,6 +247,7 @@ func TestSendMessageWithDistributionWithOfflineRecipient(t *testing.T) {
 	resolveID := primitive.NewObjectID().Hex()
 	content := "hello world"
 	dCh, err := HandleSendMessage(
+		context.Background(),
 		sender.ID.Hex(),
 		sConnID,
 		UserSendMessagePayload{
@@ -262,10 +275,11 @@ func TestSendMessageWithDistributionWithOfflineRecipient(t *testing.T) {
 }
 
 func TestSendMessageWithDistributionWithMultipleSessionsPerUser(t *testing.T) {
-	sender, _ := userRepo.InsertNewRawUser(usersrepo.User{})
-	recipient1, _ := userRepo.InsertNewRawUser(usersrepo.User{})
-	recipient2, _ := userRepo.InsertNewRawUser(usersrepo.User{})
+	sender, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
+	recipient1, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
+	recipient2, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
 	conversation, _ := app.ConvsRepo.InsertNewRawConversation(
+		context.Background(),
 		chatrepo.Conversation{
 			Members: []chatrepo.Member{
 				{UserID: sender.ID},
@@ -283,6 +297,7 @@ func TestSendMessageWithDistributionWithMultipleSessionsPerUser(t *testing.T) {
 	resolveID := primitive.NewObjectID().Hex()
 	content := "hello world"
 	dCh, err := HandleSendMessage(
+		context.Background(),
 		sender.ID.Hex(),
 		sConnID,
 		UserSendMessagePayload{
@@ -311,10 +326,11 @@ func TestSendMessageWithDistributionWithMultipleSessionsPerUser(t *testing.T) {
 }
 
 func TestSendMessageWithDistributionWithStoredMessage(t *testing.T) {
-	sender, _ := userRepo.InsertNewRawUser(usersrepo.User{})
-	recipient1, _ := userRepo.InsertNewRawUser(usersrepo.User{})
-	recipient2, _ := userRepo.InsertNewRawUser(usersrepo.User{})
+	sender, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
+	recipient1, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
+	recipient2, _ := userRepo.InsertNewRawUser(context.Background(), usersrepo.User{})
 	conversation, _ := app.ConvsRepo.InsertNewRawConversation(
+		context.Background(),
 		chatrepo.Conversation{
 			Members: []chatrepo.Member{
 				{UserID: sender.ID},
@@ -330,6 +346,7 @@ func TestSendMessageWithDistributionWithStoredMessage(t *testing.T) {
 	resolveID := primitive.NewObjectID().Hex()
 	content := "hello world"
 	dCh, err := HandleSendMessage(
+		context.Background(),
 		sender.ID.Hex(),
 		sConnID,
 		UserSendMessagePayload{
@@ -355,7 +372,7 @@ func TestSendMessageWithDistributionWithStoredMessage(t *testing.T) {
 		}
 
 	}
-	storedMessage, err := app.MessagesRepo.GetMessageByID(message1.ID)
+	storedMessage, err := app.MessagesRepo.GetMessageByID(context.Background(), message1.ID)
 	assert.Nil(t, err)
 	assert.Equal(t, storedMessage, message1)
 	assert.Equal(t, storedMessage, message2)
@@ -71,7 +71,7 @@ func HandleRequest(
 			break
 		}
 
-		dCh, err := wschat.HandleSendMessage(userID, connectionID, *payload)
+		dCh, err := wschat.HandleSendMessage(ctx, userID, connectionID, *payload)
 		if err != nil {
 			log.Println("failed to send message:", err)
 			_ = APIGatewayClient.Publish(